@@ -3,15 +3,21 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"log"
 	"os"
+	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 
+	"github.com/harmlessevil/recipes-api/derive"
+	"github.com/harmlessevil/recipes-api/ingredients"
 	"github.com/harmlessevil/recipes-api/models"
+	"github.com/harmlessevil/recipes-api/recipefile"
 
 	_ "embed"
 )
@@ -19,6 +25,14 @@ import (
 //go:embed recipes.json
 var recipesJSON []byte
 
+//go:embed substitutions.json
+var substitutionsJSON []byte
+
+var (
+	importPath   = flag.String("import", "", "seed the recipes of a Paprika, MealMaster, Open Recipe Format or Cooklang file instead of the bundled ones")
+	importFormat = flag.String("format", "", "format of the imported file, told by its name by default")
+)
+
 func connectToMongoDB(ctx context.Context) (*mongo.Client, error) {
 	client, err := mongo.Connect(ctx, options.Client().ApplyURI(os.Getenv("MONGO_URI")))
 	if err != nil {
@@ -34,15 +48,47 @@ func connectToMongoDB(ctx context.Context) (*mongo.Client, error) {
 	return client, nil
 }
 
+// loadRecipes reads the recipes to seed, the bundled ones unless a file is
+// imported.
+func loadRecipes() ([]models.Recipe, error) {
+	if *importPath == "" {
+		var recipes []models.Recipe
+		err := json.Unmarshal(recipesJSON, &recipes)
+
+		return recipes, err
+	}
+
+	data, err := os.ReadFile(*importPath)
+	if err != nil {
+		return nil, err
+	}
+
+	recipes, err := recipefile.Read(*importFormat, *importPath, data)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for i := range recipes {
+		recipes[i].PublishedAt = now
+		if recipes[i].Source != nil {
+			recipes[i].Source.ImportedAt = now
+		}
+	}
+
+	return recipes, nil
+}
+
 func seedDatabase(ctx context.Context, collection *mongo.Collection) error {
-	var recipes []models.Recipe
-	if err := json.Unmarshal(recipesJSON, &recipes); err != nil {
+	recipes, err := loadRecipes()
+	if err != nil {
 		return err
 	}
 
 	data := make([]any, len(recipes))
 	for i, recipe := range recipes {
 		recipe.ID = primitive.NewObjectID()
+		derive.Recipe(&recipe)
 		data[i] = recipe
 	}
 
@@ -56,6 +102,43 @@ func seedDatabase(ctx context.Context, collection *mongo.Collection) error {
 	return nil
 }
 
+// seedSubstitutions upserts the curated substitution table, so it can be
+// re-run without duplicating entries edited by moderators since.
+func seedSubstitutions(ctx context.Context, collection *mongo.Collection) error {
+	var substitutions []models.Substitution
+	if err := json.Unmarshal(substitutionsJSON, &substitutions); err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	writes := make([]mongo.WriteModel, len(substitutions))
+	for i, substitution := range substitutions {
+		substitution.Ingredient = ingredients.Normalize(substitution.Ingredient)
+
+		writes[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"ingredient": substitution.Ingredient, "substitute": substitution.Substitute}).
+			SetUpdate(bson.M{"$setOnInsert": bson.M{
+				"_id":       primitive.NewObjectID(),
+				"ratio":     substitution.Ratio,
+				"note":      substitution.Note,
+				"diets":     substitution.Diets,
+				"createdAt": now,
+				"updatedAt": now,
+			}}).
+			SetUpsert(true)
+	}
+
+	res, err := collection.BulkWrite(ctx, writes)
+	if err != nil {
+		return err
+	}
+
+	log.Println("Inserted substitutions: ", res.UpsertedCount)
+
+	return nil
+}
+
 func runMain() error {
 	ctx := context.Background()
 
@@ -66,10 +149,18 @@ func runMain() error {
 
 	recipesCollection := mongoDBClient.Database(os.Getenv("MONGO_DATABASE")).Collection("stepByStepRecipes")
 
-	return seedDatabase(ctx, recipesCollection)
+	if err := seedDatabase(ctx, recipesCollection); err != nil {
+		return err
+	}
+
+	substitutionsCollection := mongoDBClient.Database(os.Getenv("MONGO_DATABASE")).Collection("substitutions")
+
+	return seedSubstitutions(ctx, substitutionsCollection)
 }
 
 func main() {
+	flag.Parse()
+
 	if err := runMain(); err != nil {
 		log.Fatal(err)
 	}
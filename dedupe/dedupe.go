@@ -0,0 +1,310 @@
+// Package dedupe finds recipes that are likely duplicates of each other by
+// the similarity of their names and ingredients. Similarity is the Jaccard
+// index of the normalized words of the names and of the sets of
+// ingredients. It is estimated with MinHash to find candidates without
+// comparing every pair of recipes.
+package dedupe
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/harmlessevil/recipes-api/ingredients"
+)
+
+// Threshold is the similarity from which recipes are likely duplicates.
+const Threshold = 0.7
+
+// Signatures are split into bands of rows. Recipes sharing a band are
+// candidates, which happens with a probability of 1-(1-s^rows)^bands for
+// features with a Jaccard index of s: nearly always at 0.7 but 0.15 at 0.2.
+const (
+	bands = 20
+	rows  = 3
+)
+
+// The weights of names and ingredients in the similarity.
+const (
+	nameWeight       = 0.35
+	ingredientWeight = 0.65
+)
+
+var nonWords = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// nameStopWords carry no meaning in recipe names.
+var nameStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "the": true, "with": true, "of": true,
+	"in": true, "on": true, "my": true, "our": true, "best": true, "easy": true,
+	"quick": true, "simple": true, "classic": true, "homemade": true,
+	"perfect": true, "recipe": true, "style": true, "ever": true,
+}
+
+// Fingerprint is what recipes are compared by.
+type Fingerprint struct {
+	// Name and Ingredients are sorted sets of normalized words and names
+	Name        []string
+	Ingredients []string
+	// Signature holds the minimum hash of the features for each of the
+	// hash functions
+	Signature []uint64
+}
+
+// NameWords normalizes a recipe name into its words, so that "The Best
+// Banana Breads" and "banana bread" are equal.
+func NameWords(name string) []string {
+	var words []string
+	for _, word := range strings.Fields(nonWords.ReplaceAllString(strings.ToLower(name), " ")) {
+		if nameStopWords[word] {
+			continue
+		}
+
+		if word = ingredients.Normalize(word); word != "" {
+			words = append(words, word)
+		}
+	}
+
+	return set(words)
+}
+
+// IngredientNames normalizes ingredient lines into the set of their names.
+func IngredientNames(lines []string) []string {
+	var names []string
+	for _, ingredient := range ingredients.ParseAll(lines) {
+		if ingredient.Name != "" {
+			names = append(names, ingredient.Name)
+		}
+	}
+
+	return set(names)
+}
+
+func set(values []string) []string {
+	sort.Strings(values)
+
+	unique := make([]string, 0, len(values))
+	for i, value := range values {
+		if i == 0 || value != values[i-1] {
+			unique = append(unique, value)
+		}
+	}
+
+	return unique
+}
+
+// seeds are the seeds of the hash functions.
+var seeds = func() []uint64 {
+	seeds := make([]uint64, bands*rows)
+	state := uint64(0x5eed)
+	for i := range seeds {
+		state += 0x9e3779b97f4a7c15
+		seeds[i] = mix(state)
+	}
+
+	return seeds
+}()
+
+// mix is the finalizer of splitmix64.
+func mix(x uint64) uint64 {
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+
+	return x ^ (x >> 31)
+}
+
+func hash(feature string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+
+	return h.Sum64()
+}
+
+// New fingerprints a recipe.
+func New(name string, ingredientLines []string) Fingerprint {
+	f := Fingerprint{
+		Name:        NameWords(name),
+		Ingredients: IngredientNames(ingredientLines),
+		Signature:   make([]uint64, len(seeds)),
+	}
+
+	for i := range f.Signature {
+		f.Signature[i] = math.MaxUint64
+	}
+
+	features := make([]uint64, 0, len(f.Name)+len(f.Ingredients))
+	for _, word := range f.Name {
+		features = append(features, hash("name:"+word))
+	}
+	for _, ingredient := range f.Ingredients {
+		features = append(features, hash("ingredient:"+ingredient))
+	}
+
+	for _, feature := range features {
+		for i, seed := range seeds {
+			if h := mix(feature ^ seed); h < f.Signature[i] {
+				f.Signature[i] = h
+			}
+		}
+	}
+
+	return f
+}
+
+// Empty reports whether there is nothing to compare the recipe by.
+func (f Fingerprint) Empty() bool {
+	return len(f.Name) == 0 && len(f.Ingredients) == 0
+}
+
+// Bands returns the keys of the bands of the signature. Recipes that
+// share any are candidate duplicates. Empty fingerprints have none.
+func (f Fingerprint) Bands() []string {
+	if f.Empty() || len(f.Signature) != bands*rows {
+		return nil
+	}
+
+	keys := make([]string, bands)
+	for band := range keys {
+		h := fnv.New64a()
+		for _, value := range f.Signature[band*rows : (band+1)*rows] {
+			var b [8]byte
+			binary.BigEndian.PutUint64(b[:], value)
+			h.Write(b[:])
+		}
+
+		keys[band] = strconv.Itoa(band) + ":" + strconv.FormatUint(h.Sum64(), 36)
+	}
+
+	return keys
+}
+
+// Jaccard is the size of the intersection of two sorted sets divided by
+// the size of their union, 0 for empty sets.
+func Jaccard(a, b []string) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			shared++
+			i++
+			j++
+		case a[i] < b[j]:
+			i++
+		default:
+			j++
+		}
+	}
+
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// Similarity weighs the similarity of the names and of the ingredients of
+// two recipes. Recipes without ingredients are compared by name alone.
+func Similarity(a, b Fingerprint) float64 {
+	name := Jaccard(a.Name, b.Name)
+	if len(a.Ingredients) == 0 && len(b.Ingredients) == 0 {
+		return name
+	}
+
+	return nameWeight*name + ingredientWeight*Jaccard(a.Ingredients, b.Ingredients)
+}
+
+// Cluster is a group of likely duplicates.
+type Cluster struct {
+	// Members are indexes of the fingerprints, in ascending order
+	Members []int
+	// Similarity is the lowest similarity among the pairs of members
+	// found to be alike
+	Similarity float64
+}
+
+// Clusters groups the fingerprints whose similarity reaches threshold,
+// directly or through other members. Fingerprints without duplicates are
+// left out. The largest clusters come first.
+func Clusters(fingerprints []Fingerprint, threshold float64) []Cluster {
+	buckets := make(map[string][]int)
+	for i, f := range fingerprints {
+		for _, key := range f.Bands() {
+			buckets[key] = append(buckets[key], i)
+		}
+	}
+
+	parent := make([]int, len(fingerprints))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+
+		return parent[i]
+	}
+
+	type pair struct{ a, b int }
+	compared := make(map[pair]bool)
+	lowest := make(map[int]float64)
+	for _, members := range buckets {
+		for x := 0; x < len(members); x++ {
+			for y := x + 1; y < len(members); y++ {
+				p := pair{members[x], members[y]}
+				if compared[p] {
+					continue
+				}
+				compared[p] = true
+
+				similarity := Similarity(fingerprints[p.a], fingerprints[p.b])
+				if similarity < threshold {
+					continue
+				}
+
+				rootA, rootB := find(p.a), find(p.b)
+				low := similarity
+				for _, root := range []int{rootA, rootB} {
+					if s, ok := lowest[root]; ok && s < low {
+						low = s
+					}
+				}
+
+				delete(lowest, rootA)
+				delete(lowest, rootB)
+				parent[rootB] = rootA
+				lowest[rootA] = low
+			}
+		}
+	}
+
+	groups := make(map[int][]int)
+	for i := range fingerprints {
+		root := find(i)
+		groups[root] = append(groups[root], i)
+	}
+
+	var clusters []Cluster
+	for root, members := range groups {
+		if len(members) > 1 {
+			clusters = append(clusters, Cluster{Members: members, Similarity: lowest[root]})
+		}
+	}
+
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i].Members) != len(clusters[j].Members) {
+			return len(clusters[i].Members) > len(clusters[j].Members)
+		}
+		if clusters[i].Similarity != clusters[j].Similarity {
+			return clusters[i].Similarity > clusters[j].Similarity
+		}
+
+		return clusters[i].Members[0] < clusters[j].Members[0]
+	})
+
+	return clusters
+}
@@ -0,0 +1,128 @@
+package dedupe
+
+import (
+	"reflect"
+	"testing"
+)
+
+var bananaBread = []string{
+	"3 ripe bananas, mashed", "1/3 cup butter, melted", "3/4 cup sugar", "1 egg, beaten",
+	"1 tsp baking soda", "1 pinch salt", "1 1/2 cups all-purpose flour",
+}
+
+func TestNameWords(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"Banana Bread", []string{"banana", "bread"}},
+		{"The Best Banana Breads!", []string{"banana", "bread"}},
+		{"Easy Chicken & Rice", []string{"chicken", "rice"}},
+		{"Recipe", []string{}},
+	}
+
+	for _, test := range tests {
+		if words := NameWords(test.name); !reflect.DeepEqual(words, test.want) {
+			t.Errorf("NameWords(%q) = %q, want %q", test.name, words, test.want)
+		}
+	}
+}
+
+func TestJaccard(t *testing.T) {
+	tests := []struct {
+		a, b []string
+		want float64
+	}{
+		{[]string{"a", "b", "c"}, []string{"a", "b", "c"}, 1},
+		{[]string{"a", "b"}, []string{"b", "c"}, 1.0 / 3},
+		{[]string{"a"}, []string{"b"}, 0},
+		{nil, []string{"a"}, 0},
+		{nil, nil, 0},
+	}
+
+	for _, test := range tests {
+		if j := Jaccard(test.a, test.b); j != test.want {
+			t.Errorf("Jaccard(%q, %q) = %v, want %v", test.a, test.b, j, test.want)
+		}
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	original := New("Banana Bread", bananaBread)
+
+	tests := []struct {
+		name        string
+		ingredients []string
+		duplicate   bool
+	}{
+		{"Banana Bread", bananaBread, true},
+		// Stop words in the name and walnuts added
+		{"The Best Banana Bread", append([]string{"1/2 cup chopped walnuts"}, bananaBread...), true},
+		// Other amounts and spellings
+		{"Moist Banana Bread", []string{
+			"2 ripe bananas", "1/2 cup butter", "1 cup sugar", "1 large egg",
+			"1 teaspoon baking soda", "1/4 tsp salt", "1 1/2 cups all-purpose flour",
+		}, true},
+		{"Zucchini Bread", []string{
+			"2 cups grated zucchini", "1/3 cup vegetable oil", "1 cup sugar", "3 eggs",
+			"1 tsp baking soda", "1 tsp cinnamon", "2 cups flour",
+		}, false},
+		{"Banana Smoothie", []string{"2 bananas", "1 cup milk", "1 tbsp honey"}, false},
+	}
+
+	for _, test := range tests {
+		similarity := Similarity(original, New(test.name, test.ingredients))
+		if duplicate := similarity >= Threshold; duplicate != test.duplicate {
+			t.Errorf("Similarity(%q) = %.2f, want duplicate %t", test.name, similarity, test.duplicate)
+		}
+	}
+}
+
+func TestBands(t *testing.T) {
+	a := New("Banana Bread", bananaBread)
+	b := New("Banana Bread", bananaBread)
+
+	if !reflect.DeepEqual(a.Bands(), b.Bands()) {
+		t.Error("Bands of identical recipes differ")
+	}
+
+	if n := len(a.Bands()); n != bands {
+		t.Errorf("len(Bands) = %d, want %d", n, bands)
+	}
+
+	if keys := New("", nil).Bands(); keys != nil {
+		t.Errorf("Bands of an empty recipe = %q, want none", keys)
+	}
+}
+
+func TestClusters(t *testing.T) {
+	fingerprints := []Fingerprint{
+		New("Banana Bread", bananaBread),
+		New("Pancakes", []string{"1 1/2 cups flour", "2 eggs", "1 1/4 cups milk", "1 tbsp sugar", "1 pinch salt"}),
+		New("Banana Bread", bananaBread),
+		New("Easy Pancakes", []string{"1 1/2 cups flour", "2 eggs", "1 1/4 cups milk", "1 tbsp sugar", "1 pinch salt"}),
+		New("Banana Bread", append([]string{"1/2 cup walnuts"}, bananaBread...)),
+		New("Guacamole", []string{"2 avocados", "1 lime", "1/4 cup red onion", "1 tsp salt"}),
+	}
+
+	clusters := Clusters(fingerprints, Threshold)
+
+	want := [][]int{{0, 2, 4}, {1, 3}}
+	if len(clusters) != len(want) {
+		t.Fatalf("Clusters = %+v, want members %v", clusters, want)
+	}
+
+	for i, cluster := range clusters {
+		if !reflect.DeepEqual(cluster.Members, want[i]) {
+			t.Errorf("Clusters[%d].Members = %v, want %v", i, cluster.Members, want[i])
+		}
+
+		if cluster.Similarity < Threshold || cluster.Similarity > 1 {
+			t.Errorf("Clusters[%d].Similarity = %v, want at least %v", i, cluster.Similarity, Threshold)
+		}
+	}
+
+	if clusters[1].Similarity != 1 {
+		t.Errorf("Similarity of identical pancakes = %v, want 1", clusters[1].Similarity)
+	}
+}
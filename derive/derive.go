@@ -0,0 +1,60 @@
+// Package derive computes the fields of a recipe that are derived from
+// what its author wrote: its diets and allergens, its steps and times, and
+// its fingerprint for finding duplicates. The API and the seeding command
+// share it, so that seeded recipes are stored as the API would store them.
+package derive
+
+import (
+	"sort"
+
+	"github.com/harmlessevil/recipes-api/dedupe"
+	"github.com/harmlessevil/recipes-api/ingredients"
+	"github.com/harmlessevil/recipes-api/models"
+	"github.com/harmlessevil/recipes-api/steps"
+)
+
+// Recipe computes the fields of a recipe that are derived from its
+// ingredients and instructions.
+func Recipe(recipe *models.Recipe) {
+	Labels(recipe)
+
+	recipe.Steps = steps.Parse(recipe.Instructions, recipe.Ingredients)
+	recipe.PrepTime, recipe.CookTime = steps.Times(recipe.Steps)
+	recipe.TotalTime = recipe.PrepTime + recipe.CookTime
+
+	recipe.Fingerprint = dedupe.New(recipe.Name, recipe.Ingredients).Bands()
+}
+
+// Labels derives the diets and allergens of a recipe from its ingredients
+// and the overrides of its author.
+func Labels(recipe *models.Recipe) {
+	recipe.Diets, recipe.Allergens = ingredients.Labels(recipe.Ingredients)
+
+	if recipe.LabelOverrides != nil {
+		recipe.Diets = applyOverrides(recipe.Diets, recipe.LabelOverrides.Diets)
+		recipe.Allergens = applyOverrides(recipe.Allergens, recipe.LabelOverrides.Allergens)
+	}
+}
+
+// applyOverrides adds the labels overridden to true and removes the ones
+// overridden to false.
+func applyOverrides(labels []string, overrides map[string]bool) []string {
+	set := make(map[string]bool, len(labels))
+	for _, label := range labels {
+		set[label] = true
+	}
+
+	for label, on := range overrides {
+		set[label] = on
+	}
+
+	result := make([]string, 0, len(set))
+	for label, on := range set {
+		if on {
+			result = append(result, label)
+		}
+	}
+	sort.Strings(result)
+
+	return result
+}
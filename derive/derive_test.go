@@ -0,0 +1,39 @@
+package derive
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+func TestLabelsOverrides(t *testing.T) {
+	recipe := models.Recipe{Ingredients: []string{"2 cups flour", "1 cup milk"}}
+	Labels(&recipe)
+	derived := recipe.Allergens
+
+	recipe.LabelOverrides = &models.LabelOverrides{Allergens: map[string]bool{derived[0]: false, "sesame": true}}
+	Labels(&recipe)
+
+	want := append([]string{}, derived[1:]...)
+	want = append(want, "sesame")
+	if !reflect.DeepEqual(recipe.Allergens, want) {
+		t.Errorf("Labels with overrides = %v, want %v", recipe.Allergens, want)
+	}
+}
+
+func TestRecipe(t *testing.T) {
+	recipe := models.Recipe{
+		Name:         "Pancakes",
+		Ingredients:  []string{"2 cups flour", "1 cup milk", "2 eggs"},
+		Instructions: []string{"Whisk everything together.", "Cook for 5 minutes on each side."},
+	}
+	Recipe(&recipe)
+
+	if len(recipe.Steps) != 2 || recipe.CookTime == 0 || recipe.TotalTime != recipe.PrepTime+recipe.CookTime {
+		t.Errorf("Recipe steps = %v, times = %d + %d = %d", recipe.Steps, recipe.PrepTime, recipe.CookTime, recipe.TotalTime)
+	}
+	if len(recipe.Fingerprint) == 0 || len(recipe.Allergens) == 0 {
+		t.Errorf("Recipe fingerprint = %v, allergens = %v", recipe.Fingerprint, recipe.Allergens)
+	}
+}
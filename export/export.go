@@ -0,0 +1,285 @@
+// Package export writes recipes one at a time in several file formats, so
+// that whole collections can be streamed without holding them in memory.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+// Encoder writes a sequence of recipes. Begin and End write what comes
+// before the first and after the last recipe.
+type Encoder interface {
+	Begin() error
+	Encode(recipe *models.Recipe) error
+	End() error
+}
+
+type Format struct {
+	ContentType string
+	Extension   string
+	NewEncoder  func(w io.Writer) Encoder
+}
+
+var Formats = map[string]Format{
+	"json":     {"application/json; charset=utf-8", "json", newJSONEncoder},
+	"ndjson":   {"application/x-ndjson; charset=utf-8", "ndjson", newNDJSONEncoder},
+	"csv":      {"text/csv; charset=utf-8", "csv", newCSVEncoder},
+	"markdown": {"text/markdown; charset=utf-8", "md", newMarkdownEncoder},
+	"yaml":     {"application/yaml; charset=utf-8", "yaml", newYAMLEncoder},
+}
+
+// FormatNames lists the supported formats in a stable order.
+var FormatNames = []string{"json", "ndjson", "csv", "markdown", "yaml"}
+
+// jsonEncoder writes a JSON array with one recipe per line.
+type jsonEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func newJSONEncoder(w io.Writer) Encoder {
+	return &jsonEncoder{w: w}
+}
+
+func (e *jsonEncoder) Begin() error {
+	_, err := io.WriteString(e.w, "[")
+	return err
+}
+
+func (e *jsonEncoder) Encode(recipe *models.Recipe) error {
+	data, err := json.Marshal(recipe)
+	if err != nil {
+		return err
+	}
+
+	separator := ",\n"
+	if e.count == 0 {
+		separator = "\n"
+	}
+	e.count++
+
+	_, err = io.WriteString(e.w, separator+string(data))
+
+	return err
+}
+
+func (e *jsonEncoder) End() error {
+	end := "\n]\n"
+	if e.count == 0 {
+		end = "]\n"
+	}
+	_, err := io.WriteString(e.w, end)
+
+	return err
+}
+
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func newNDJSONEncoder(w io.Writer) Encoder {
+	return &ndjsonEncoder{enc: json.NewEncoder(w)}
+}
+
+func (e *ndjsonEncoder) Begin() error { return nil }
+
+func (e *ndjsonEncoder) Encode(recipe *models.Recipe) error {
+	return e.enc.Encode(recipe)
+}
+
+func (e *ndjsonEncoder) End() error { return nil }
+
+// csvHeader names the columns of CSV exports. Lists are joined with
+// newlines, which CSV readers keep inside quoted cells.
+var csvHeader = []string{
+	"id", "name", "tags", "ingredients", "instructions", "servings", "publishedAt", "authorId",
+	"prepTime", "cookTime", "totalTime", "ratingAverage", "ratingCount", "diets", "allergens", "source",
+}
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func newCSVEncoder(w io.Writer) Encoder {
+	return &csvEncoder{w: csv.NewWriter(w)}
+}
+
+func (e *csvEncoder) Begin() error {
+	return e.w.Write(csvHeader)
+}
+
+// csvCell keeps spreadsheets from evaluating a cell as a formula, by
+// prefixing text that starts like one with a quote.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+
+	return value
+}
+
+func (e *csvEncoder) Encode(recipe *models.Recipe) error {
+	source := ""
+	if recipe.Source != nil {
+		source = recipe.Source.URL
+	}
+
+	record := []string{
+		recipe.ID.Hex(),
+		recipe.Name,
+		strings.Join(recipe.Tags, "\n"),
+		strings.Join(recipe.Ingredients, "\n"),
+		strings.Join(recipe.Instructions, "\n"),
+		strconv.Itoa(recipe.Servings),
+		recipe.PublishedAt.UTC().Format(time.RFC3339),
+		recipe.AuthorID,
+		strconv.Itoa(recipe.PrepTime),
+		strconv.Itoa(recipe.CookTime),
+		strconv.Itoa(recipe.TotalTime),
+		strconv.FormatFloat(recipe.RatingAverage, 'f', -1, 64),
+		strconv.Itoa(recipe.RatingCount),
+		strings.Join(recipe.Diets, "\n"),
+		strings.Join(recipe.Allergens, "\n"),
+		source,
+	}
+	for i, cell := range record {
+		record[i] = csvCell(cell)
+	}
+
+	return e.w.Write(record)
+}
+
+func (e *csvEncoder) End() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// markdownEncoder writes each recipe as a section with its ingredients as
+// a bullet list and its instructions as a numbered list.
+type markdownEncoder struct {
+	w io.Writer
+}
+
+func newMarkdownEncoder(w io.Writer) Encoder {
+	return &markdownEncoder{w: w}
+}
+
+func (e *markdownEncoder) Begin() error { return nil }
+
+func (e *markdownEncoder) Encode(recipe *models.Recipe) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s\n\n", strings.TrimSpace(recipe.Name))
+
+	var details []string
+	if len(recipe.Tags) > 0 {
+		details = append(details, "Tags: "+strings.Join(recipe.Tags, ", "))
+	}
+	if recipe.Servings > 0 {
+		details = append(details, fmt.Sprintf("Servings: %d", recipe.Servings))
+	}
+	if recipe.TotalTime > 0 {
+		details = append(details, fmt.Sprintf("Total time: %d min", recipe.TotalTime))
+	}
+	if recipe.Source != nil && recipe.Source.URL != "" {
+		details = append(details, "Source: <"+recipe.Source.URL+">")
+	}
+	if len(details) > 0 {
+		b.WriteString("_" + strings.Join(details, " · ") + "_\n\n")
+	}
+
+	b.WriteString("## Ingredients\n\n")
+	for _, ingredient := range recipe.Ingredients {
+		if ingredient = strings.TrimSpace(ingredient); ingredient != "" {
+			b.WriteString("- " + ingredient + "\n")
+		}
+	}
+
+	b.WriteString("\n## Instructions\n\n")
+	if len(recipe.Steps) > 0 {
+		for _, step := range recipe.Steps {
+			fmt.Fprintf(&b, "%d. %s\n", step.Number, step.Text)
+		}
+	} else {
+		n := 0
+		for _, instruction := range recipe.Instructions {
+			if instruction = strings.Join(strings.Fields(instruction), " "); instruction != "" {
+				n++
+				fmt.Fprintf(&b, "%d. %s\n", n, instruction)
+			}
+		}
+	}
+
+	b.WriteString("\n---\n\n")
+
+	_, err := io.WriteString(e.w, b.String())
+
+	return err
+}
+
+func (e *markdownEncoder) End() error { return nil }
+
+// yamlEncoder writes a YAML sequence. Recipes are converted through their
+// JSON form so that keys match the other formats and keep their order.
+type yamlEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func newYAMLEncoder(w io.Writer) Encoder {
+	return &yamlEncoder{w: w}
+}
+
+func (e *yamlEncoder) Begin() error { return nil }
+
+// blockStyle drops the flow style of nodes parsed from JSON.
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+func (e *yamlEncoder) Encode(recipe *models.Recipe) error {
+	data, err := json.Marshal(recipe)
+	if err != nil {
+		return err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	blockStyle(&doc)
+
+	sequence := yaml.Node{Kind: yaml.SequenceNode, Content: doc.Content}
+
+	// A new encoder per recipe, as one would separate them as documents
+	enc := yaml.NewEncoder(e.w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&sequence); err != nil {
+		return err
+	}
+	e.count++
+
+	return enc.Close()
+}
+
+func (e *yamlEncoder) End() error {
+	if e.count == 0 {
+		_, err := io.WriteString(e.w, "[]\n")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/yaml.v3"
+
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+var recipes = []models.Recipe{
+	{
+		ID:           primitive.NewObjectID(),
+		Name:         "Lemonade",
+		Tags:         []string{"drinks", "quick"},
+		Ingredients:  []string{"4 lemons", "1/2 cup sugar"},
+		Instructions: []string{"Squeeze the lemons", " Stir in the sugar, \"to taste\""},
+		Servings:     4,
+		PublishedAt:  time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC),
+	},
+	{
+		ID:          primitive.NewObjectID(),
+		Name:        "Toast: a classic",
+		Ingredients: []string{"bread"},
+		Steps:       []models.Step{{Number: 1, Text: "Toast the bread."}},
+		Source:      &models.RecipeSource{URL: "https://example.com/toast"},
+	},
+}
+
+func encode(t *testing.T, format string, recipes []models.Recipe) string {
+	var buf bytes.Buffer
+
+	enc := Formats[format].NewEncoder(&buf)
+	if err := enc.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	for i := range recipes {
+		if err := enc.Encode(&recipes[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.End(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.String()
+}
+
+func TestFormats(t *testing.T) {
+	for _, name := range FormatNames {
+		if _, ok := Formats[name]; !ok {
+			t.Errorf("format %s is listed but not defined", name)
+		}
+	}
+
+	if len(FormatNames) != len(Formats) {
+		t.Errorf("FormatNames lists %d formats, %d are defined", len(FormatNames), len(Formats))
+	}
+}
+
+func TestJSON(t *testing.T) {
+	for _, n := range []int{0, 2} {
+		var got []models.Recipe
+		if err := json.Unmarshal([]byte(encode(t, "json", recipes[:n])), &got); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(got) != n || (n > 0 && got[1].Name != recipes[1].Name) {
+			t.Errorf("decoded %d recipes, want %d", len(got), n)
+		}
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(encode(t, "ndjson", recipes)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+
+	var got models.Recipe
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil || got.ID != recipes[0].ID {
+		t.Errorf("first line decodes to %v, %v", got.ID, err)
+	}
+}
+
+func TestCSV(t *testing.T) {
+	records, err := csv.NewReader(strings.NewReader(encode(t, "csv", recipes))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 3 || !reflect.DeepEqual(records[0], csvHeader) {
+		t.Fatalf("got %d records with header %q", len(records), records[0])
+	}
+
+	if got, want := records[1][4], "Squeeze the lemons\n Stir in the sugar, \"to taste\""; got != want {
+		t.Errorf("instructions = %q, want %q", got, want)
+	}
+
+	if got := records[2][len(csvHeader)-1]; got != "https://example.com/toast" {
+		t.Errorf("source = %q", got)
+	}
+}
+
+func TestCSVFormulas(t *testing.T) {
+	recipe := models.Recipe{
+		ID:          primitive.NewObjectID(),
+		Name:        "=HYPERLINK(\"https://example.com\")",
+		Tags:        []string{"+1", "quick"},
+		Ingredients: []string{"-2 eggs"},
+		AuthorID:    "@user",
+	}
+
+	records, err := csv.NewReader(strings.NewReader(encode(t, "csv", []models.Recipe{recipe}))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range map[int]string{
+		1: "'=HYPERLINK(\"https://example.com\")",
+		2: "'+1\nquick",
+		3: "'-2 eggs",
+		7: "'@user",
+	} {
+		if got := records[1][i]; got != want {
+			t.Errorf("%s = %q, want %q", csvHeader[i], got, want)
+		}
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	got := encode(t, "markdown", recipes)
+
+	for _, want := range []string{
+		"# Lemonade\n\n_Tags: drinks, quick · Servings: 4_\n\n## Ingredients\n\n- 4 lemons\n- 1/2 cup sugar\n",
+		"## Instructions\n\n1. Squeeze the lemons\n2. Stir in the sugar, \"to taste\"\n\n---\n",
+		"# Toast: a classic\n\n_Source: <https://example.com/toast>_\n",
+		"1. Toast the bread.\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("markdown does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestYAML(t *testing.T) {
+	out := encode(t, "yaml", recipes)
+
+	var got []map[string]any
+	if err := yaml.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 2 || got[0]["name"] != "Lemonade" || got[1]["name"] != "Toast: a classic" {
+		t.Errorf("decoded %v", got)
+	}
+
+	if !strings.HasPrefix(out, "- id: ") || strings.Contains(out, "{") {
+		t.Errorf("YAML is not in block style:\n%s", out)
+	}
+
+	var empty []map[string]any
+	if err := yaml.Unmarshal([]byte(encode(t, "yaml", nil)), &empty); err != nil || len(empty) != 0 {
+		t.Errorf("empty export decodes to %v, %v", empty, err)
+	}
+}
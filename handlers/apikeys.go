@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+const (
+	ScopeRecipesRead  = "recipes:read"
+	ScopeRecipesWrite = "recipes:write"
+
+	apiKeyPrefix    = "rak_"
+	apiKeyPrefixLen = 8
+	// apiKeyAttempts bounds the retries when a prefix is already taken
+	apiKeyAttempts = 3
+)
+
+var apiKeyScopes = map[string]bool{
+	ScopeRecipesRead:  true,
+	ScopeRecipesWrite: true,
+}
+
+// generateAPIKey returns a new key in the form rak_<prefix>_<secret>.
+func generateAPIKey() (key string, prefix string, err error) {
+	buf := make([]byte, apiKeyPrefixLen/2)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	prefix = hex.EncodeToString(buf)
+
+	secret, err := generateToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	return apiKeyPrefix + prefix + "_" + secret, prefix, nil
+}
+
+func parseAPIKey(key string) (prefix string, ok bool) {
+	rest, found := strings.CutPrefix(key, apiKeyPrefix)
+	if !found || len(rest) < apiKeyPrefixLen+2 || rest[apiKeyPrefixLen] != '_' {
+		return "", false
+	}
+
+	return rest[:apiKeyPrefixLen], true
+}
+
+func (a *AuthHandler) authenticateAPIKey(key string) (*models.APIKey, error) {
+	prefix, ok := parseAPIKey(key)
+	if !ok {
+		return nil, errInvalidToken
+	}
+
+	var apiKey models.APIKey
+	if err := a.apiKeysCollection.FindOne(a.ctx, bson.M{"prefix": prefix}).Decode(&apiKey); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errInvalidToken
+		}
+
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(apiKey.Hash), []byte(hashToken(key))) != 1 {
+		return nil, errInvalidToken
+	}
+
+	now := time.Now()
+	if apiKey.RevokedAt != nil || (apiKey.ExpiresAt != nil && apiKey.ExpiresAt.Before(now)) {
+		return nil, errInvalidToken
+	}
+
+	if _, err := a.apiKeysCollection.UpdateOne(a.ctx, bson.M{"_id": apiKey.ID}, bson.M{
+		"$set": bson.M{"lastUsedAt": now},
+	}); err != nil {
+		return nil, err
+	}
+	apiKey.LastUsedAt = &now
+
+	return &apiKey, nil
+}
+
+func (a *AuthHandler) apiKeyAuth(c *gin.Context, key string) {
+	apiKey, err := a.authenticateAPIKey(key)
+	if errors.Is(err, errInvalidToken) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "invalid, expired or revoked API key",
+		})
+
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	c.Set(userIDKey, apiKey.UserID)
+	c.Set(apiKeyIDKey, apiKey.ID.Hex())
+	c.Set(apiKeyScopesKey, apiKey.Scopes)
+	c.Next()
+}
+
+// RequireScope rejects API key callers whose key has not been granted scope.
+// Users authenticated interactively are not restricted by scopes.
+func (a *AuthHandler) RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes, ok := c.Get(apiKeyScopesKey)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		for _, s := range scopes.([]string) {
+			if s == scope {
+				c.Next()
+				return
+			}
+		}
+
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": fmt.Sprintf("API key is missing the %q scope", scope),
+		})
+	}
+}
+
+// RejectAPIKey rejects API key callers on routes that no scope grants,
+// which are reserved to users authenticated interactively.
+func (a *AuthHandler) RejectAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get(apiKeyIDKey); ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "API keys are limited to the routes granted by their scopes",
+			})
+
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func (a *AuthHandler) NewAPIKeyHandler(c *gin.Context) {
+	// swagger:operation POST /apikeys apiKeys newAPIKey
+	//
+	// Create new API key. The key itself is returned only once
+	//
+	// ---
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+	//  '403':
+	//   description: Called with an API key
+
+	var body struct {
+		Name      string     `json:"name" binding:"required"`
+		Scopes    []string   `json:"scopes" binding:"required"`
+		ExpiresAt *time.Time `json:"expiresAt"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	for _, scope := range body.Scopes {
+		if !apiKeyScopes[scope] {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Unknown scope %q", scope),
+			})
+
+			return
+		}
+	}
+
+	if body.ExpiresAt != nil && body.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Expiry must be in the future",
+		})
+
+		return
+	}
+
+	apiKey := models.APIKey{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID(c),
+		Name:      body.Name,
+		Scopes:    body.Scopes,
+		CreatedAt: time.Now(),
+		ExpiresAt: body.ExpiresAt,
+	}
+
+	// Prefixes are short enough to collide now and then, in which case
+	// another key is generated
+	var key string
+	for attempt := 1; ; attempt++ {
+		var err error
+		if key, apiKey.Prefix, err = generateAPIKey(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+
+			return
+		}
+		apiKey.Hash = hashToken(key)
+
+		_, err = a.apiKeysCollection.InsertOne(a.ctx, apiKey)
+		if err == nil {
+			break
+		}
+
+		if !mongo.IsDuplicateKeyError(err) || attempt == apiKeyAttempts {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error while inserting API key",
+			})
+
+			return
+		}
+	}
+
+	a.auditHandler.Record(c, models.AuditEntry{
+		Action: models.AuditAPIKeyCreate,
+		Target: apiKey.ID.Hex(),
+	}, nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"key":    key,
+		"apiKey": apiKey,
+	})
+}
+
+func (a *AuthHandler) ListAPIKeysHandler(c *gin.Context) {
+	// swagger:operation GET /apikeys apiKeys listAPIKeys
+	//
+	// Returns API keys of the authenticated user
+	//
+	// ---
+	// produces:
+	// - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	cur, err := a.apiKeysCollection.Find(a.ctx, bson.M{"userId": userID(c)}, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	apiKeys := make([]models.APIKey, 0)
+	if err := cur.All(a.ctx, &apiKeys); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, apiKeys)
+}
+
+func (a *AuthHandler) DeleteAPIKeyHandler(c *gin.Context) {
+	// swagger:operation DELETE /apikeys/{id} apiKeys deleteAPIKey
+	//
+	// Revoke an API key
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the API key
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Invalid API key ID
+
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	res, err := a.apiKeysCollection.UpdateOne(a.ctx, bson.M{
+		"_id":       objectID,
+		"userId":    userID(c),
+		"revokedAt": bson.M{"$exists": false},
+	}, bson.M{
+		"$set": bson.M{"revokedAt": time.Now()},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if res.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "API key not found",
+		})
+
+		return
+	}
+
+	a.auditHandler.Record(c, models.AuditEntry{
+		Action: models.AuditAPIKeyRevoke,
+		Target: objectID.Hex(),
+	}, nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "API key has been revoked",
+	})
+}
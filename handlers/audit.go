@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// AuditHandler keeps an append-only log of mutating operations. A nil
+// *AuditHandler is valid and records nothing.
+type AuditHandler struct {
+	ctx        context.Context
+	collection *mongo.Collection
+}
+
+func NewAuditHandler(ctx context.Context, collection *mongo.Collection) *AuditHandler {
+	return &AuditHandler{ctx: ctx, collection: collection}
+}
+
+func (h *AuditHandler) CreateIndexes() error {
+	_, err := h.collection.Indexes().CreateMany(h.ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "actor", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "recipeId", Value: 1}, {Key: "timestamp", Value: -1}}},
+	})
+
+	return err
+}
+
+func auditHash(document any) string {
+	if document == nil {
+		return ""
+	}
+
+	data, err := json.Marshal(document)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Record appends entry to the audit log, filling in the request metadata and
+// the hashes of the document before and after the change. Failures are logged
+// rather than reported, as the operation itself has already happened.
+func (h *AuditHandler) Record(c *gin.Context, entry models.AuditEntry, before any, after any) {
+	if h == nil {
+		return
+	}
+
+	if _, err := h.collection.InsertOne(h.ctx, fillAuditEntry(c, entry, before, after)); err != nil {
+		log.Println("Error while recording audit entry:", err)
+	}
+}
+
+// RecordMany appends the entries of a bulk operation at once. afters holds
+// the document after the change of each entry; there is no document before.
+func (h *AuditHandler) RecordMany(c *gin.Context, entries []models.AuditEntry, afters []any) {
+	if h == nil || len(entries) == 0 {
+		return
+	}
+
+	documents := make([]any, len(entries))
+	for i, entry := range entries {
+		documents[i] = fillAuditEntry(c, entry, nil, afters[i])
+	}
+
+	if _, err := h.collection.InsertMany(h.ctx, documents); err != nil {
+		log.Println("Error while recording audit entries:", err)
+	}
+}
+
+func fillAuditEntry(c *gin.Context, entry models.AuditEntry, before any, after any) models.AuditEntry {
+	entry.ID = primitive.NewObjectID()
+	if entry.Actor == "" {
+		entry.Actor = userID(c)
+	}
+	entry.BeforeHash = auditHash(before)
+	entry.AfterHash = auditHash(after)
+	entry.IP = c.ClientIP()
+	entry.RequestID = c.GetString(requestIDKey)
+	entry.Timestamp = time.Now()
+
+	return entry
+}
+
+// pagination reads the page and limit query parameters.
+func pagination(c *gin.Context) (page int64, limit int64) {
+	page, err := strconv.ParseInt(c.Query("page"), 10, 64)
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err = strconv.ParseInt(c.Query("limit"), 10, 64)
+	if err != nil || limit < 1 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	return page, limit
+}
+
+func (h *AuditHandler) ListAuditHandler(c *gin.Context) {
+	// swagger:operation GET /admin/audit audit listAudit
+	//
+	// Returns audit log entries, most recent first
+	//
+	// ---
+	// parameters:
+	//   - name: actor
+	//     in: query
+	//     description: ID of the user who performed the action
+	//     type: string
+	//   - name: action
+	//     in: query
+	//     description: action, e.g. recipe.update
+	//     type: string
+	//   - name: recipeId
+	//     in: query
+	//     description: ID of the affected recipe
+	//     type: string
+	//   - name: from
+	//     in: query
+	//     description: RFC 3339 timestamp of the earliest entry
+	//     type: string
+	//   - name: to
+	//     in: query
+	//     description: RFC 3339 timestamp of the latest entry
+	//     type: string
+	//   - name: page
+	//     in: query
+	//     type: integer
+	//   - name: limit
+	//     in: query
+	//     type: integer
+	// produces:
+	// - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid filter
+	//  '403':
+	//   description: Not a moderator
+
+	filter := bson.M{}
+	for _, field := range []string{"actor", "action", "target"} {
+		if value := c.Query(field); value != "" {
+			filter[field] = value
+		}
+	}
+
+	if id := c.Query("recipeId"); id != "" {
+		objectID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+
+			return
+		}
+
+		filter["recipeId"] = objectID
+	}
+
+	timestamp := bson.M{}
+	for param, operator := range map[string]string{"from": "$gte", "to": "$lte"} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+
+			return
+		}
+
+		timestamp[operator] = t
+	}
+	if len(timestamp) > 0 {
+		filter["timestamp"] = timestamp
+	}
+
+	page, limit := pagination(c)
+
+	total, err := h.collection.CountDocuments(h.ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}}).
+		SetSkip((page - 1) * limit).
+		SetLimit(limit)
+
+	cur, err := h.collection.Find(h.ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	entries := make([]models.AuditEntry, 0, limit)
+	if err := cur.All(h.ctx, &entries); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"page":    page,
+		"limit":   limit,
+		"total":   total,
+	})
+}
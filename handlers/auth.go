@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
@@ -12,16 +15,67 @@ import (
 	"github.com/auth0/go-jwt-middleware/v2/validator"
 	"github.com/gin-gonic/gin"
 	adapter "github.com/gwatts/gin-adapter"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+const (
+	userIDKey       = "userID"
+	sessionIDKey    = "sessionID"
+	apiKeyIDKey     = "apiKeyID"
+	apiKeyScopesKey = "apiKeyScopes"
 )
 
 type AuthHandler struct {
-	ctx        context.Context
-	collection *mongo.Collection
+	ctx               context.Context
+	collection        *mongo.Collection
+	apiKeysCollection *mongo.Collection
+	redisClient       *redis.Client
+	auditHandler      *AuditHandler
+}
+
+func NewAuthHandler(ctx context.Context, collection *mongo.Collection, apiKeysCollection *mongo.Collection, redisClient *redis.Client, auditHandler *AuditHandler) *AuthHandler {
+	return &AuthHandler{ctx: ctx, collection: collection, apiKeysCollection: apiKeysCollection, redisClient: redisClient, auditHandler: auditHandler}
+}
+
+func (a *AuthHandler) CreateIndexes() error {
+	_, err := a.apiKeysCollection.Indexes().CreateMany(a.ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "prefix", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userId", Value: 1}}},
+	})
+
+	return err
+}
+
+// CustomClaims are the profile claims Auth0 adds to access tokens. They are
+// used to seed the user profile on first sign in.
+type CustomClaims struct {
+	Name     string `json:"name"`
+	Nickname string `json:"nickname"`
+	Picture  string `json:"picture"`
 }
 
-func NewAuthHandler(ctx context.Context, collection *mongo.Collection) *AuthHandler {
-	return &AuthHandler{ctx: ctx, collection: collection}
+func (c *CustomClaims) Validate(context.Context) error {
+	return nil
+}
+
+// userID returns the subject of the authenticated caller, whichever way it
+// has authenticated.
+func userID(c *gin.Context) string {
+	if id := c.GetString(userIDKey); id != "" {
+		return id
+	}
+
+	claims, ok := c.Request.Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		return ""
+	}
+
+	return claims.RegisteredClaims.Subject
 }
 
 func (a *AuthHandler) AuthMiddleware() (gin.HandlerFunc, error) {
@@ -37,11 +91,125 @@ func (a *AuthHandler) AuthMiddleware() (gin.HandlerFunc, error) {
 		validator.RS256,
 		issuerURL.String(),
 		[]string{os.Getenv("AUTH0_AUDIENCE")},
+		validator.WithCustomClaims(func() validator.CustomClaims {
+			return &CustomClaims{}
+		}),
 	)
 	if err != nil {
 		return nil, err
 	}
 
 	middleware := jwtmiddleware.New(jwtValidator.ValidateToken)
-	return adapter.Wrap(middleware.CheckJWT), nil
+	jwtHandler := adapter.Wrap(middleware.CheckJWT)
+
+	return func(c *gin.Context) {
+		scheme, credentials, _ := strings.Cut(c.GetHeader("Authorization"), " ")
+
+		switch strings.ToLower(scheme) {
+		case "session":
+			a.sessionAuth(c, credentials)
+		case "apikey":
+			a.apiKeyAuth(c, credentials)
+		default:
+			jwtHandler(c)
+		}
+	}, nil
+}
+
+// OptionalAuth runs auth on requests that carry credentials and lets
+// anonymous ones through, so that public routes can still show authors
+// their own drafts.
+func OptionalAuth(auth gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.Next()
+			return
+		}
+
+		auth(c)
+	}
+}
+
+func (a *AuthHandler) sessionAuth(c *gin.Context, accessToken string) {
+	session, err := a.authenticateSession(accessToken)
+	if errors.Is(err, errInvalidToken) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	c.Set(userIDKey, session.UserID)
+	c.Set(sessionIDKey, session.ID)
+	c.Next()
+}
+
+// ProvisionUser creates a profile for the authenticated user on their first
+// request, seeded from the token claims when present.
+func (a *AuthHandler) ProvisionUser(c *gin.Context) {
+	uid := userID(c)
+
+	var displayName, avatarURL string
+	if claims, ok := c.Request.Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims); ok {
+		if customClaims, ok := claims.CustomClaims.(*CustomClaims); ok {
+			displayName = customClaims.Name
+			if displayName == "" {
+				displayName = customClaims.Nickname
+			}
+			avatarURL = customClaims.Picture
+		}
+	}
+
+	now := time.Now()
+	if _, err := a.collection.UpdateOne(a.ctx, bson.M{"_id": uid}, bson.M{
+		"$setOnInsert": bson.M{
+			"displayName":        displayName,
+			"avatarUrl":          avatarURL,
+			"bio":                "",
+			"dietaryPreferences": []string{},
+			"preferredUnits":     models.UnitsMetric,
+			"createdAt":          now,
+			"updatedAt":          now,
+		},
+	}, options.Update().SetUpsert(true)); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "Error while provisioning user",
+		})
+
+		return
+	}
+
+	c.Next()
+}
+
+// RequireRole only lets through users that have been granted role.
+func (a *AuthHandler) RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		count, err := a.collection.CountDocuments(a.ctx, bson.M{"_id": userID(c), "roles": role})
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+
+			return
+		}
+
+		if count == 0 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": fmt.Sprintf("Only users with the %q role can do this", role),
+			})
+
+			return
+		}
+
+		c.Next()
+	}
 }
@@ -0,0 +1,475 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/harmlessevil/recipes-api/derive"
+	"github.com/harmlessevil/recipes-api/models"
+	"github.com/harmlessevil/recipes-api/recipefile"
+)
+
+const (
+	// maxBulkItems matches the recipes read from a file, which are
+	// imported alike
+	maxBulkItems = recipefile.MaxRecipes
+	maxBulkSize  = 32 << 20
+	// maxBulkLine bounds a single NDJSON line
+	maxBulkLine = 1 << 20
+
+	duplicateKeyCode = 11000
+)
+
+var errTooManyBulkItems = fmt.Errorf("at most %d recipes can be imported at once", maxBulkItems)
+
+// readBulkItems splits a body holding either a JSON array or NDJSON into
+// its items. Malformed NDJSON lines are returned as they are, to be
+// reported as invalid, while a malformed array fails as a whole.
+func readBulkItems(body io.Reader) ([]json.RawMessage, error) {
+	reader := bufio.NewReader(body)
+
+	for {
+		b, err := reader.ReadByte()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if !strings.ContainsRune(" \t\r\n", rune(b)) {
+			_ = reader.UnreadByte()
+
+			if b == '[' {
+				return readJSONArray(reader)
+			}
+
+			return readNDJSON(reader)
+		}
+	}
+}
+
+func readJSONArray(reader io.Reader) ([]json.RawMessage, error) {
+	dec := json.NewDecoder(reader)
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	var items []json.RawMessage
+	for dec.More() {
+		var item json.RawMessage
+		if err := dec.Decode(&item); err != nil {
+			return nil, err
+		}
+
+		if items = append(items, item); len(items) > maxBulkItems {
+			return nil, errTooManyBulkItems
+		}
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func readNDJSON(reader io.Reader) ([]json.RawMessage, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxBulkLine)
+
+	var items []json.RawMessage
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		if items = append(items, append(json.RawMessage(nil), line...)); len(items) > maxBulkItems {
+			return nil, errTooManyBulkItems
+		}
+	}
+
+	return items, scanner.Err()
+}
+
+func validateBulkRecipe(recipe *models.Recipe, upsert bool) error {
+	recipe.Name = strings.TrimSpace(recipe.Name)
+	recipe.ExternalID = strings.TrimSpace(recipe.ExternalID)
+
+	switch {
+	case recipe.Name == "":
+		return errors.New("name is required")
+	case len(recipe.Ingredients) == 0:
+		return errors.New("at least one ingredient is required")
+	case len(recipe.Instructions) == 0:
+		return errors.New("at least one instruction is required")
+	case recipe.Servings < 0:
+		return errors.New("servings must not be negative")
+	case upsert && recipe.ExternalID == "":
+		return errors.New("externalId is required to upsert")
+	}
+
+	return nil
+}
+
+// admitBulkRecipe validates a recipe of a bulk import, reporting it as
+// invalid or as a duplicate of an earlier one of the same request.
+func admitBulkRecipe(recipe *models.Recipe, upsert bool, seen map[string]int, result *models.BulkResult) bool {
+	err := validateBulkRecipe(recipe, upsert)
+	result.ExternalID = recipe.ExternalID
+	if err != nil {
+		result.Status = models.BulkInvalid
+		result.Error = err.Error()
+
+		return false
+	}
+
+	if recipe.ExternalID != "" {
+		if first, ok := seen[recipe.ExternalID]; ok {
+			result.Status = models.BulkDuplicate
+			result.Error = fmt.Sprintf("same externalId as recipe %d", first)
+
+			return false
+		}
+		seen[recipe.ExternalID] = result.Index
+	}
+
+	return true
+}
+
+func countBulkResults(report *models.BulkReport) {
+	for _, result := range report.Results {
+		switch result.Status {
+		case models.BulkCreated:
+			report.Created++
+		case models.BulkUpdated:
+			report.Updated++
+		case models.BulkDuplicate:
+			report.Duplicate++
+		case models.BulkInvalid:
+			report.Invalid++
+		case models.BulkFailed:
+			report.Failed++
+		}
+	}
+}
+
+// writeErrors indexes the errors of an unordered bulk write by the
+// position of the failed operation.
+func writeErrors(err error) (map[int]mongo.WriteError, error) {
+	failed := make(map[int]mongo.WriteError)
+	if err == nil {
+		return failed, nil
+	}
+
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) {
+		return nil, err
+	}
+
+	if bulkErr.WriteConcernError != nil {
+		log.Println(bulkErr.WriteConcernError)
+	}
+
+	for _, writeErr := range bulkErr.WriteErrors {
+		failed[writeErr.Index] = writeErr.WriteError
+	}
+
+	return failed, nil
+}
+
+func failedResult(result *models.BulkResult, writeErr mongo.WriteError) {
+	if writeErr.Code == duplicateKeyCode {
+		result.Status = models.BulkDuplicate
+		result.Error = "a recipe with this externalId already exists"
+
+		return
+	}
+
+	result.Status = models.BulkFailed
+	result.Error = writeErr.Message
+}
+
+// insertRecipes inserts the valid recipes of a bulk import, positions
+// holding their index in the request.
+func (h *RecipesHandler) insertRecipes(recipes []models.Recipe, positions []int, report *models.BulkReport) error {
+	documents := make([]any, len(recipes))
+	for i := range recipes {
+		documents[i] = recipes[i]
+	}
+
+	_, err := h.collection.InsertMany(h.ctx, documents, options.InsertMany().SetOrdered(false))
+	failed, err := writeErrors(err)
+	if err != nil {
+		return err
+	}
+
+	for i, recipe := range recipes {
+		result := &report.Results[positions[i]]
+		if writeErr, ok := failed[i]; ok {
+			failedResult(result, writeErr)
+			continue
+		}
+
+		result.Status = models.BulkCreated
+		result.ID = recipe.ID.Hex()
+	}
+
+	return nil
+}
+
+// upsertRecipes creates or replaces the content of recipes by their
+// external ID, keeping the ratings, comments, images and label overrides
+// of existing ones.
+func (h *RecipesHandler) upsertRecipes(authorID string, recipes []models.Recipe, positions []int, report *models.BulkReport) error {
+	externalIDs := make([]string, len(recipes))
+	for i, recipe := range recipes {
+		externalIDs[i] = recipe.ExternalID
+	}
+
+	cur, err := h.collection.Find(h.ctx, bson.M{
+		"authorId":   authorID,
+		"externalId": bson.M{"$in": externalIDs},
+	}, options.Find().SetProjection(bson.M{"externalId": 1, "labelOverrides": 1}))
+	if err != nil {
+		return err
+	}
+
+	var existing []models.Recipe
+	if err := cur.All(h.ctx, &existing); err != nil {
+		return err
+	}
+
+	byExternalID := make(map[string]models.Recipe, len(existing))
+	for _, recipe := range existing {
+		byExternalID[recipe.ExternalID] = recipe
+	}
+
+	writes := make([]mongo.WriteModel, len(recipes))
+	for i := range recipes {
+		recipe := &recipes[i]
+		if old, ok := byExternalID[recipe.ExternalID]; ok {
+			recipe.ID = old.ID
+			recipe.LabelOverrides = old.LabelOverrides
+			derive.Labels(recipe)
+		}
+
+		writes[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"authorId": authorID, "externalId": recipe.ExternalID}).
+			SetUpdate(bson.M{
+				"$set": bson.M{
+					"name":         recipe.Name,
+					"tags":         recipe.Tags,
+					"ingredients":  recipe.Ingredients,
+					"instructions": recipe.Instructions,
+					"servings":     recipe.Servings,
+					"source":       recipe.Source,
+					"diets":        recipe.Diets,
+					"allergens":    recipe.Allergens,
+					"steps":        recipe.Steps,
+					"prepTime":     recipe.PrepTime,
+					"cookTime":     recipe.CookTime,
+					"totalTime":    recipe.TotalTime,
+					"fingerprint":  recipe.Fingerprint,
+				},
+				"$setOnInsert": bson.M{
+					"_id":           recipe.ID,
+					"publishedAt":   recipe.PublishedAt,
+					"ratingAverage": 0,
+					"ratingCount":   0,
+					"ratingSum":     0,
+					"commentCount":  0,
+					"favoriteCount": 0,
+					"images":        recipe.Images,
+				},
+			}).
+			SetUpsert(true)
+	}
+
+	res, err := h.collection.BulkWrite(h.ctx, writes, options.BulkWrite().SetOrdered(false))
+	failed, err := writeErrors(err)
+	if err != nil {
+		return err
+	}
+
+	for i, recipe := range recipes {
+		result := &report.Results[positions[i]]
+		if writeErr, ok := failed[i]; ok {
+			failedResult(result, writeErr)
+			continue
+		}
+
+		result.ID = recipe.ID.Hex()
+		result.Status = models.BulkUpdated
+		if res != nil {
+			if id, ok := res.UpsertedIDs[int64(i)].(primitive.ObjectID); ok {
+				result.Status = models.BulkCreated
+				result.ID = id.Hex()
+			}
+		}
+
+		if result.Status == models.BulkUpdated {
+			if err := h.redisClient.Del(h.ctx, nutritionKey(recipe.ID)).Err(); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// finishBulk counts the results of a bulk import and records the created
+// and updated recipes, created ones with the given audit action.
+func (h *RecipesHandler) finishBulk(c *gin.Context, report *models.BulkReport, recipes []models.Recipe, positions []int, createAction string) {
+	countBulkResults(report)
+
+	var entries []models.AuditEntry
+	var afters []any
+	for i, position := range positions {
+		var action string
+		switch report.Results[position].Status {
+		case models.BulkCreated:
+			action = createAction
+		case models.BulkUpdated:
+			action = models.AuditRecipeUpdate
+		default:
+			continue
+		}
+
+		entries = append(entries, models.AuditEntry{Action: action, RecipeID: &recipes[i].ID})
+		afters = append(afters, recipes[i])
+	}
+	h.auditHandler.RecordMany(c, entries, afters)
+
+	if report.Created+report.Updated > 0 {
+		if err := h.redisClient.Del(h.ctx, "recipes").Err(); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+func (h *RecipesHandler) BulkRecipesHandler(c *gin.Context) {
+	// swagger:operation POST /recipes/bulk recipes bulkRecipes
+	//
+	// Import up to 1000 recipes at once, given as a JSON array or as NDJSON
+	// with one recipe per line. Each recipe is validated and inserted on its
+	// own, and the report lists for each whether it was created, updated,
+	// a duplicate or invalid. In upsert mode recipes are matched by their
+	// externalId, so that importing the same data again updates them
+	//
+	// ---
+	// consumes:
+	//   - application/json
+	//   - application/x-ndjson
+	// parameters:
+	//   - name: mode
+	//     in: query
+	//     description: insert (default) or upsert
+	//     required: false
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+	//  '413':
+	//   description: Request too large
+
+	mode := c.DefaultQuery("mode", "insert")
+	if mode != "insert" && mode != "upsert" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "mode must be insert or upsert",
+		})
+
+		return
+	}
+	upsert := mode == "upsert"
+
+	items, err := readBulkItems(http.MaxBytesReader(c.Writer, c.Request.Body, maxBulkSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": "request body too large",
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if len(items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "no recipes given",
+		})
+
+		return
+	}
+
+	uid := userID(c)
+	report := models.BulkReport{Results: make([]models.BulkResult, len(items))}
+
+	var recipes []models.Recipe
+	var positions []int
+	seen := make(map[string]int)
+	for i, item := range items {
+		result := &report.Results[i]
+		result.Index = i
+
+		var recipe models.Recipe
+		if err := json.Unmarshal(item, &recipe); err != nil {
+			result.Status = models.BulkInvalid
+			result.Error = err.Error()
+
+			continue
+		}
+
+		if !admitBulkRecipe(&recipe, upsert, seen, result) {
+			continue
+		}
+
+		prepareRecipe(&recipe, uid)
+		recipes = append(recipes, recipe)
+		positions = append(positions, i)
+	}
+
+	if len(recipes) > 0 {
+		if upsert {
+			err = h.upsertRecipes(uid, recipes, positions, &report)
+		} else {
+			err = h.insertRecipes(recipes, positions, &report)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error while importing recipes",
+			})
+
+			return
+		}
+	}
+
+	h.finishBulk(c, &report, recipes, positions, models.AuditRecipeCreate)
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,781 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+// commentEditWindow is how long after posting a comment its author can edit it.
+const commentEditWindow = 15 * time.Minute
+
+type CommentsHandler struct {
+	ctx               context.Context
+	collection        *mongo.Collection
+	recipesCollection *mongo.Collection
+	redisClient       *redis.Client
+	auditHandler      *AuditHandler
+}
+
+func NewCommentsHandler(ctx context.Context, collection *mongo.Collection, recipesCollection *mongo.Collection, redisClient *redis.Client, auditHandler *AuditHandler) *CommentsHandler {
+	return &CommentsHandler{ctx: ctx, collection: collection, recipesCollection: recipesCollection, redisClient: redisClient, auditHandler: auditHandler}
+}
+
+func (h *CommentsHandler) CreateIndexes() error {
+	_, err := h.collection.Indexes().CreateMany(h.ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "recipeId", Value: 1}, {Key: "parentId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "threadId", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: 1}}},
+	})
+
+	return err
+}
+
+// updateCommentCount keeps the number of visible comments on the recipe in
+// sync. It is called on every transition in or out of the visible state.
+func (h *CommentsHandler) updateCommentCount(recipeID primitive.ObjectID, delta int) error {
+	if _, err := h.recipesCollection.UpdateOne(h.ctx, bson.M{"_id": recipeID}, bson.M{
+		"$inc": bson.M{"commentCount": delta},
+	}); err != nil {
+		return err
+	}
+
+	return h.redisClient.Del(h.ctx, "recipes").Err()
+}
+
+func (h *CommentsHandler) findComment(c *gin.Context, filter bson.M) (*models.Comment, bool) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return nil, false
+	}
+
+	filter["_id"] = objectID
+
+	var comment models.Comment
+	if err := h.collection.FindOne(h.ctx, filter).Decode(&comment); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Comment not found",
+			})
+
+			return nil, false
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return nil, false
+	}
+
+	return &comment, true
+}
+
+// updateComment applies update to the comment matching filter and returns
+// the comment as it was before, so that the comment count is adjusted by
+// the change the update made rather than by an earlier read.
+func (h *CommentsHandler) updateComment(filter bson.M, update bson.M) (*models.Comment, error) {
+	var before models.Comment
+	err := h.collection.FindOneAndUpdate(h.ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.Before)).Decode(&before)
+	if err != nil {
+		return nil, err
+	}
+
+	return &before, nil
+}
+
+// buildThread attaches replies to comment recursively. Deleted and hidden
+// comments are kept as redacted placeholders while they have visible replies,
+// so that the thread stays intact, and are dropped otherwise.
+func buildThread(comment models.Comment, children map[primitive.ObjectID][]models.Comment) (models.Comment, bool) {
+	comment.Flags = nil
+	comment.Replies = nil
+
+	for _, child := range children[comment.ID] {
+		if reply, ok := buildThread(child, children); ok {
+			comment.Replies = append(comment.Replies, reply)
+		}
+	}
+
+	if comment.Status == models.CommentVisible && comment.DeletedAt == nil {
+		return comment, true
+	}
+
+	if len(comment.Replies) == 0 {
+		return comment, false
+	}
+
+	comment.Text = ""
+	comment.AuthorID = ""
+
+	return comment, true
+}
+
+func (h *CommentsHandler) ListCommentsHandler(c *gin.Context) {
+	// swagger:operation GET /recipes/{id}/comments comments listComments
+	//
+	// Returns comment threads of a recipe, most recent first
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the recipe
+	//     required: true
+	//     type: string
+	//   - name: page
+	//     in: query
+	//     type: integer
+	//   - name: limit
+	//     in: query
+	//     type: integer
+	// produces:
+	// - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Invalid recipe ID
+
+	recipeID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	count, err := h.recipesCollection.CountDocuments(h.ctx, visible(bson.M{"_id": recipeID}, userID(c)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Recipe not found",
+		})
+
+		return
+	}
+
+	page, limit := pagination(c)
+
+	// Deleted and hidden threads are left out before paging, so that pages
+	// are full, unless a reply keeps them as placeholders, see buildThread
+	shown := bson.M{"status": models.CommentVisible, "deletedAt": bson.M{"$exists": false}}
+	cur, err := h.collection.Aggregate(h.ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"recipeId": recipeID,
+			"parentId": bson.M{"$exists": false},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "createdAt", Value: -1}}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from": h.collection.Name(),
+			"let":  bson.M{"threadId": "$_id"},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{
+					"$expr":     bson.M{"$eq": bson.A{"$threadId", "$$threadId"}},
+					"parentId":  bson.M{"$exists": true},
+					"status":    models.CommentVisible,
+					"deletedAt": bson.M{"$exists": false},
+				}},
+				bson.M{"$limit": 1},
+				bson.M{"$project": bson.M{"_id": 1}},
+			},
+			"as": "shownReplies",
+		}}},
+		{{Key: "$match", Value: bson.M{"$or": bson.A{
+			shown,
+			bson.M{"shownReplies.0": bson.M{"$exists": true}},
+		}}}},
+		{{Key: "$skip", Value: (page - 1) * limit}},
+		{{Key: "$limit", Value: limit}},
+		{{Key: "$project", Value: bson.M{"shownReplies": 0}}},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	var roots []models.Comment
+	if err := cur.All(h.ctx, &roots); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	threadIDs := make([]primitive.ObjectID, len(roots))
+	for i, root := range roots {
+		threadIDs[i] = root.ID
+	}
+
+	cur, err = h.collection.Find(h.ctx, bson.M{
+		"threadId": bson.M{"$in": threadIDs},
+		"parentId": bson.M{"$exists": true},
+	}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	var replies []models.Comment
+	if err := cur.All(h.ctx, &replies); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	children := make(map[primitive.ObjectID][]models.Comment)
+	for _, reply := range replies {
+		children[*reply.ParentID] = append(children[*reply.ParentID], reply)
+	}
+
+	comments := make([]models.Comment, 0, len(roots))
+	for _, root := range roots {
+		if comment, ok := buildThread(root, children); ok {
+			comments = append(comments, comment)
+		}
+	}
+
+	c.JSON(http.StatusOK, comments)
+}
+
+func (h *CommentsHandler) NewCommentHandler(c *gin.Context) {
+	// swagger:operation POST /recipes/{id}/comments comments newComment
+	//
+	// Comment on a recipe or reply to a comment
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the recipe
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+	//  '404':
+	//   description: Invalid recipe or parent comment ID
+
+	recipeID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	var comment models.Comment
+	if err := c.ShouldBindJSON(&comment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	count, err := h.recipesCollection.CountDocuments(h.ctx, visible(bson.M{"_id": recipeID}, userID(c)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Recipe not found",
+		})
+
+		return
+	}
+
+	comment.ID = primitive.NewObjectID()
+	comment.ThreadID = comment.ID
+
+	if comment.ParentID != nil {
+		var parent models.Comment
+		if err := h.collection.FindOne(h.ctx, bson.M{
+			"_id":      comment.ParentID,
+			"recipeId": recipeID,
+		}).Decode(&parent); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error": "Parent comment not found",
+				})
+
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+
+			return
+		}
+
+		comment.ThreadID = parent.ThreadID
+	}
+
+	comment.RecipeID = recipeID
+	comment.AuthorID = userID(c)
+	comment.Status = models.CommentVisible
+	comment.Flags = nil
+	comment.CreatedAt = time.Now()
+	comment.EditedAt = nil
+	comment.DeletedAt = nil
+	comment.Replies = nil
+
+	if _, err := h.collection.InsertOne(h.ctx, comment); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error while inserting comment",
+		})
+
+		return
+	}
+
+	if err := h.updateCommentCount(recipeID, 1); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error while updating comment count",
+		})
+
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action:   models.AuditCommentCreate,
+		RecipeID: &recipeID,
+		Target:   comment.ID.Hex(),
+	}, nil, comment)
+
+	c.JSON(http.StatusOK, comment)
+}
+
+func (h *CommentsHandler) UpdateCommentHandler(c *gin.Context) {
+	// swagger:operation PUT /comments/{id} comments updateComment
+	//
+	// Edit an own comment shortly after posting it
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the comment
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+	//  '403':
+	//   description: Edit window has passed
+	//  '404':
+	//   description: Invalid comment ID
+
+	var body struct {
+		Text string `json:"text" binding:"required,max=5000"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	before, ok := h.findComment(c, bson.M{
+		"authorId":  userID(c),
+		"deletedAt": bson.M{"$exists": false},
+		"status":    bson.M{"$ne": models.CommentRemoved},
+	})
+	if !ok {
+		return
+	}
+
+	if time.Since(before.CreatedAt) > commentEditWindow {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Comments can only be edited within 15 minutes of posting",
+		})
+
+		return
+	}
+
+	var after models.Comment
+	err := h.collection.FindOneAndUpdate(h.ctx, bson.M{"_id": before.ID}, bson.M{
+		"$set": bson.M{"text": body.Text, "editedAt": time.Now()},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&after)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action:   models.AuditCommentUpdate,
+		RecipeID: &after.RecipeID,
+		Target:   after.ID.Hex(),
+	}, before, after)
+
+	c.JSON(http.StatusOK, after)
+}
+
+func (h *CommentsHandler) DeleteCommentHandler(c *gin.Context) {
+	// swagger:operation DELETE /comments/{id} comments deleteComment
+	//
+	// Delete an own comment. Replies to it are kept
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the comment
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Invalid comment ID
+
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	comment, err := h.updateComment(bson.M{
+		"_id":       objectID,
+		"authorId":  userID(c),
+		"deletedAt": bson.M{"$exists": false},
+	}, bson.M{
+		"$set": bson.M{"deletedAt": time.Now()},
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Comment not found",
+		})
+
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if comment.Status == models.CommentVisible {
+		if err := h.updateCommentCount(comment.RecipeID, -1); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error while updating comment count",
+			})
+
+			return
+		}
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action:   models.AuditCommentDelete,
+		RecipeID: &comment.RecipeID,
+		Target:   comment.ID.Hex(),
+	}, comment, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Comment has been deleted",
+	})
+}
+
+func (h *CommentsHandler) FlagCommentHandler(c *gin.Context) {
+	// swagger:operation POST /comments/{id}/flag comments flagComment
+	//
+	// Flag a comment for moderation. It stays hidden until reviewed
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the comment
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Invalid comment ID
+
+	var body struct {
+		Reason string `json:"reason" binding:"max=500"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	uid := userID(c)
+
+	comment, ok := h.findComment(c, bson.M{
+		"deletedAt": bson.M{"$exists": false},
+		"status":    bson.M{"$ne": models.CommentRemoved},
+	})
+	if !ok {
+		return
+	}
+
+	// Each user can flag a comment once. The count is adjusted by the
+	// status the flag replaced, so that concurrent flags and deletes take
+	// the comment out of it only once
+	before, err := h.updateComment(bson.M{
+		"_id":          comment.ID,
+		"deletedAt":    bson.M{"$exists": false},
+		"status":       bson.M{"$ne": models.CommentRemoved},
+		"flags.userId": bson.M{"$ne": uid},
+	}, bson.M{
+		"$set": bson.M{"status": models.CommentFlagged},
+		"$push": bson.M{"flags": models.CommentFlag{
+			UserID:    uid,
+			Reason:    body.Reason,
+			CreatedAt: time.Now(),
+		}},
+	})
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if before != nil && before.Status == models.CommentVisible {
+		if err := h.updateCommentCount(comment.RecipeID, -1); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error while updating comment count",
+			})
+
+			return
+		}
+	}
+
+	if before != nil {
+		h.auditHandler.Record(c, models.AuditEntry{
+			Action:   models.AuditCommentFlag,
+			RecipeID: &comment.RecipeID,
+			Target:   comment.ID.Hex(),
+		}, nil, nil)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Comment has been flagged for review",
+	})
+}
+
+func (h *CommentsHandler) ListFlaggedCommentsHandler(c *gin.Context) {
+	// swagger:operation GET /admin/comments/flagged comments listFlaggedComments
+	//
+	// Returns the moderation queue of flagged comments, oldest first
+	//
+	// ---
+	// parameters:
+	//   - name: page
+	//     in: query
+	//     type: integer
+	//   - name: limit
+	//     in: query
+	//     type: integer
+	// produces:
+	// - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '403':
+	//   description: Not a moderator
+
+	page, limit := pagination(c)
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}}).
+		SetSkip((page - 1) * limit).
+		SetLimit(limit)
+
+	cur, err := h.collection.Find(h.ctx, bson.M{
+		"status":    models.CommentFlagged,
+		"deletedAt": bson.M{"$exists": false},
+	}, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	comments := make([]models.Comment, 0, limit)
+	if err := cur.All(h.ctx, &comments); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	// Most flagged comments first within the page
+	sort.SliceStable(comments, func(i, j int) bool {
+		return len(comments[i].Flags) > len(comments[j].Flags)
+	})
+
+	c.JSON(http.StatusOK, comments)
+}
+
+// moderateComment moves a flagged comment to status, adjusting the comment
+// count of the recipe when it becomes visible again.
+func (h *CommentsHandler) moderateComment(c *gin.Context, status string, action string) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	update := bson.M{"$set": bson.M{"status": status}}
+	if status == models.CommentVisible {
+		update["$unset"] = bson.M{"flags": ""}
+	}
+
+	comment, err := h.updateComment(bson.M{"_id": objectID, "status": models.CommentFlagged}, update)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Comment not found",
+		})
+
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	// Comments deleted while flagged are not counted again
+	if status == models.CommentVisible && comment.DeletedAt == nil {
+		if err := h.updateCommentCount(comment.RecipeID, 1); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error while updating comment count",
+			})
+
+			return
+		}
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action:   action,
+		RecipeID: &comment.RecipeID,
+		Target:   comment.ID.Hex(),
+	}, nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Comment has been moderated",
+	})
+}
+
+func (h *CommentsHandler) ApproveCommentHandler(c *gin.Context) {
+	// swagger:operation POST /admin/comments/{id}/approve comments approveComment
+	//
+	// Approve a flagged comment, making it visible again
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the comment
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Comment is not in the moderation queue
+
+	h.moderateComment(c, models.CommentVisible, models.AuditCommentApprove)
+}
+
+func (h *CommentsHandler) RejectCommentHandler(c *gin.Context) {
+	// swagger:operation POST /admin/comments/{id}/reject comments rejectComment
+	//
+	// Reject a flagged comment, hiding it permanently
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the comment
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Comment is not in the moderation queue
+
+	h.moderateComment(c, models.CommentRemoved, models.AuditCommentReject)
+}
@@ -0,0 +1,651 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+type CookbooksHandler struct {
+	ctx               context.Context
+	collection        *mongo.Collection
+	recipesCollection *mongo.Collection
+	auditHandler      *AuditHandler
+}
+
+func NewCookbooksHandler(ctx context.Context, collection *mongo.Collection, recipesCollection *mongo.Collection, auditHandler *AuditHandler) *CookbooksHandler {
+	return &CookbooksHandler{ctx: ctx, collection: collection, recipesCollection: recipesCollection, auditHandler: auditHandler}
+}
+
+func (h *CookbooksHandler) CreateIndexes() error {
+	_, err := h.collection.Indexes().CreateOne(h.ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "ownerId", Value: 1}, {Key: "updatedAt", Value: -1}},
+	})
+
+	return err
+}
+
+// findCookbook loads the cookbook from the path. Unless public is set, only
+// cookbooks of the authenticated user are found.
+func (h *CookbooksHandler) findCookbook(c *gin.Context, public bool) (*models.Cookbook, bool) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return nil, false
+	}
+
+	filter := bson.M{"_id": objectID, "ownerId": userID(c)}
+	if public {
+		filter = bson.M{"_id": objectID, "$or": bson.A{
+			bson.M{"ownerId": userID(c)},
+			bson.M{"visibility": models.VisibilityPublic},
+		}}
+	}
+
+	var cookbook models.Cookbook
+	if err := h.collection.FindOne(h.ctx, filter).Decode(&cookbook); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Cookbook not found",
+			})
+
+			return nil, false
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return nil, false
+	}
+
+	return &cookbook, true
+}
+
+// cookbookRecipes returns the recipes of the cookbook in the owner's order.
+func (h *CookbooksHandler) cookbookRecipes(cookbook *models.Cookbook, uid string) ([]models.Recipe, error) {
+	ids := make([]primitive.ObjectID, len(cookbook.Recipes))
+	for i, entry := range cookbook.Recipes {
+		ids[i] = entry.RecipeID
+	}
+
+	cur, err := h.recipesCollection.Find(h.ctx, visible(bson.M{"_id": bson.M{"$in": ids}}, uid))
+	if err != nil {
+		return nil, err
+	}
+
+	var found []models.Recipe
+	if err := cur.All(h.ctx, &found); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[primitive.ObjectID]models.Recipe, len(found))
+	for _, recipe := range found {
+		byID[recipe.ID] = recipe
+	}
+
+	recipes := make([]models.Recipe, 0, len(ids))
+	for _, id := range ids {
+		// Recipes deleted or unpublished since they were added are skipped
+		if recipe, ok := byID[id]; ok {
+			recipes = append(recipes, recipe)
+		}
+	}
+
+	return recipes, nil
+}
+
+// saveCookbook replaces the cookbook and records the change. The cookbook
+// is only replaced if it has not changed since before was read, so that
+// concurrent changes are not lost; the client is told to retry otherwise.
+func (h *CookbooksHandler) saveCookbook(c *gin.Context, before *models.Cookbook, after *models.Cookbook) bool {
+	after.UpdatedAt = time.Now()
+
+	res, err := h.collection.ReplaceOne(h.ctx, bson.M{"_id": after.ID, "updatedAt": before.UpdatedAt}, after)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return false
+	}
+
+	if res.MatchedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Cookbook has been changed concurrently, please retry",
+		})
+
+		return false
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action: models.AuditCookbookUpdate,
+		Target: after.ID.Hex(),
+	}, before, after)
+
+	return true
+}
+
+func (h *CookbooksHandler) NewCookbookHandler(c *gin.Context) {
+	// swagger:operation POST /cookbooks cookbooks newCookbook
+	//
+	// Create new cookbook
+	//
+	// ---
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+
+	var cookbook models.Cookbook
+	if err := c.ShouldBindJSON(&cookbook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if cookbook.Visibility == "" {
+		cookbook.Visibility = models.VisibilityPrivate
+	}
+
+	cookbook.ID = primitive.NewObjectID()
+	cookbook.OwnerID = userID(c)
+	cookbook.Recipes = []models.CookbookEntry{}
+	cookbook.CreatedAt = time.Now()
+	cookbook.UpdatedAt = cookbook.CreatedAt
+
+	if _, err := h.collection.InsertOne(h.ctx, cookbook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error while inserting cookbook",
+		})
+
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action: models.AuditCookbookCreate,
+		Target: cookbook.ID.Hex(),
+	}, nil, cookbook)
+
+	c.JSON(http.StatusOK, cookbook)
+}
+
+func (h *CookbooksHandler) ListMyCookbooksHandler(c *gin.Context) {
+	// swagger:operation GET /me/cookbooks cookbooks listMyCookbooks
+	//
+	// Returns cookbooks of the authenticated user
+	//
+	// ---
+	// produces:
+	// - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+
+	opts := options.Find().SetSort(bson.D{{Key: "updatedAt", Value: -1}})
+
+	cur, err := h.collection.Find(h.ctx, bson.M{"ownerId": userID(c)}, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	cookbooks := make([]models.Cookbook, 0)
+	if err := cur.All(h.ctx, &cookbooks); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, cookbooks)
+}
+
+func (h *CookbooksHandler) GetCookbookHandler(c *gin.Context) {
+	// swagger:operation GET /cookbooks/{id} cookbooks getCookbook
+	//
+	// Get an own or public cookbook together with its recipes
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the cookbook
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Invalid cookbook ID
+
+	cookbook, ok := h.findCookbook(c, true)
+	if !ok {
+		return
+	}
+
+	recipes, err := h.cookbookRecipes(cookbook, userID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"cookbook": cookbook,
+		"recipes":  recipes,
+	})
+}
+
+func (h *CookbooksHandler) UpdateCookbookHandler(c *gin.Context) {
+	// swagger:operation PUT /cookbooks/{id} cookbooks updateCookbook
+	//
+	// Update name, description and visibility of an own cookbook
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the cookbook
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+	//  '404':
+	//   description: Invalid cookbook ID
+	//  '409':
+	//   description: Cookbook changed concurrently
+
+	var body models.Cookbook
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	before, ok := h.findCookbook(c, false)
+	if !ok {
+		return
+	}
+
+	after := *before
+	after.Name = body.Name
+	after.Description = body.Description
+	if body.Visibility != "" {
+		after.Visibility = body.Visibility
+	}
+
+	if !h.saveCookbook(c, before, &after) {
+		return
+	}
+
+	c.JSON(http.StatusOK, after)
+}
+
+func (h *CookbooksHandler) DeleteCookbookHandler(c *gin.Context) {
+	// swagger:operation DELETE /cookbooks/{id} cookbooks deleteCookbook
+	//
+	// Delete an own cookbook. The recipes in it are not affected
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the cookbook
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Invalid cookbook ID
+
+	cookbook, ok := h.findCookbook(c, false)
+	if !ok {
+		return
+	}
+
+	if _, err := h.collection.DeleteOne(h.ctx, bson.M{"_id": cookbook.ID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action: models.AuditCookbookDelete,
+		Target: cookbook.ID.Hex(),
+	}, cookbook, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Cookbook has been deleted",
+	})
+}
+
+func (h *CookbooksHandler) AddCookbookRecipeHandler(c *gin.Context) {
+	// swagger:operation POST /cookbooks/{id}/recipes cookbooks addCookbookRecipe
+	//
+	// Add a recipe to an own cookbook, at the end unless a position is given
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the cookbook
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+	//  '404':
+	//   description: Invalid cookbook or recipe ID
+	//  '409':
+	//   description: Recipe is already in the cookbook, or cookbook changed concurrently
+
+	var body struct {
+		models.CookbookEntry
+		Position *int `json:"position" binding:"omitempty,min=0"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	before, ok := h.findCookbook(c, false)
+	if !ok {
+		return
+	}
+
+	for _, entry := range before.Recipes {
+		if entry.RecipeID == body.RecipeID {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "Recipe is already in the cookbook",
+			})
+
+			return
+		}
+	}
+
+	count, err := h.recipesCollection.CountDocuments(h.ctx, visible(bson.M{"_id": body.RecipeID}, userID(c)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Recipe not found",
+		})
+
+		return
+	}
+
+	entry := body.CookbookEntry
+	entry.AddedAt = time.Now()
+
+	position := len(before.Recipes)
+	if body.Position != nil && *body.Position < position {
+		position = *body.Position
+	}
+
+	after := *before
+	after.Recipes = make([]models.CookbookEntry, 0, len(before.Recipes)+1)
+	after.Recipes = append(after.Recipes, before.Recipes[:position]...)
+	after.Recipes = append(after.Recipes, entry)
+	after.Recipes = append(after.Recipes, before.Recipes[position:]...)
+
+	if !h.saveCookbook(c, before, &after) {
+		return
+	}
+
+	c.JSON(http.StatusOK, after)
+}
+
+// findEntry returns the index of the recipe from the path in the cookbook.
+func findEntry(c *gin.Context, cookbook *models.Cookbook) (int, bool) {
+	recipeID, err := primitive.ObjectIDFromHex(c.Param("recipeId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return 0, false
+	}
+
+	for i, entry := range cookbook.Recipes {
+		if entry.RecipeID == recipeID {
+			return i, true
+		}
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{
+		"error": "Recipe is not in the cookbook",
+	})
+
+	return 0, false
+}
+
+func (h *CookbooksHandler) UpdateCookbookRecipeHandler(c *gin.Context) {
+	// swagger:operation PUT /cookbooks/{id}/recipes/{recipeId} cookbooks updateCookbookRecipe
+	//
+	// Update the note on a recipe in an own cookbook
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the cookbook
+	//     required: true
+	//     type: string
+	//   - name: recipeId
+	//     in: path
+	//     description: ID of the recipe
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Invalid cookbook or recipe ID
+	//  '409':
+	//   description: Cookbook changed concurrently
+
+	var body struct {
+		Note string `json:"note" binding:"max=1000"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	before, ok := h.findCookbook(c, false)
+	if !ok {
+		return
+	}
+
+	i, ok := findEntry(c, before)
+	if !ok {
+		return
+	}
+
+	after := *before
+	after.Recipes = append([]models.CookbookEntry(nil), before.Recipes...)
+	after.Recipes[i].Note = body.Note
+
+	if !h.saveCookbook(c, before, &after) {
+		return
+	}
+
+	c.JSON(http.StatusOK, after)
+}
+
+func (h *CookbooksHandler) RemoveCookbookRecipeHandler(c *gin.Context) {
+	// swagger:operation DELETE /cookbooks/{id}/recipes/{recipeId} cookbooks removeCookbookRecipe
+	//
+	// Remove a recipe from an own cookbook
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the cookbook
+	//     required: true
+	//     type: string
+	//   - name: recipeId
+	//     in: path
+	//     description: ID of the recipe
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Invalid cookbook or recipe ID
+	//  '409':
+	//   description: Cookbook changed concurrently
+
+	before, ok := h.findCookbook(c, false)
+	if !ok {
+		return
+	}
+
+	i, ok := findEntry(c, before)
+	if !ok {
+		return
+	}
+
+	after := *before
+	after.Recipes = make([]models.CookbookEntry, 0, len(before.Recipes)-1)
+	after.Recipes = append(after.Recipes, before.Recipes[:i]...)
+	after.Recipes = append(after.Recipes, before.Recipes[i+1:]...)
+
+	if !h.saveCookbook(c, before, &after) {
+		return
+	}
+
+	c.JSON(http.StatusOK, after)
+}
+
+func (h *CookbooksHandler) ReorderCookbookHandler(c *gin.Context) {
+	// swagger:operation PUT /cookbooks/{id}/order cookbooks reorderCookbook
+	//
+	// Reorder the recipes of an own cookbook
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the cookbook
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Order does not list every recipe of the cookbook exactly once
+	//  '404':
+	//   description: Invalid cookbook ID
+	//  '409':
+	//   description: Cookbook changed concurrently
+
+	var body struct {
+		RecipeIDs []primitive.ObjectID `json:"recipeIds" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	before, ok := h.findCookbook(c, false)
+	if !ok {
+		return
+	}
+
+	entries := make(map[primitive.ObjectID]models.CookbookEntry, len(before.Recipes))
+	for _, entry := range before.Recipes {
+		entries[entry.RecipeID] = entry
+	}
+
+	after := *before
+	after.Recipes = make([]models.CookbookEntry, 0, len(before.Recipes))
+	for _, id := range body.RecipeIDs {
+		entry, ok := entries[id]
+		if !ok {
+			break
+		}
+
+		after.Recipes = append(after.Recipes, entry)
+		delete(entries, id)
+	}
+
+	if len(entries) > 0 || len(after.Recipes) != len(body.RecipeIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Order must list every recipe of the cookbook exactly once",
+		})
+
+		return
+	}
+
+	if !h.saveCookbook(c, before, &after) {
+		return
+	}
+
+	c.JSON(http.StatusOK, after)
+}
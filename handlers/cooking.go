@@ -0,0 +1,692 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/harmlessevil/recipes-api/models"
+	"github.com/harmlessevil/recipes-api/steps"
+)
+
+const (
+	// cookingSessionTTL is how long an untouched cooking session is kept.
+	cookingSessionTTL = 12 * time.Hour
+	// maxCookingTimers bounds the timers of a session, finished ones
+	// included, so that sessions cannot grow without limit
+	maxCookingTimers = 20
+)
+
+var (
+	errCookingSessionNotFound = errors.New("no cooking session for this recipe")
+	errCookingSessionBusy     = errors.New("the cooking session was changed concurrently, try again")
+	errTimerNotFound          = errors.New("timer not found")
+	errTooManyTimers          = fmt.Errorf("a cooking session has at most %d timers, delete finished ones first", maxCookingTimers)
+)
+
+func cookingSessionKey(userID string, recipeID string) string {
+	return fmt.Sprintf("cooking:%s:%s", userID, recipeID)
+}
+
+// userCookingKey holds the IDs of the recipes a user has cooking sessions for.
+func userCookingKey(userID string) string {
+	return fmt.Sprintf("user:%s:cooking", userID)
+}
+
+func stepLink(recipeID string, n int) *string {
+	link := "/recipes/" + recipeID + "/steps/" + strconv.Itoa(n)
+	return &link
+}
+
+// refreshTimers computes the remaining time of the running timers.
+func refreshTimers(session *models.CookingSession, now time.Time) {
+	for i := range session.Timers {
+		timer := &session.Timers[i]
+		if timer.Paused || timer.EndsAt == nil {
+			continue
+		}
+
+		timer.Remaining = int(timer.EndsAt.Sub(now).Round(time.Second).Seconds())
+		if timer.Remaining < 0 {
+			timer.Remaining = 0
+		}
+		timer.Done = timer.Remaining == 0
+	}
+}
+
+type CookingHandler struct {
+	ctx               context.Context
+	recipesCollection *mongo.Collection
+	redisClient       *redis.Client
+	auditHandler      *AuditHandler
+}
+
+func NewCookingHandler(ctx context.Context, recipesCollection *mongo.Collection, redisClient *redis.Client, auditHandler *AuditHandler) *CookingHandler {
+	return &CookingHandler{ctx: ctx, recipesCollection: recipesCollection, redisClient: redisClient, auditHandler: auditHandler}
+}
+
+// findRecipe loads the fields of a recipe needed for cooking, writing the
+// error response if there is none. Recipes stored before steps were parsed
+// get them parsed on the fly.
+func (h *CookingHandler) findRecipe(c *gin.Context) (models.Recipe, bool) {
+	var recipe models.Recipe
+
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return recipe, false
+	}
+
+	projection := bson.M{"name": 1, "ingredients": 1, "instructions": 1, "steps": 1}
+	if err := h.recipesCollection.FindOne(h.ctx, visible(bson.M{"_id": objectID}, userID(c)), options.FindOne().SetProjection(projection)).Decode(&recipe); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Recipe not found",
+			})
+
+			return recipe, false
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return recipe, false
+	}
+
+	if len(recipe.Steps) == 0 {
+		recipe.Steps = steps.Parse(recipe.Instructions, recipe.Ingredients)
+	}
+
+	return recipe, true
+}
+
+func (h *CookingHandler) GetStepHandler(c *gin.Context) {
+	// swagger:operation GET /recipes/{id}/steps/{n} recipes getStep
+	//
+	// Get a single step of a recipe with the ingredients it uses and links
+	// to the previous and next steps
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the recipe
+	//     required: true
+	//     type: string
+	//   - name: n
+	//     in: path
+	//     description: number of the step, starting at 1
+	//     required: true
+	//     type: integer
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Invalid recipe ID or step number
+
+	recipe, ok := h.findRecipe(c)
+	if !ok {
+		return
+	}
+
+	n, err := strconv.Atoi(c.Param("n"))
+	if err != nil || n < 1 || n > len(recipe.Steps) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Step not found",
+		})
+
+		return
+	}
+
+	step := recipe.Steps[n-1]
+	detail := models.StepDetail{
+		RecipeID:    recipe.ID.Hex(),
+		RecipeName:  recipe.Name,
+		Step:        step,
+		TotalSteps:  len(recipe.Steps),
+		Ingredients: make([]string, 0, len(step.Ingredients)),
+	}
+
+	for _, i := range step.Ingredients {
+		if i >= 0 && i < len(recipe.Ingredients) {
+			detail.Ingredients = append(detail.Ingredients, recipe.Ingredients[i])
+		}
+	}
+
+	if n > 1 {
+		detail.Previous = stepLink(detail.RecipeID, n-1)
+	}
+	if n < len(recipe.Steps) {
+		detail.Next = stepLink(detail.RecipeID, n+1)
+	}
+
+	c.JSON(http.StatusOK, detail)
+}
+
+func (h *CookingHandler) loadSession(uid string, recipeID string) (*models.CookingSession, error) {
+	val, err := h.redisClient.Get(h.ctx, cookingSessionKey(uid, recipeID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, errCookingSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var session models.CookingSession
+	if err := json.Unmarshal(val, &session); err != nil {
+		return nil, err
+	}
+	refreshTimers(&session, time.Now())
+
+	return &session, nil
+}
+
+// updateSession applies update to the cooking session of a user for a
+// recipe, creating it first if start is set. Redis transactions keep
+// concurrent changes from several devices from overwriting each other.
+func (h *CookingHandler) updateSession(uid string, recipe models.Recipe, start bool, update func(*models.CookingSession) error) (*models.CookingSession, error) {
+	recipeID := recipe.ID.Hex()
+	key := cookingSessionKey(uid, recipeID)
+
+	for attempt := 0; attempt < 3; attempt++ {
+		var session models.CookingSession
+
+		err := h.redisClient.Watch(h.ctx, func(tx *redis.Tx) error {
+			now := time.Now()
+
+			val, err := tx.Get(h.ctx, key).Bytes()
+			switch {
+			case errors.Is(err, redis.Nil):
+				if !start {
+					return errCookingSessionNotFound
+				}
+
+				session = models.CookingSession{
+					RecipeID:    recipeID,
+					CurrentStep: 1,
+					Timers:      []models.CookingTimer{},
+					StartedAt:   now,
+				}
+			case err != nil:
+				return err
+			default:
+				if err := json.Unmarshal(val, &session); err != nil {
+					return err
+				}
+			}
+
+			session.RecipeName = recipe.Name
+			session.TotalSteps = len(recipe.Steps)
+			refreshTimers(&session, now)
+
+			if err := update(&session); err != nil {
+				return err
+			}
+			session.UpdatedAt = now
+
+			data, err := json.Marshal(session)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.TxPipelined(h.ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(h.ctx, key, data, cookingSessionTTL)
+				pipe.SAdd(h.ctx, userCookingKey(uid), recipeID)
+				pipe.Expire(h.ctx, userCookingKey(uid), cookingSessionTTL)
+
+				return nil
+			})
+
+			return err
+		}, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			if err != nil {
+				return nil, err
+			}
+
+			return &session, nil
+		}
+	}
+
+	return nil, errCookingSessionBusy
+}
+
+func writeCookingError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errCookingSessionNotFound), errors.Is(err, errTimerNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+	case errors.Is(err, errCookingSessionBusy), errors.Is(err, errTooManyTimers):
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+	}
+}
+
+func (h *CookingHandler) GetCookingSessionHandler(c *gin.Context) {
+	// swagger:operation GET /recipes/{id}/cooking recipes getCookingSession
+	//
+	// Get the cooking session of the user for a recipe, with the current
+	// step and the remaining time of its timers
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the recipe
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: No cooking session for the recipe
+
+	session, err := h.loadSession(userID(c), c.Param("id"))
+	if err != nil {
+		writeCookingError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+func (h *CookingHandler) ListCookingSessionsHandler(c *gin.Context) {
+	// swagger:operation GET /me/cooking recipes listCookingSessions
+	//
+	// List the cooking sessions of the user, e.g. to resume one on another
+	// device
+	//
+	// ---
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+
+	uid := userID(c)
+
+	recipeIDs, err := h.redisClient.SMembers(h.ctx, userCookingKey(uid)).Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	sessions := make([]models.CookingSession, 0, len(recipeIDs))
+	for _, recipeID := range recipeIDs {
+		session, err := h.loadSession(uid, recipeID)
+		if errors.Is(err, errCookingSessionNotFound) {
+			// The session expired
+			h.redisClient.SRem(h.ctx, userCookingKey(uid), recipeID)
+			continue
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+
+			return
+		}
+
+		sessions = append(sessions, *session)
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+func (h *CookingHandler) UpdateCookingSessionHandler(c *gin.Context) {
+	// swagger:operation PUT /recipes/{id}/cooking recipes updateCookingSession
+	//
+	// Start cooking a recipe or move to another step. The session is shared
+	// by all devices of the user
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the recipe
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid step number
+	//  '404':
+	//   description: Invalid recipe ID
+
+	var request models.CookingStepRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	recipe, ok := h.findRecipe(c)
+	if !ok {
+		return
+	}
+
+	if request.Step > len(recipe.Steps) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("The recipe has %d steps", len(recipe.Steps)),
+		})
+
+		return
+	}
+
+	session, err := h.updateSession(userID(c), recipe, true, func(session *models.CookingSession) error {
+		session.CurrentStep = request.Step
+		return nil
+	})
+	if err != nil {
+		writeCookingError(c, err)
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action:   models.AuditCookingUpdate,
+		RecipeID: &recipe.ID,
+	}, nil, session)
+
+	c.JSON(http.StatusOK, session)
+}
+
+func (h *CookingHandler) DeleteCookingSessionHandler(c *gin.Context) {
+	// swagger:operation DELETE /recipes/{id}/cooking recipes deleteCookingSession
+	//
+	// Finish cooking a recipe, discarding its session and timers
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the recipe
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: No cooking session for the recipe
+
+	uid := userID(c)
+	recipeID := c.Param("id")
+
+	var deleted *redis.IntCmd
+	if _, err := h.redisClient.TxPipelined(h.ctx, func(pipe redis.Pipeliner) error {
+		deleted = pipe.Del(h.ctx, cookingSessionKey(uid, recipeID))
+		pipe.SRem(h.ctx, userCookingKey(uid), recipeID)
+
+		return nil
+	}); err != nil {
+		writeCookingError(c, err)
+		return
+	}
+
+	if deleted.Val() == 0 {
+		writeCookingError(c, errCookingSessionNotFound)
+		return
+	}
+
+	// Sessions are only started for existing recipes, so the ID is valid
+	entry := models.AuditEntry{Action: models.AuditCookingDelete}
+	if objectID, err := primitive.ObjectIDFromHex(recipeID); err == nil {
+		entry.RecipeID = &objectID
+	}
+	h.auditHandler.Record(c, entry, nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Cooking session has been deleted",
+	})
+}
+
+func (h *CookingHandler) StartTimerHandler(c *gin.Context) {
+	// swagger:operation POST /recipes/{id}/cooking/timers recipes startTimer
+	//
+	// Start a timer for a step of the recipe being cooked. The duration
+	// defaults to the longest one the step mentions
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the recipe
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '201':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+	//  '404':
+	//   description: No cooking session for the recipe
+	//  '409':
+	//   description: Too many timers, or the session was changed concurrently
+
+	var request models.CookingTimerRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	recipe, ok := h.findRecipe(c)
+	if !ok {
+		return
+	}
+
+	if request.Step > len(recipe.Steps) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("The recipe has %d steps", len(recipe.Steps)),
+		})
+
+		return
+	}
+
+	step := recipe.Steps[request.Step-1]
+	if request.Duration == 0 {
+		if step.Timer == nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "The step mentions no duration, a duration is required",
+			})
+
+			return
+		}
+
+		request.Duration = step.Timer.Max
+	}
+
+	if request.Label == "" {
+		request.Label = fmt.Sprintf("Step %d", request.Step)
+		if step.Timer != nil {
+			request.Label += ": " + step.Timer.Text
+		}
+	}
+
+	now := time.Now()
+	endsAt := now.Add(time.Duration(request.Duration) * time.Second)
+	timer := models.CookingTimer{
+		ID:        primitive.NewObjectID().Hex(),
+		Step:      request.Step,
+		Label:     request.Label,
+		Duration:  request.Duration,
+		StartedAt: now,
+		EndsAt:    &endsAt,
+		Remaining: request.Duration,
+	}
+
+	session, err := h.updateSession(userID(c), recipe, false, func(session *models.CookingSession) error {
+		if len(session.Timers) >= maxCookingTimers {
+			return errTooManyTimers
+		}
+
+		session.Timers = append(session.Timers, timer)
+		return nil
+	})
+	if err != nil {
+		writeCookingError(c, err)
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action:   models.AuditCookingUpdate,
+		RecipeID: &recipe.ID,
+		Target:   timer.ID,
+	}, nil, session)
+
+	c.JSON(http.StatusCreated, session)
+}
+
+// updateTimer applies update to a timer of the cooking session for the
+// recipe of the request and writes the session.
+func (h *CookingHandler) updateTimer(c *gin.Context, update func(session *models.CookingSession, i int)) {
+	recipe, ok := h.findRecipe(c)
+	if !ok {
+		return
+	}
+
+	timerID := c.Param("timerId")
+	session, err := h.updateSession(userID(c), recipe, false, func(session *models.CookingSession) error {
+		for i := range session.Timers {
+			if session.Timers[i].ID == timerID {
+				update(session, i)
+				return nil
+			}
+		}
+
+		return errTimerNotFound
+	})
+	if err != nil {
+		writeCookingError(c, err)
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action:   models.AuditCookingUpdate,
+		RecipeID: &recipe.ID,
+		Target:   timerID,
+	}, nil, session)
+
+	c.JSON(http.StatusOK, session)
+}
+
+func (h *CookingHandler) UpdateTimerHandler(c *gin.Context) {
+	// swagger:operation PATCH /recipes/{id}/cooking/timers/{timerId} recipes updateTimer
+	//
+	// Pause or resume a timer
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the recipe
+	//     required: true
+	//     type: string
+	//   - name: timerId
+	//     in: path
+	//     description: ID of the timer
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+	//  '404':
+	//   description: Invalid timer ID
+
+	var request models.CookingTimerUpdate
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	h.updateTimer(c, func(session *models.CookingSession, i int) {
+		timer := &session.Timers[i]
+		if timer.Paused == request.Paused || timer.Done {
+			return
+		}
+
+		// Remaining was refreshed when the session was loaded
+		timer.Paused = request.Paused
+		if timer.Paused {
+			timer.EndsAt = nil
+		} else {
+			endsAt := time.Now().Add(time.Duration(timer.Remaining) * time.Second)
+			timer.EndsAt = &endsAt
+		}
+	})
+}
+
+func (h *CookingHandler) DeleteTimerHandler(c *gin.Context) {
+	// swagger:operation DELETE /recipes/{id}/cooking/timers/{timerId} recipes deleteTimer
+	//
+	// Cancel or dismiss a timer
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the recipe
+	//     required: true
+	//     type: string
+	//   - name: timerId
+	//     in: path
+	//     description: ID of the timer
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Invalid timer ID
+
+	h.updateTimer(c, func(session *models.CookingSession, i int) {
+		session.Timers = append(session.Timers[:i], session.Timers[i+1:]...)
+	})
+}
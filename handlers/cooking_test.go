@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+func newTestCookingHandler(t *testing.T) (*CookingHandler, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return &CookingHandler{ctx: context.Background(), redisClient: client}, server
+}
+
+func TestUpdateSession(t *testing.T) {
+	h, _ := newTestCookingHandler(t)
+	recipe := models.Recipe{ID: primitive.NewObjectID(), Name: "Pancakes", Steps: make([]models.Step, 3)}
+
+	noop := func(*models.CookingSession) error { return nil }
+	if _, err := h.updateSession("user", recipe, false, noop); !errors.Is(err, errCookingSessionNotFound) {
+		t.Fatalf("updateSession without a session error = %v, want %v", err, errCookingSessionNotFound)
+	}
+
+	session, err := h.updateSession("user", recipe, true, func(session *models.CookingSession) error {
+		session.CurrentStep = 2
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.CurrentStep != 2 || session.TotalSteps != 3 || session.RecipeName != "Pancakes" {
+		t.Errorf("started session = %+v", session)
+	}
+
+	stored, err := h.loadSession("user", recipe.ID.Hex())
+	if err != nil || stored.CurrentStep != 2 {
+		t.Errorf("stored session = %+v, %v, want step 2", stored, err)
+	}
+}
+
+func TestUpdateSessionRetries(t *testing.T) {
+	h, server := newTestCookingHandler(t)
+	recipe := models.Recipe{ID: primitive.NewObjectID(), Steps: make([]models.Step, 3)}
+	key := cookingSessionKey("user", recipe.ID.Hex())
+
+	if _, err := h.updateSession("user", recipe, true, func(*models.CookingSession) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another device changes the session while the first attempt is
+	// applied, so that its transaction fails and the update is retried on
+	// the new session
+	attempts := 0
+	session, err := h.updateSession("user", recipe, false, func(session *models.CookingSession) error {
+		attempts++
+		if attempts == 1 {
+			server.Set(key, `{"currentStep": 3, "timers": []}`)
+		}
+
+		session.Timers = append(session.Timers, models.CookingTimer{ID: "timer"})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Errorf("update applied %d times, want 2", attempts)
+	}
+	if session.CurrentStep != 3 || len(session.Timers) != 1 {
+		t.Errorf("session = %+v, want the concurrent step and one timer", session)
+	}
+
+	// Sessions that keep changing are given up on
+	_, err = h.updateSession("user", recipe, false, func(session *models.CookingSession) error {
+		server.Set(key, `{"currentStep": 1, "timers": []}`)
+		return nil
+	})
+	if !errors.Is(err, errCookingSessionBusy) {
+		t.Errorf("updateSession of a busy session error = %v, want %v", err, errCookingSessionBusy)
+	}
+}
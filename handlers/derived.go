@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/harmlessevil/recipes-api/derive"
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+// backfillBatchSize bounds the updates sent to MongoDB at once
+const backfillBatchSize = 500
+
+// derivedUpdate sets the derived fields of a recipe.
+func derivedUpdate(recipe *models.Recipe) bson.M {
+	return bson.M{
+		"$set": bson.M{
+			"diets":       recipe.Diets,
+			"allergens":   recipe.Allergens,
+			"steps":       recipe.Steps,
+			"prepTime":    recipe.PrepTime,
+			"cookTime":    recipe.CookTime,
+			"totalTime":   recipe.TotalTime,
+			"fingerprint": recipe.Fingerprint,
+		},
+	}
+}
+
+// updateDerivedFields recomputes the derived fields of an updated recipe.
+// Errors are only logged, as the update itself has already succeeded.
+func (h *RecipesHandler) updateDerivedFields(recipe *models.Recipe) {
+	derive.Recipe(recipe)
+
+	if _, err := h.collection.UpdateOne(h.ctx, bson.M{"_id": recipe.ID}, derivedUpdate(recipe)); err != nil {
+		log.Println(err)
+	}
+
+	if _, err := cacheNutrition(h.ctx, h.redisClient, recipe); err != nil {
+		log.Println(err)
+	}
+}
+
+// BackfillDerivedFields derives the fields of the recipes stored before
+// those fields existed, so that filters on them do not skip the recipes and
+// the duplicates report finds them.
+func (h *RecipesHandler) BackfillDerivedFields() error {
+	cur, err := h.collection.Find(h.ctx, bson.M{"$or": bson.A{
+		bson.M{"diets": bson.M{"$exists": false}},
+		bson.M{"allergens": bson.M{"$exists": false}},
+		bson.M{"fingerprint": bson.M{"$exists": false}},
+	}})
+	if err != nil {
+		return err
+	}
+	defer cur.Close(h.ctx)
+
+	updates := make([]mongo.WriteModel, 0, backfillBatchSize)
+	flush := func() error {
+		if len(updates) == 0 {
+			return nil
+		}
+
+		_, err := h.collection.BulkWrite(h.ctx, updates, options.BulkWrite().SetOrdered(false))
+		updates = updates[:0]
+
+		return err
+	}
+
+	for cur.Next(h.ctx) {
+		var recipe models.Recipe
+		if err := cur.Decode(&recipe); err != nil {
+			return err
+		}
+
+		derive.Recipe(&recipe)
+		updates = append(updates, mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": recipe.ID}).SetUpdate(derivedUpdate(&recipe)))
+
+		if len(updates) == backfillBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+
+	return flush()
+}
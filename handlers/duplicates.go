@@ -0,0 +1,690 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/harmlessevil/recipes-api/dedupe"
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+const (
+	// maxDuplicateCandidates bounds the recipes sharing a band with a new
+	// recipe that are compared with it
+	maxDuplicateCandidates = 200
+	maxDuplicateMatches    = 5
+	// duplicatesBatchSize bounds the recipes loaded at once for the
+	// duplicates report
+	duplicatesBatchSize = 1000
+)
+
+// possibleDuplicates finds the recipes that a new recipe likely duplicates
+// among the published ones and the drafts of its author. Errors are only
+// logged, as the recipe has been created anyway.
+func (h *RecipesHandler) possibleDuplicates(recipe *models.Recipe) []models.DuplicateMatch {
+	if len(recipe.Fingerprint) == 0 {
+		return nil
+	}
+
+	cur, err := h.collection.Find(h.ctx, bson.M{
+		"_id":         bson.M{"$ne": recipe.ID},
+		"fingerprint": bson.M{"$in": recipe.Fingerprint},
+		"$or": bson.A{
+			bson.M{"draft": bson.M{"$ne": true}},
+			bson.M{"authorId": recipe.AuthorID},
+		},
+	}, options.Find().
+		SetProjection(bson.M{"name": 1, "ingredients": 1}).
+		SetLimit(maxDuplicateCandidates))
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	var candidates []models.Recipe
+	if err := cur.All(h.ctx, &candidates); err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	fingerprint := dedupe.New(recipe.Name, recipe.Ingredients)
+
+	var matches []models.DuplicateMatch
+	for _, candidate := range candidates {
+		similarity := dedupe.Similarity(fingerprint, dedupe.New(candidate.Name, candidate.Ingredients))
+		if similarity >= dedupe.Threshold {
+			matches = append(matches, models.DuplicateMatch{
+				RecipeID:   candidate.ID,
+				Name:       candidate.Name,
+				Similarity: similarity,
+			})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Similarity > matches[j].Similarity
+	})
+	if len(matches) > maxDuplicateMatches {
+		matches = matches[:maxDuplicateMatches]
+	}
+
+	return matches
+}
+
+type DuplicatesHandler struct {
+	ctx                     context.Context
+	recipesCollection       *mongo.Collection
+	reviewsCollection       *mongo.Collection
+	commentsCollection      *mongo.Collection
+	favoritesCollection     *mongo.Collection
+	cookbooksCollection     *mongo.Collection
+	mealPlansCollection     *mongo.Collection
+	shoppingListsCollection *mongo.Collection
+	redisClient             *redis.Client
+	auditHandler            *AuditHandler
+}
+
+func NewDuplicatesHandler(ctx context.Context, recipesCollection *mongo.Collection, reviewsCollection *mongo.Collection, commentsCollection *mongo.Collection, favoritesCollection *mongo.Collection, cookbooksCollection *mongo.Collection, mealPlansCollection *mongo.Collection, shoppingListsCollection *mongo.Collection, redisClient *redis.Client, auditHandler *AuditHandler) *DuplicatesHandler {
+	return &DuplicatesHandler{
+		ctx:                     ctx,
+		recipesCollection:       recipesCollection,
+		reviewsCollection:       reviewsCollection,
+		commentsCollection:      commentsCollection,
+		favoritesCollection:     favoritesCollection,
+		cookbooksCollection:     cookbooksCollection,
+		mealPlansCollection:     mealPlansCollection,
+		shoppingListsCollection: shoppingListsCollection,
+		redisClient:             redisClient,
+		auditHandler:            auditHandler,
+	}
+}
+
+// duplicateCandidate is a recipe as loaded for the duplicates report.
+type duplicateCandidate struct {
+	models.DuplicateRecipe `bson:",inline"`
+	Ingredients            []string `bson:"ingredients"`
+}
+
+// duplicateCandidates returns the IDs of the recipes sharing at least one
+// fingerprint band with another recipe, the only ones that can be
+// duplicates. The bands are grouped by MongoDB rather than loaded.
+func (h *DuplicatesHandler) duplicateCandidates() ([]primitive.ObjectID, error) {
+	cur, err := h.recipesCollection.Aggregate(h.ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"fingerprint.0": bson.M{"$exists": true}}}},
+		{{Key: "$unwind", Value: "$fingerprint"}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   "$fingerprint",
+			"ids":   bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+		{{Key: "$unwind", Value: "$ids"}},
+		{{Key: "$group", Value: bson.M{"_id": "$ids"}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(h.ctx)
+
+	var ids []primitive.ObjectID
+	for cur.Next(h.ctx) {
+		var candidate struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cur.Decode(&candidate); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, candidate.ID)
+	}
+
+	return ids, cur.Err()
+}
+
+func (h *DuplicatesHandler) ListDuplicatesHandler(c *gin.Context) {
+	// swagger:operation GET /admin/recipes/duplicates admin listDuplicates
+	//
+	// List clusters of recipes that are likely duplicates of each other by
+	// their names and ingredients, largest first
+	//
+	// ---
+	// parameters:
+	//   - name: threshold
+	//     in: query
+	//     description: similarity from 0 to 1 from which recipes are duplicates, 0.7 by default
+	//     required: false
+	//     type: number
+	//   - name: page
+	//     in: query
+	//     type: integer
+	//   - name: limit
+	//     in: query
+	//     type: integer
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid threshold
+
+	threshold := dedupe.Threshold
+	if value := c.Query("threshold"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 || parsed > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "threshold must be a number above 0 and at most 1",
+			})
+
+			return
+		}
+		threshold = parsed
+	}
+
+	page, limit := pagination(c)
+
+	ids, err := h.duplicateCandidates()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	recipes := make([]duplicateCandidate, 0, len(ids))
+	fingerprints := make([]dedupe.Fingerprint, 0, len(ids))
+	for start := 0; start < len(ids); start += duplicatesBatchSize {
+		end := start + duplicatesBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		cur, err := h.recipesCollection.Find(h.ctx, bson.M{"_id": bson.M{"$in": ids[start:end]}}, options.Find().
+			SetSort(bson.M{"_id": 1}).
+			SetProjection(bson.M{
+				"name": 1, "authorId": 1, "publishedAt": 1, "draft": 1, "ratingCount": 1,
+				"favoriteCount": 1, "commentCount": 1, "ingredients": 1,
+			}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+
+			return
+		}
+
+		for cur.Next(h.ctx) {
+			var recipe duplicateCandidate
+			if err := cur.Decode(&recipe); err != nil {
+				cur.Close(h.ctx)
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+
+				return
+			}
+
+			fingerprints = append(fingerprints, dedupe.New(recipe.Name, recipe.Ingredients))
+			// Only the fields reported are kept
+			recipe.Ingredients = nil
+			recipes = append(recipes, recipe)
+		}
+
+		err = cur.Err()
+		cur.Close(h.ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+
+			return
+		}
+	}
+
+	clusters := make([]models.DuplicateCluster, 0, limit)
+	for i, cluster := range dedupe.Clusters(fingerprints, threshold) {
+		if int64(i) < (page-1)*limit {
+			continue
+		}
+		if int64(len(clusters)) == limit {
+			break
+		}
+
+		duplicates := models.DuplicateCluster{
+			Similarity: cluster.Similarity,
+			Recipes:    make([]models.DuplicateRecipe, len(cluster.Members)),
+		}
+		for j, member := range cluster.Members {
+			duplicates.Recipes[j] = recipes[member].DuplicateRecipe
+		}
+
+		clusters = append(clusters, duplicates)
+	}
+
+	c.JSON(http.StatusOK, clusters)
+}
+
+// moveOwned moves the documents of the duplicates, such as reviews, to the
+// recipe kept, keeping one per owner: the documents of owners who already
+// have one for the recipe kept or for a more recent duplicate are deleted.
+func (h *DuplicatesHandler) moveOwned(collection *mongo.Collection, ownerField string, keepID primitive.ObjectID, duplicateIDs []primitive.ObjectID) (int, error) {
+	owners := make(map[string]bool)
+
+	cur, err := collection.Find(h.ctx, bson.M{"recipeId": keepID}, options.Find().SetProjection(bson.M{ownerField: 1}))
+	if err != nil {
+		return 0, err
+	}
+
+	var kept []bson.M
+	if err := cur.All(h.ctx, &kept); err != nil {
+		return 0, err
+	}
+	for _, document := range kept {
+		owner, _ := document[ownerField].(string)
+		owners[owner] = true
+	}
+
+	cur, err = collection.Find(h.ctx, bson.M{"recipeId": bson.M{"$in": duplicateIDs}}, options.Find().
+		SetProjection(bson.M{ownerField: 1}).
+		SetSort(bson.D{{Key: "_id", Value: -1}}))
+	if err != nil {
+		return 0, err
+	}
+
+	var documents []bson.M
+	if err := cur.All(h.ctx, &documents); err != nil {
+		return 0, err
+	}
+
+	var move, remove []primitive.ObjectID
+	for _, document := range documents {
+		id, _ := document["_id"].(primitive.ObjectID)
+		owner, _ := document[ownerField].(string)
+		if owners[owner] {
+			remove = append(remove, id)
+			continue
+		}
+
+		owners[owner] = true
+		move = append(move, id)
+	}
+
+	if len(remove) > 0 {
+		if _, err := collection.DeleteMany(h.ctx, bson.M{"_id": bson.M{"$in": remove}}); err != nil {
+			return 0, err
+		}
+	}
+
+	if len(move) > 0 {
+		if _, err := collection.UpdateMany(h.ctx, bson.M{"_id": bson.M{"$in": move}}, bson.M{
+			"$set": bson.M{"recipeId": keepID},
+		}); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(move), nil
+}
+
+// moveCookbookEntries points the cookbook entries of the duplicates to the
+// recipe kept. A cookbook holding several of them keeps the first, with
+// the first note written.
+func (h *DuplicatesHandler) moveCookbookEntries(keepID primitive.ObjectID, duplicateIDs []primitive.ObjectID) (int, error) {
+	duplicates := make(map[primitive.ObjectID]bool, len(duplicateIDs))
+	for _, id := range duplicateIDs {
+		duplicates[id] = true
+	}
+
+	cur, err := h.cookbooksCollection.Find(h.ctx, bson.M{"recipes.recipeId": bson.M{"$in": duplicateIDs}})
+	if err != nil {
+		return 0, err
+	}
+
+	var cookbooks []models.Cookbook
+	if err := cur.All(h.ctx, &cookbooks); err != nil {
+		return 0, err
+	}
+
+	for _, cookbook := range cookbooks {
+		entries := make([]models.CookbookEntry, 0, len(cookbook.Recipes))
+		positions := make(map[primitive.ObjectID]int)
+		for _, entry := range cookbook.Recipes {
+			if duplicates[entry.RecipeID] {
+				entry.RecipeID = keepID
+			}
+
+			if i, ok := positions[entry.RecipeID]; ok {
+				if entries[i].Note == "" {
+					entries[i].Note = entry.Note
+				}
+				continue
+			}
+
+			positions[entry.RecipeID] = len(entries)
+			entries = append(entries, entry)
+		}
+
+		if _, err := h.cookbooksCollection.UpdateOne(h.ctx, bson.M{"_id": cookbook.ID}, bson.M{
+			"$set": bson.M{"recipes": entries, "updatedAt": time.Now()},
+		}); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(cookbooks), nil
+}
+
+// recipeCounters recomputes the rating, favorite and comment counts of a
+// recipe from its reviews, favorites and visible comments.
+func (h *DuplicatesHandler) recipeCounters(recipeID primitive.ObjectID) (bson.M, error) {
+	cur, err := h.reviewsCollection.Aggregate(h.ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"recipeId": recipeID}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   nil,
+			"sum":   bson.M{"$sum": "$rating"},
+			"count": bson.M{"$sum": 1},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ratings []struct {
+		Sum   int `bson:"sum"`
+		Count int `bson:"count"`
+	}
+	if err := cur.All(h.ctx, &ratings); err != nil {
+		return nil, err
+	}
+
+	favorites, err := h.favoritesCollection.CountDocuments(h.ctx, bson.M{"recipeId": recipeID})
+	if err != nil {
+		return nil, err
+	}
+
+	comments, err := h.commentsCollection.CountDocuments(h.ctx, bson.M{
+		"recipeId":  recipeID,
+		"status":    models.CommentVisible,
+		"deletedAt": nil,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counters := bson.M{
+		"ratingSum": 0, "ratingCount": 0, "ratingAverage": 0.0,
+		"favoriteCount": favorites, "commentCount": comments,
+	}
+	if len(ratings) > 0 && ratings[0].Count > 0 {
+		counters["ratingSum"] = ratings[0].Sum
+		counters["ratingCount"] = ratings[0].Count
+		counters["ratingAverage"] = float64(ratings[0].Sum) / float64(ratings[0].Count)
+	}
+
+	return counters, nil
+}
+
+func (h *DuplicatesHandler) MergeRecipesHandler(c *gin.Context) {
+	// swagger:operation POST /admin/recipes/{id}/merge admin mergeRecipes
+	//
+	// Merge duplicates into a recipe and delete them. Their reviews,
+	// comments, favorites and images are moved to the recipe, as are the
+	// cookbooks, meal plans and shopping lists referring to them. Users
+	// keep a single review and favorite, that of the recipe kept if any.
+	// The duplicates are deleted last and every step before can be
+	// repeated, so a merge that failed midway completes when retried
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the recipe to keep
+	//     required: true
+	//     type: string
+	// consumes:
+	//   - application/json
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+	//  '404':
+	//   description: Invalid recipe ID
+
+	keepID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	var body models.RecipeMerge
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	var duplicateIDs []primitive.ObjectID
+	seen := make(map[primitive.ObjectID]bool)
+	for _, id := range body.DuplicateIDs {
+		if id == keepID {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "A recipe cannot be merged into itself",
+			})
+
+			return
+		}
+
+		if !seen[id] {
+			seen[id] = true
+			duplicateIDs = append(duplicateIDs, id)
+		}
+	}
+
+	var keep models.Recipe
+	if err := h.recipesCollection.FindOne(h.ctx, bson.M{"_id": keepID}).Decode(&keep); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Recipe not found",
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	cur, err := h.recipesCollection.Find(h.ctx, bson.M{"_id": bson.M{"$in": duplicateIDs}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	var duplicates []models.Recipe
+	if err := cur.All(h.ctx, &duplicates); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if len(duplicates) != len(duplicateIDs) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Duplicate recipe not found",
+		})
+
+		return
+	}
+
+	report := models.MergeReport{Merged: len(duplicates)}
+
+	if report.Reviews, err = h.moveOwned(h.reviewsCollection, "authorId", keepID, duplicateIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if report.Favorites, err = h.moveOwned(h.favoritesCollection, "userId", keepID, duplicateIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	res, err := h.commentsCollection.UpdateMany(h.ctx, bson.M{"recipeId": bson.M{"$in": duplicateIDs}}, bson.M{
+		"$set": bson.M{"recipeId": keepID},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+	report.Comments = int(res.ModifiedCount)
+
+	if report.Cookbooks, err = h.moveCookbookEntries(keepID, duplicateIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	res, err = h.mealPlansCollection.UpdateMany(h.ctx, bson.M{"slots.recipeId": bson.M{"$in": duplicateIDs}}, bson.M{
+		"$set": bson.M{"slots.$[slot].recipeId": keepID},
+	}, options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+		bson.M{"slot.recipeId": bson.M{"$in": duplicateIDs}},
+	}}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+	report.MealPlans = int(res.ModifiedCount)
+
+	res, err = h.shoppingListsCollection.UpdateMany(h.ctx, bson.M{"$or": bson.A{
+		bson.M{"recipes.recipeId": bson.M{"$in": duplicateIDs}},
+		bson.M{"aisles.items.recipeIds": bson.M{"$in": duplicateIDs}},
+	}}, bson.M{
+		"$set": bson.M{
+			"recipes.$[recipe].recipeId":           keepID,
+			"aisles.$[].items.$[].recipeIds.$[id]": keepID,
+		},
+	}, options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+		bson.M{"recipe.recipeId": bson.M{"$in": duplicateIDs}},
+		bson.M{"id": bson.M{"$in": duplicateIDs}},
+	}}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+	report.ShoppingLists = int(res.ModifiedCount)
+
+	counters, err := h.recipeCounters(keepID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	// Images moved by a previous attempt are already on the recipe kept
+	images := append([]models.RecipeImage{}, keep.Images...)
+	moved := make(map[primitive.ObjectID]bool, len(images))
+	for _, image := range images {
+		moved[image.ID] = true
+	}
+	for _, duplicate := range duplicates {
+		for _, image := range duplicate.Images {
+			if moved[image.ID] {
+				continue
+			}
+
+			image.Cover = len(images) == 0
+			images = append(images, image)
+			report.Images++
+		}
+	}
+	counters["images"] = images
+
+	if err := h.recipesCollection.FindOneAndUpdate(h.ctx, bson.M{"_id": keepID}, bson.M{
+		"$set": counters,
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&report.Recipe); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if _, err := h.recipesCollection.DeleteMany(h.ctx, bson.M{"_id": bson.M{"$in": duplicateIDs}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action:   models.AuditRecipeMerge,
+		RecipeID: &keepID,
+	}, keep, report.Recipe)
+
+	for _, duplicate := range duplicates {
+		duplicateID := duplicate.ID
+		h.auditHandler.Record(c, models.AuditEntry{
+			Action:   models.AuditRecipeMerge,
+			RecipeID: &duplicateID,
+			Target:   keepID.Hex(),
+		}, duplicate, nil)
+
+		if err := h.redisClient.Del(h.ctx, nutritionKey(duplicateID)).Err(); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if err := h.redisClient.Del(h.ctx, "recipes").Err(); err != nil {
+		log.Println(err)
+	}
+
+	c.JSON(http.StatusOK, report)
+}
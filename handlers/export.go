@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/harmlessevil/recipes-api/export"
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+const (
+	exportBatchSize = 500
+	// exportFlushEvery recipes the response is flushed, so that clients see
+	// progress and nothing piles up in buffers
+	exportFlushEvery = 100
+)
+
+// parseExportTime accepts RFC 3339 times and plain dates.
+func parseExportTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	return time.Parse("2006-01-02", value)
+}
+
+// acceptsGzip reports whether the client accepts gzip encoded responses.
+func acceptsGzip(c *gin.Context) bool {
+	for _, encoding := range strings.Split(c.GetHeader("Accept-Encoding"), ",") {
+		encoding = strings.TrimSpace(encoding)
+		if encoding == "gzip" || strings.HasPrefix(encoding, "gzip;") && !strings.HasSuffix(encoding, "q=0") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *RecipesHandler) ExportRecipesHandler(c *gin.Context) {
+	// swagger:operation GET /recipes/export recipes exportRecipes
+	//
+	// Download the published recipes, or those matching the filters, as a
+	// file. The recipes are streamed from the database, and compressed with
+	// gzip if the client accepts it
+	//
+	// ---
+	// parameters:
+	//   - name: format
+	//     in: query
+	//     description: one of json, ndjson, csv, markdown, yaml, defaults to json
+	//     required: false
+	//     type: string
+	//   - name: tag
+	//     in: query
+	//     description: tag of recipes
+	//     required: false
+	//     type: string
+	//   - name: diet
+	//     in: query
+	//     description: comma separated diets the recipes must comply with
+	//     required: false
+	//     type: string
+	//   - name: allergenFree
+	//     in: query
+	//     description: comma separated allergens the recipes must not contain
+	//     required: false
+	//     type: string
+	//   - name: since
+	//     in: query
+	//     description: only recipes published at or after this date or RFC 3339 time
+	//     required: false
+	//     type: string
+	// produces:
+	//   - application/json
+	//   - application/x-ndjson
+	//   - text/csv
+	//   - text/markdown
+	//   - application/yaml
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid format or filter
+
+	name := c.DefaultQuery("format", "json")
+	format, ok := export.Formats[name]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "unknown format " + name + ", expected one of " + strings.Join(export.FormatNames, ", "),
+		})
+
+		return
+	}
+
+	filter, err := searchFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if since := c.Query("since"); since != "" {
+		t, err := parseExportTime(since)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "since must be a date or an RFC 3339 time",
+			})
+
+			return
+		}
+
+		filter["publishedAt"] = bson.M{"$gte": t}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetBatchSize(exportBatchSize)
+
+	cur, err := h.collection.Find(h.ctx, published(filter), opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+	defer cur.Close(h.ctx)
+
+	filename := "recipes-" + time.Now().UTC().Format("2006-01-02") + "." + format.Extension
+	c.Header("Content-Type", format.ContentType)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Vary", "Accept-Encoding")
+
+	var w io.Writer = c.Writer
+	flush := c.Writer.Flush
+	if acceptsGzip(c) {
+		c.Header("Content-Encoding", "gzip")
+
+		gz := gzip.NewWriter(c.Writer)
+		defer gz.Close()
+
+		w = gz
+		flush = func() {
+			_ = gz.Flush()
+			c.Writer.Flush()
+		}
+	}
+
+	c.Status(http.StatusOK)
+
+	// Once streaming has started the status cannot change anymore, so
+	// errors end the response early and are only logged
+	enc := format.NewEncoder(w)
+	if err := enc.Begin(); err != nil {
+		log.Println(err)
+		return
+	}
+
+	count := 0
+	for cur.Next(h.ctx) {
+		var recipe models.Recipe
+		if err := cur.Decode(&recipe); err != nil {
+			log.Println(err)
+			return
+		}
+
+		if err := enc.Encode(&recipe); err != nil {
+			log.Println(err)
+			return
+		}
+
+		if count++; count%exportFlushEvery == 0 {
+			flush()
+		}
+	}
+
+	if err := cur.Err(); err != nil {
+		log.Println(err)
+		return
+	}
+
+	if err := enc.End(); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+type FavoritesHandler struct {
+	ctx               context.Context
+	collection        *mongo.Collection
+	recipesCollection *mongo.Collection
+	redisClient       *redis.Client
+	auditHandler      *AuditHandler
+}
+
+func NewFavoritesHandler(ctx context.Context, collection *mongo.Collection, recipesCollection *mongo.Collection, redisClient *redis.Client, auditHandler *AuditHandler) *FavoritesHandler {
+	return &FavoritesHandler{ctx: ctx, collection: collection, recipesCollection: recipesCollection, redisClient: redisClient, auditHandler: auditHandler}
+}
+
+func (h *FavoritesHandler) CreateIndexes() error {
+	_, err := h.collection.Indexes().CreateMany(h.ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "recipeId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = h.recipesCollection.Indexes().CreateOne(h.ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "favoriteCount", Value: -1}},
+	})
+
+	return err
+}
+
+func (h *FavoritesHandler) updateFavoriteCount(recipeID primitive.ObjectID, delta int) error {
+	if _, err := h.recipesCollection.UpdateOne(h.ctx, bson.M{"_id": recipeID}, bson.M{
+		"$inc": bson.M{"favoriteCount": delta},
+	}); err != nil {
+		return err
+	}
+
+	return h.redisClient.Del(h.ctx, "recipes").Err()
+}
+
+func (h *FavoritesHandler) AddFavoriteHandler(c *gin.Context) {
+	// swagger:operation POST /recipes/{id}/favorite favorites addFavorite
+	//
+	// Add a recipe to the favorites of the authenticated user
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the recipe
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Invalid recipe ID
+
+	recipeID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	count, err := h.recipesCollection.CountDocuments(h.ctx, visible(bson.M{"_id": recipeID}, userID(c)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Recipe not found",
+		})
+
+		return
+	}
+
+	favorite := models.Favorite{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID(c),
+		RecipeID:  recipeID,
+		CreatedAt: time.Now(),
+	}
+
+	if _, err := h.collection.InsertOne(h.ctx, favorite); err != nil {
+		// Favoriting is idempotent
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusOK, gin.H{
+				"message": "Recipe is already a favorite",
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error while inserting favorite",
+		})
+
+		return
+	}
+
+	if err := h.updateFavoriteCount(recipeID, 1); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error while updating favorite count",
+		})
+
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action:   models.AuditFavoriteAdd,
+		RecipeID: &recipeID,
+	}, nil, favorite)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Recipe has been added to favorites",
+	})
+}
+
+func (h *FavoritesHandler) RemoveFavoriteHandler(c *gin.Context) {
+	// swagger:operation DELETE /recipes/{id}/favorite favorites removeFavorite
+	//
+	// Remove a recipe from the favorites of the authenticated user
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the recipe
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Recipe is not a favorite
+
+	recipeID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	res, err := h.collection.DeleteOne(h.ctx, bson.M{"userId": userID(c), "recipeId": recipeID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if res.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Recipe is not a favorite",
+		})
+
+		return
+	}
+
+	if err := h.updateFavoriteCount(recipeID, -1); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error while updating favorite count",
+		})
+
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action:   models.AuditFavoriteRemove,
+		RecipeID: &recipeID,
+	}, nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Recipe has been removed from favorites",
+	})
+}
+
+func (h *FavoritesHandler) ListFavoritesHandler(c *gin.Context) {
+	// swagger:operation GET /me/favorites favorites listFavorites
+	//
+	// Returns favorite recipes of the authenticated user, most recently added first
+	//
+	// ---
+	// parameters:
+	//   - name: page
+	//     in: query
+	//     type: integer
+	//   - name: limit
+	//     in: query
+	//     type: integer
+	// produces:
+	// - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+
+	page, limit := pagination(c)
+
+	cur, err := h.collection.Aggregate(h.ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"userId": userID(c)}}},
+		{{Key: "$sort", Value: bson.M{"createdAt": -1}}},
+		{{Key: "$skip", Value: (page - 1) * limit}},
+		{{Key: "$limit", Value: limit}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         h.recipesCollection.Name(),
+			"localField":   "recipeId",
+			"foreignField": "_id",
+			"as":           "recipe",
+		}}},
+		{{Key: "$unwind", Value: "$recipe"}},
+		{{Key: "$replaceRoot", Value: bson.M{"newRoot": "$recipe"}}},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	recipes := make([]models.Recipe, 0, limit)
+	if err := cur.All(h.ctx, &recipes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, recipes)
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,25 +16,92 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"github.com/harmlessevil/recipes-api/derive"
+	"github.com/harmlessevil/recipes-api/ingredients"
+	"github.com/harmlessevil/recipes-api/media"
 	"github.com/harmlessevil/recipes-api/models"
+	"github.com/harmlessevil/recipes-api/nutrition"
+	"github.com/harmlessevil/recipes-api/schemaorg"
 )
 
 type RecipesHandler struct {
-	ctx         context.Context
-	collection  *mongo.Collection
-	redisClient *redis.Client
+	ctx          context.Context
+	collection   *mongo.Collection
+	redisClient  *redis.Client
+	store        media.BlobStore
+	auditHandler *AuditHandler
 }
 
-func NewRecipesHandler(ctx context.Context, collection *mongo.Collection, redisClient *redis.Client) *RecipesHandler {
-	return &RecipesHandler{ctx: ctx, collection: collection, redisClient: redisClient}
+func NewRecipesHandler(ctx context.Context, collection *mongo.Collection, redisClient *redis.Client, store media.BlobStore, auditHandler *AuditHandler) *RecipesHandler {
+	return &RecipesHandler{ctx: ctx, collection: collection, redisClient: redisClient, store: store, auditHandler: auditHandler}
+}
+
+// published restricts a filter to recipes that are not drafts, which
+// includes recipes stored before drafts existed.
+func published(filter bson.M) bson.M {
+	filter["draft"] = bson.M{"$ne": true}
+
+	return filter
+}
+
+// visible restricts a filter to the recipes uid may see: published recipes
+// and their own drafts. Anonymous callers only see published recipes.
+func visible(filter bson.M, uid string) bson.M {
+	if uid == "" {
+		return published(filter)
+	}
+
+	filter["$or"] = bson.A{
+		bson.M{"draft": bson.M{"$ne": true}},
+		bson.M{"authorId": uid},
+	}
+
+	return filter
+}
+
+func (h *RecipesHandler) CreateIndexes() error {
+	_, err := h.collection.Indexes().CreateMany(h.ctx, []mongo.IndexModel{
+		// External IDs identify recipes of an author in bulk imports
+		{
+			Keys: bson.D{{Key: "authorId", Value: 1}, {Key: "externalId", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+				"externalId": bson.M{"$type": "string"},
+			}),
+		},
+		{Keys: bson.D{{Key: "fingerprint", Value: 1}}},
+	})
+
+	return err
+}
+
+// prepareRecipe sets the fields of a new recipe that clients cannot choose
+// and derives the rest from its ingredients and instructions.
+func prepareRecipe(recipe *models.Recipe, authorID string) {
+	recipe.ID = primitive.NewObjectID()
+	recipe.PublishedAt = time.Now()
+	recipe.AuthorID = authorID
+	recipe.RatingAverage, recipe.RatingCount, recipe.RatingSum = 0, 0, 0
+	recipe.CommentCount, recipe.FavoriteCount = 0, 0
+	recipe.LabelOverrides = nil
+	recipe.Images = []models.RecipeImage{}
+	recipe.Draft = false
+	if recipe.Source != nil {
+		recipe.Source.ImportedAt = recipe.PublishedAt
+	}
+	derive.Recipe(recipe)
 }
 
 func (h *RecipesHandler) NewRecipeHandler(c *gin.Context) {
 	// swagger:operation POST /recipes recipes newRecipe
 	//
-	// Create new recipe
+	// Create new recipe, given as JSON or as a schema.org Recipe in JSON-LD.
+	// The recipe is created even if it likely duplicates existing recipes,
+	// which are listed in possibleDuplicates
 	//
 	// ---
+	// consumes:
+	//   - application/json
+	//   - application/ld+json
 	// produces:
 	//   - application/json
 	// responses:
@@ -41,9 +109,17 @@ func (h *RecipesHandler) NewRecipeHandler(c *gin.Context) {
 	//   description: Successful operation
 	//  '400':
 	//   description: Invalid input
+	//  '409':
+	//   description: Duplicate external ID
 
 	var recipe models.Recipe
-	if err := c.ShouldBindJSON(&recipe); err != nil {
+	var err error
+	if c.ContentType() == schemaorg.MIMEType {
+		recipe, err = decodeJSONLD(c)
+	} else {
+		err = c.ShouldBindJSON(&recipe)
+	}
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": err.Error(),
 		})
@@ -51,10 +127,17 @@ func (h *RecipesHandler) NewRecipeHandler(c *gin.Context) {
 		return
 	}
 
-	recipe.ID = primitive.NewObjectID()
-	recipe.PublishedAt = time.Now()
+	prepareRecipe(&recipe, userID(c))
 
 	if _, err := h.collection.InsertOne(h.ctx, recipe); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "A recipe with this externalId already exists",
+			})
+
+			return
+		}
+
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Error while inserting recipe",
 		})
@@ -62,6 +145,11 @@ func (h *RecipesHandler) NewRecipeHandler(c *gin.Context) {
 		return
 	}
 
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action:   models.AuditRecipeCreate,
+		RecipeID: &recipe.ID,
+	}, nil, recipe)
+
 	log.Println("Remove data from Redis")
 	if err := h.redisClient.Del(h.ctx, "recipes").Err(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -71,26 +159,47 @@ func (h *RecipesHandler) NewRecipeHandler(c *gin.Context) {
 		return
 	}
 
+	recipe.PossibleDuplicates = h.possibleDuplicates(&recipe)
+
 	c.JSON(http.StatusOK, recipe)
 }
 
+// recipeSorts are the orders ListRecipesHandler can return recipes in.
+var recipeSorts = map[string]bson.D{
+	"rating":  {{Key: "ratingAverage", Value: -1}, {Key: "ratingCount", Value: -1}},
+	"popular": {{Key: "favoriteCount", Value: -1}, {Key: "ratingAverage", Value: -1}},
+}
+
 func (h *RecipesHandler) ListRecipesHandler(c *gin.Context) {
 	// swagger:operation GET /recipes recipes listRecipes
 	//
 	// Returns list of recipes
 	//
 	// ---
+	// parameters:
+	//   - name: sort
+	//     in: query
+	//     description: order of recipes, one of rating, popular
+	//     required: false
+	//     type: string
 	// produces:
 	// - application/json
 	// responses:
 	//  '200':
 	//   description: Successful operation
+	//  '400':
+	//   description: Invalid sort order
+
+	if sort := c.Query("sort"); sort != "" {
+		h.listSortedRecipes(c, sort)
+		return
+	}
 
 	val, err := h.redisClient.Get(h.ctx, "recipes").Result()
 	if errors.Is(err, redis.Nil) {
 		//log.Println("Request to MongoDB")
 
-		cur, err := h.collection.Find(h.ctx, bson.M{})
+		cur, err := h.collection.Find(h.ctx, published(bson.M{}))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
@@ -159,10 +268,43 @@ func (h *RecipesHandler) ListRecipesHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, recipes)
 }
 
+// listSortedRecipes bypasses the cache, as it only holds the default order.
+func (h *RecipesHandler) listSortedRecipes(c *gin.Context, sort string) {
+	order, ok := recipeSorts[sort]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Unknown sort order",
+		})
+
+		return
+	}
+
+	cur, err := h.collection.Find(h.ctx, published(bson.M{}), options.Find().SetSort(order))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	recipes := make([]models.Recipe, 0)
+	if err := cur.All(h.ctx, &recipes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, recipes)
+}
+
 func (h *RecipesHandler) GetRecipeHandler(c *gin.Context) {
 	// swagger:operation GET /recipes/{id} recipes getRecipe
 	//
-	// Get an existing recipe
+	// Get an existing recipe, as a schema.org Recipe if JSON-LD is
+	// accepted rather than JSON
 	//
 	// ---
 	// parameters:
@@ -173,6 +315,7 @@ func (h *RecipesHandler) GetRecipeHandler(c *gin.Context) {
 	//     type: string
 	// produces:
 	//   - application/json
+	//   - application/ld+json
 	// responses:
 	//  '200':
 	//   description: Successful operation
@@ -191,7 +334,7 @@ func (h *RecipesHandler) GetRecipeHandler(c *gin.Context) {
 	}
 
 	var recipe models.Recipe
-	if err := h.collection.FindOne(h.ctx, bson.M{"_id": objectID}).Decode(&recipe); err != nil {
+	if err := h.collection.FindOne(h.ctx, visible(bson.M{"_id": objectID}, userID(c))).Decode(&recipe); err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			c.JSON(http.StatusNotFound, gin.H{
 				"error": "Recipe not found",
@@ -207,6 +350,15 @@ func (h *RecipesHandler) GetRecipeHandler(c *gin.Context) {
 		return
 	}
 
+	if c.NegotiateFormat(gin.MIMEJSON, schemaorg.MIMEType) == schemaorg.MIMEType {
+		estimate := nutrition.Calculate(recipe.Ingredients, recipeServings(&recipe))
+
+		c.Header("Content-Type", schemaorg.MIMEType+"; charset=utf-8")
+		c.JSON(http.StatusOK, schemaorg.Encode(recipe, &estimate))
+
+		return
+	}
+
 	c.JSON(http.StatusOK, recipe)
 }
 
@@ -252,16 +404,24 @@ func (h *RecipesHandler) UpdateRecipeHandler(c *gin.Context) {
 		return
 	}
 
-	res, err := h.collection.UpdateOne(h.ctx, bson.M{
-		"_id": objectID,
-	}, bson.D{{
+	var before models.Recipe
+	err = h.collection.FindOneAndUpdate(h.ctx, visible(bson.M{"_id": objectID}, userID(c)), bson.D{{
 		Key: "$set", Value: bson.D{
 			{Key: "name", Value: recipe.Name},
 			{Key: "instructions", Value: recipe.Instructions},
 			{Key: "ingredients", Value: recipe.Ingredients},
+			{Key: "servings", Value: recipe.Servings},
 			{Key: "tags", Value: recipe.Tags},
 		},
-	}})
+	}}).Decode(&before)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "Recipe not found",
+		})
+
+		return
+	}
 
 	if err != nil {
 		log.Println(err)
@@ -273,14 +433,18 @@ func (h *RecipesHandler) UpdateRecipeHandler(c *gin.Context) {
 		return
 	}
 
-	if res.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{
-			"message": "Recipe not found",
-		})
-
-		return
+	var after models.Recipe
+	if err := h.collection.FindOne(h.ctx, bson.M{"_id": objectID}).Decode(&after); err != nil {
+		log.Println(err)
+	} else {
+		h.updateDerivedFields(&after)
 	}
 
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action:   models.AuditRecipeUpdate,
+		RecipeID: &objectID,
+	}, before, after)
+
 	log.Println("Remove data from Redis")
 	if err := h.redisClient.Del(h.ctx, "recipes").Err(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -326,8 +490,16 @@ func (h *RecipesHandler) DeleteRecipeHandler(c *gin.Context) {
 		return
 	}
 
-	res, err := h.collection.DeleteOne(h.ctx, bson.M{"_id": objectID})
-	if err != nil {
+	var before models.Recipe
+	if err := h.collection.FindOneAndDelete(h.ctx, visible(bson.M{"_id": objectID}, userID(c))).Decode(&before); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Recipe not found",
+			})
+
+			return
+		}
+
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
@@ -335,19 +507,64 @@ func (h *RecipesHandler) DeleteRecipeHandler(c *gin.Context) {
 		return
 	}
 
-	if res.DeletedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Recipe not found",
-		})
+	if err := h.redisClient.Del(h.ctx, nutritionKey(objectID)).Err(); err != nil {
+		log.Println(err)
+	}
 
-		return
+	for _, image := range before.Images {
+		deleteBlobs(h.ctx, h.store, image.Variants)
 	}
 
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action:   models.AuditRecipeDelete,
+		RecipeID: &objectID,
+	}, before, nil)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Recipe has been deleted",
 	})
 }
 
+// searchFilter builds a filter from the tag, diet and allergenFree query
+// parameters.
+func searchFilter(c *gin.Context) (bson.M, error) {
+	filter := bson.M{}
+	if tag := c.Query("tag"); tag != "" {
+		filter["tags"] = tag
+	}
+
+	diets, err := parseDiets(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(diets) > 0 {
+		filter["diets"] = bson.M{"$exists": true, "$all": diets}
+	}
+
+	var allergens []string
+	for _, allergen := range strings.Split(c.Query("allergenFree"), ",") {
+		allergen = strings.TrimSpace(strings.ToLower(allergen))
+		if allergen == "" {
+			continue
+		}
+
+		if !ingredients.IsAllergen(allergen) {
+			return nil, errors.New("unknown allergen " + allergen + ", expected one of " + strings.Join(ingredients.Allergens, ", "))
+		}
+
+		allergens = append(allergens, allergen)
+	}
+
+	if len(allergens) > 0 {
+		// Recipes not derived yet have no allergens field, which $nin
+		// alone would match
+		filter["allergens"] = bson.M{"$exists": true, "$nin": allergens}
+	}
+
+	return filter, nil
+}
+
 func (h *RecipesHandler) SearchRecipesHandler(c *gin.Context) {
 	// swagger:operation GET /recipes/search recipes searchRecipe
 	//
@@ -358,15 +575,34 @@ func (h *RecipesHandler) SearchRecipesHandler(c *gin.Context) {
 	//   - name: tag
 	//     in: query
 	//     description: tag of recipes
-	//     required: true
+	//     required: false
+	//     type: string
+	//   - name: diet
+	//     in: query
+	//     description: comma separated diets the recipes must comply with, e.g. vegan,gluten-free
+	//     required: false
+	//     type: string
+	//   - name: allergenFree
+	//     in: query
+	//     description: comma separated allergens the recipes must not contain, e.g. nuts,milk
+	//     required: false
 	//     type: string
 	// produces:
 	//   - application/json
 	// responses:
 	//  '200':
 	//   description: Successful operation
+	//  '400':
+	//   description: Invalid diet or allergen
+
+	filter, err := searchFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
 
-	tag := c.Query("tag")
+		return
+	}
 
 	opts := options.Find().SetCollation(&options.Collation{
 		Locale:        "en_US",
@@ -374,9 +610,7 @@ func (h *RecipesHandler) SearchRecipesHandler(c *gin.Context) {
 		Normalization: true,
 	})
 
-	cur, err := h.collection.Find(h.ctx, bson.M{
-		"tags": tag,
-	}, opts)
+	cur, err := h.collection.Find(h.ctx, published(filter), opts)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
@@ -0,0 +1,500 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/harmlessevil/recipes-api/media"
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+// maxImages bounds the number of images per recipe.
+const maxImages = 20
+
+type ImagesHandler struct {
+	ctx               context.Context
+	recipesCollection *mongo.Collection
+	store             media.BlobStore
+	redisClient       *redis.Client
+	auditHandler      *AuditHandler
+}
+
+func NewImagesHandler(ctx context.Context, recipesCollection *mongo.Collection, store media.BlobStore, redisClient *redis.Client, auditHandler *AuditHandler) *ImagesHandler {
+	return &ImagesHandler{ctx: ctx, recipesCollection: recipesCollection, store: store, redisClient: redisClient, auditHandler: auditHandler}
+}
+
+func imageKey(recipeID primitive.ObjectID, imageID primitive.ObjectID, variant media.Variant) string {
+	return "recipes/" + recipeID.Hex() + "/" + imageID.Hex() + "/" + variant.Name + "." + media.Extension(variant.ContentType)
+}
+
+// deleteBlobs removes the files of image variants, logging failures since
+// a leftover file only wastes space.
+func deleteBlobs(ctx context.Context, store media.BlobStore, variants []models.ImageVariant) {
+	for _, variant := range variants {
+		if err := store.Delete(ctx, variant.Key); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// findOwnRecipe loads a recipe of the current user, writing the error
+// response if there is none.
+func (h *ImagesHandler) findOwnRecipe(c *gin.Context, recipeID primitive.ObjectID) (models.Recipe, bool) {
+	var recipe models.Recipe
+	if err := h.recipesCollection.FindOne(h.ctx, bson.M{"_id": recipeID, "authorId": userID(c)}).Decode(&recipe); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Recipe not found",
+			})
+
+			return recipe, false
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return recipe, false
+	}
+
+	return recipe, true
+}
+
+func (h *ImagesHandler) UploadImageHandler(c *gin.Context) {
+	// swagger:operation POST /recipes/{id}/images recipes uploadImage
+	//
+	// Upload an image of an own recipe as a multipart form. Thumbnail and
+	// medium sized variants are generated as JPEG or PNG, and as WebP when
+	// that is smaller. The first image of a recipe becomes its cover
+	//
+	// ---
+	// consumes:
+	//   - multipart/form-data
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the recipe
+	//     required: true
+	//     type: string
+	//   - name: image
+	//     in: formData
+	//     description: JPEG, PNG, GIF or WebP image of at most 10 MB
+	//     required: true
+	//     type: file
+	// produces:
+	//   - application/json
+	// responses:
+	//  '201':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+	//  '404':
+	//   description: Invalid recipe ID
+	//  '409':
+	//   description: The recipe has too many images
+	//  '413':
+	//   description: The image is too large
+	//  '415':
+	//   description: Unsupported image type
+
+	recipeID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	// Leave room for the rest of the multipart body
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, media.MaxUploadSize+1<<20)
+
+	file, err := c.FormFile("image")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": media.ErrTooLarge.Error(),
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if file.Size > media.MaxUploadSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": media.ErrTooLarge.Error(),
+		})
+
+		return
+	}
+
+	recipe, ok := h.findOwnRecipe(c, recipeID)
+	if !ok {
+		return
+	}
+
+	if len(recipe.Images) >= maxImages {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "A recipe can have at most 20 images",
+		})
+
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	variants, err := media.Process(data)
+	if err != nil {
+		switch {
+		case errors.Is(err, media.ErrTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": err.Error(),
+			})
+		case errors.Is(err, media.ErrUnsupportedType):
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid image: " + err.Error(),
+			})
+		}
+
+		return
+	}
+
+	image := models.RecipeImage{
+		ID:         primitive.NewObjectID(),
+		Cover:      len(recipe.Images) == 0,
+		UploadedBy: userID(c),
+		CreatedAt:  time.Now(),
+	}
+
+	for _, variant := range variants {
+		key := imageKey(recipeID, image.ID, variant)
+		if err := h.store.Put(h.ctx, key, variant.Data, variant.ContentType); err != nil {
+			deleteBlobs(h.ctx, h.store, image.Variants)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error while storing image",
+			})
+
+			return
+		}
+
+		image.Variants = append(image.Variants, models.ImageVariant{
+			Name:        variant.Name,
+			ContentType: variant.ContentType,
+			Width:       variant.Width,
+			Height:      variant.Height,
+			Size:        len(variant.Data),
+			Key:         key,
+			URL:         h.store.URL(key),
+		})
+	}
+
+	// The filter on the last allowed position keeps concurrent uploads
+	// within the limit
+	res, err := h.recipesCollection.UpdateOne(h.ctx, bson.M{
+		"_id":                                 recipeID,
+		"authorId":                            userID(c),
+		"images." + strconv.Itoa(maxImages-1): bson.M{"$exists": false},
+	}, bson.M{
+		"$push": bson.M{"images": image},
+	})
+	if err != nil || res.MatchedCount == 0 {
+		deleteBlobs(h.ctx, h.store, image.Variants)
+
+		if err == nil {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "A recipe can have at most 20 images",
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error while saving image",
+		})
+
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action:   models.AuditImageUpload,
+		RecipeID: &recipeID,
+		Target:   image.ID.Hex(),
+	}, nil, image)
+
+	if err := h.redisClient.Del(h.ctx, "recipes").Err(); err != nil {
+		log.Println(err)
+	}
+
+	c.JSON(http.StatusCreated, image)
+}
+
+func (h *ImagesHandler) DeleteImageHandler(c *gin.Context) {
+	// swagger:operation DELETE /recipes/{id}/images/{imageId} recipes deleteImage
+	//
+	// Delete an image of an own recipe. If it was the cover, the next image
+	// becomes the cover
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the recipe
+	//     required: true
+	//     type: string
+	//   - name: imageId
+	//     in: path
+	//     description: ID of the image
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Invalid recipe or image ID
+
+	recipeID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	imageID, err := primitive.ObjectIDFromHex(c.Param("imageId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	var before models.Recipe
+	if err := h.recipesCollection.FindOneAndUpdate(h.ctx, bson.M{
+		"_id":        recipeID,
+		"authorId":   userID(c),
+		"images._id": imageID,
+	}, bson.M{
+		"$pull": bson.M{"images": bson.M{"_id": imageID}},
+	}).Decode(&before); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Image not found",
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	deleted, _ := findImage(before.Images, imageID)
+
+	if deleted.Cover && len(before.Images) > 1 {
+		if _, err := h.recipesCollection.UpdateOne(h.ctx, bson.M{"_id": recipeID, "images.0": bson.M{"$exists": true}}, bson.M{
+			"$set": bson.M{"images.0.cover": true},
+		}); err != nil {
+			log.Println(err)
+		}
+	}
+
+	deleteBlobs(h.ctx, h.store, deleted.Variants)
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action:   models.AuditImageDelete,
+		RecipeID: &recipeID,
+		Target:   imageID.Hex(),
+	}, deleted, nil)
+
+	if err := h.redisClient.Del(h.ctx, "recipes").Err(); err != nil {
+		log.Println(err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Image has been deleted",
+	})
+}
+
+func (h *ImagesHandler) ReorderImagesHandler(c *gin.Context) {
+	// swagger:operation PUT /recipes/{id}/images/order recipes reorderImages
+	//
+	// Reorder the images of an own recipe and choose its cover
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the recipe
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+	//  '404':
+	//   description: Invalid recipe ID
+	//  '409':
+	//   description: The images changed meanwhile
+
+	recipeID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	var order models.ImageOrder
+	if err := c.ShouldBindJSON(&order); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	recipe, ok := h.findOwnRecipe(c, recipeID)
+	if !ok {
+		return
+	}
+
+	images := make(map[primitive.ObjectID]models.RecipeImage, len(recipe.Images))
+	for _, image := range recipe.Images {
+		images[image.ID] = image
+	}
+
+	if len(order.ImageIDs) != len(images) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "imageIds must list every image of the recipe once",
+		})
+
+		return
+	}
+
+	coverID := order.CoverID
+	if coverID == nil && len(order.ImageIDs) > 0 {
+		coverID = &order.ImageIDs[0]
+	}
+
+	reordered := make([]models.RecipeImage, 0, len(order.ImageIDs))
+	for _, id := range order.ImageIDs {
+		image, ok := images[id]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "imageIds must list every image of the recipe once",
+			})
+
+			return
+		}
+		delete(images, id)
+
+		image.Cover = id == *coverID
+		reordered = append(reordered, image)
+	}
+
+	if coverID != nil {
+		if _, ok := findImage(reordered, *coverID); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "coverId must be one of the images of the recipe",
+			})
+
+			return
+		}
+	}
+
+	// Only replace the images if none were added or removed meanwhile
+	var after models.Recipe
+	if err := h.recipesCollection.FindOneAndUpdate(h.ctx, bson.M{
+		"_id":        recipeID,
+		"images._id": bson.M{"$all": order.ImageIDs},
+		"images":     bson.M{"$size": len(order.ImageIDs)},
+	}, bson.M{
+		"$set": bson.M{"images": reordered},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&after); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "The images of the recipe changed, reload and try again",
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action:   models.AuditImageReorder,
+		RecipeID: &recipeID,
+	}, recipe.Images, after.Images)
+
+	if err := h.redisClient.Del(h.ctx, "recipes").Err(); err != nil {
+		log.Println(err)
+	}
+
+	c.JSON(http.StatusOK, after.Images)
+}
+
+func findImage(images []models.RecipeImage, id primitive.ObjectID) (models.RecipeImage, bool) {
+	for _, image := range images {
+		if image.ID == id {
+			return image, true
+		}
+	}
+
+	return models.RecipeImage{}, false
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/harmlessevil/recipes-api/models"
+	"github.com/harmlessevil/recipes-api/scraper"
+)
+
+type ImportHandler struct {
+	ctx               context.Context
+	recipesCollection *mongo.Collection
+	scraper           *scraper.Client
+	auditHandler      *AuditHandler
+}
+
+func NewImportHandler(ctx context.Context, recipesCollection *mongo.Collection, scraperClient *scraper.Client, auditHandler *AuditHandler) *ImportHandler {
+	return &ImportHandler{ctx: ctx, recipesCollection: recipesCollection, scraper: scraperClient, auditHandler: auditHandler}
+}
+
+// insertDraft stores an imported recipe as a draft of the current user.
+func (h *ImportHandler) insertDraft(c *gin.Context, recipe *models.Recipe) error {
+	if recipe.Source == nil {
+		recipe.Source = &models.RecipeSource{}
+	}
+	prepareRecipe(recipe, userID(c))
+	recipe.Draft = true
+
+	if _, err := h.recipesCollection.InsertOne(h.ctx, recipe); err != nil {
+		return err
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action:   models.AuditRecipeImport,
+		RecipeID: &recipe.ID,
+	}, nil, recipe)
+
+	return nil
+}
+
+func (h *ImportHandler) ImportRecipeHandler(c *gin.Context) {
+	// swagger:operation POST /recipes/import recipes importRecipe
+	//
+	// Import a recipe from a web page, given by its URL or its HTML. The
+	// schema.org Recipe embedded as JSON-LD or microdata is used if there
+	// is one, otherwise the ingredients and instructions are guessed from
+	// the markup. The recipe is saved as a draft, attributed to the page,
+	// to be reviewed and published by the user
+	//
+	// ---
+	// produces:
+	//   - application/json
+	// responses:
+	//  '201':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+	//  '422':
+	//   description: No recipe found in the page
+	//  '502':
+	//   description: The page could not be fetched
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, 2*scraper.DefaultMaxSize)
+
+	var request models.RecipeImport
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if (request.URL == "") == (request.HTML == "") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Either url or html is required",
+		})
+
+		return
+	}
+
+	var recipe models.Recipe
+	var err error
+	if request.HTML != "" {
+		if request.URL != "" {
+			if _, err := scraper.ParseURL(request.URL); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": err.Error(),
+				})
+
+				return
+			}
+		}
+
+		recipe, err = scraper.Extract([]byte(request.HTML), request.URL)
+	} else {
+		recipe, err = h.scraper.Import(h.ctx, request.URL)
+	}
+
+	if err != nil {
+		var fetchErr *scraper.FetchError
+		switch {
+		case errors.Is(err, scraper.ErrInvalidURL), errors.Is(err, scraper.ErrBlockedTarget):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+		case errors.Is(err, scraper.ErrNoRecipe), errors.Is(err, scraper.ErrNotHTML):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": err.Error(),
+			})
+		case errors.As(err, &fetchErr):
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		}
+
+		return
+	}
+
+	if err := h.insertDraft(c, &recipe); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error while inserting recipe",
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusCreated, recipe)
+}
+
+func (h *RecipesHandler) ListDraftsHandler(c *gin.Context) {
+	// swagger:operation GET /me/drafts recipes listDrafts
+	//
+	// Returns the draft recipes of the authenticated user, most recently
+	// imported first
+	//
+	// ---
+	// parameters:
+	//   - name: page
+	//     in: query
+	//     type: integer
+	//   - name: limit
+	//     in: query
+	//     type: integer
+	// produces:
+	// - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+
+	page, limit := pagination(c)
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "publishedAt", Value: -1}}).
+		SetSkip((page - 1) * limit).
+		SetLimit(limit)
+
+	cur, err := h.collection.Find(h.ctx, bson.M{"authorId": userID(c), "draft": true}, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	recipes := make([]models.Recipe, 0, limit)
+	if err := cur.All(h.ctx, &recipes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, recipes)
+}
+
+func (h *RecipesHandler) PublishRecipeHandler(c *gin.Context) {
+	// swagger:operation POST /recipes/{id}/publish recipes publishRecipe
+	//
+	// Publish an own draft recipe, listing it to everyone
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the recipe
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Invalid recipe ID or not a draft
+
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	var recipe models.Recipe
+	if err := h.collection.FindOneAndUpdate(h.ctx, bson.M{
+		"_id":      objectID,
+		"authorId": userID(c),
+		"draft":    true,
+	}, bson.M{
+		"$set":   bson.M{"publishedAt": time.Now()},
+		"$unset": bson.M{"draft": ""},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&recipe); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Draft not found",
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action:   models.AuditRecipePublish,
+		RecipeID: &objectID,
+	}, nil, recipe)
+
+	if err := h.redisClient.Del(h.ctx, "recipes").Err(); err != nil {
+		log.Println(err)
+	}
+
+	c.JSON(http.StatusOK, recipe)
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"io"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/harmlessevil/recipes-api/models"
+	"github.com/harmlessevil/recipes-api/schemaorg"
+)
+
+// maxJSONLDSize bounds JSON-LD request bodies, which are read whole.
+const maxJSONLDSize = 1 << 20
+
+// decodeJSONLD reads a schema.org Recipe from the request body.
+func decodeJSONLD(c *gin.Context) (models.Recipe, error) {
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxJSONLDSize))
+	if err != nil {
+		return models.Recipe{}, err
+	}
+
+	return schemaorg.Decode(data)
+}
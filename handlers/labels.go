@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/harmlessevil/recipes-api/derive"
+	"github.com/harmlessevil/recipes-api/ingredients"
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+func validOverrides(overrides map[string]bool, valid func(string) bool, names []string) error {
+	for label := range overrides {
+		if !valid(label) {
+			return errors.New("unknown label " + label + ", expected one of " + strings.Join(names, ", "))
+		}
+	}
+
+	return nil
+}
+
+func (h *RecipesHandler) OverrideLabelsHandler(c *gin.Context) {
+	// swagger:operation PUT /recipes/{id}/labels recipes overrideLabels
+	//
+	// Override the diets and allergens derived from the ingredients of an
+	// own recipe. Labels mapped to true are always set, labels mapped to
+	// false never are; labels left out are derived again
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the recipe
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+	//  '404':
+	//   description: Invalid recipe ID
+
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	var overrides models.LabelOverrides
+	if err := c.ShouldBindJSON(&overrides); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if err := validOverrides(overrides.Diets, ingredients.IsDiet, ingredients.Diets); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if err := validOverrides(overrides.Allergens, ingredients.IsAllergen, ingredients.Allergens); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	var before models.Recipe
+	if err := h.collection.FindOne(h.ctx, bson.M{"_id": objectID, "authorId": userID(c)}).Decode(&before); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Recipe not found",
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	after := before
+	after.LabelOverrides = &overrides
+	if len(overrides.Diets) == 0 && len(overrides.Allergens) == 0 {
+		after.LabelOverrides = nil
+	}
+	derive.Labels(&after)
+
+	if _, err := h.collection.UpdateOne(h.ctx, bson.M{"_id": objectID}, bson.M{
+		"$set": bson.M{
+			"labelOverrides": after.LabelOverrides,
+			"diets":          after.Diets,
+			"allergens":      after.Allergens,
+		},
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error while updating labels",
+		})
+
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action:   models.AuditRecipeLabels,
+		RecipeID: &objectID,
+	}, before, after)
+
+	if err := h.redisClient.Del(h.ctx, "recipes").Err(); err != nil {
+		log.Println(err)
+	}
+
+	c.JSON(http.StatusOK, after)
+}
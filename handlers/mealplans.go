@@ -0,0 +1,560 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+var (
+	isoWeekPattern = regexp.MustCompile(`^(\d{4})-W(\d{2})$`)
+
+	weekdays = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+	meals    = []string{models.MealBreakfast, models.MealLunch, models.MealDinner, models.MealSnack}
+)
+
+// parseISOWeek returns the Monday of an ISO 8601 week such as 2023-W18.
+func parseISOWeek(week string) (time.Time, error) {
+	match := isoWeekPattern.FindStringSubmatch(week)
+	if match == nil {
+		return time.Time{}, fmt.Errorf("invalid week %q, expected e.g. 2023-W18", week)
+	}
+
+	year, _ := strconv.Atoi(match[1])
+	number, _ := strconv.Atoi(match[2])
+
+	// January 4th is always in the first ISO week
+	jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, time.UTC)
+	monday := jan4.AddDate(0, 0, -(int(jan4.Weekday())+6)%7+(number-1)*7)
+
+	if y, w := monday.ISOWeek(); y != year || w != number {
+		return time.Time{}, fmt.Errorf("year %d has no week %d", year, number)
+	}
+
+	return monday, nil
+}
+
+func formatISOWeek(t time.Time) string {
+	year, week := t.ISOWeek()
+	return fmt.Sprintf("%04d-W%02d", year, week)
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func sortSlots(slots []models.MealSlot) {
+	sort.Slice(slots, func(i, j int) bool {
+		if slots[i].Day != slots[j].Day {
+			return indexOf(weekdays, slots[i].Day) < indexOf(weekdays, slots[j].Day)
+		}
+
+		return indexOf(meals, slots[i].Meal) < indexOf(meals, slots[j].Meal)
+	})
+}
+
+func slotIndex(plan *models.MealPlan, day string, meal string) int {
+	for i, slot := range plan.Slots {
+		if slot.Day == day && slot.Meal == meal {
+			return i
+		}
+	}
+
+	return -1
+}
+
+type slotPosition struct {
+	Day  string `json:"day" binding:"required"`
+	Meal string `json:"meal" binding:"required"`
+}
+
+func validSlot(day string, meal string) error {
+	if indexOf(weekdays, day) < 0 {
+		return fmt.Errorf("invalid day %q", day)
+	}
+
+	if indexOf(meals, meal) < 0 {
+		return fmt.Errorf("invalid meal %q", meal)
+	}
+
+	return nil
+}
+
+type MealPlansHandler struct {
+	ctx               context.Context
+	collection        *mongo.Collection
+	recipesCollection *mongo.Collection
+	auditHandler      *AuditHandler
+}
+
+func NewMealPlansHandler(ctx context.Context, collection *mongo.Collection, recipesCollection *mongo.Collection, auditHandler *AuditHandler) *MealPlansHandler {
+	return &MealPlansHandler{ctx: ctx, collection: collection, recipesCollection: recipesCollection, auditHandler: auditHandler}
+}
+
+func (h *MealPlansHandler) CreateIndexes() error {
+	_, err := h.collection.Indexes().CreateOne(h.ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "week", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+
+	return err
+}
+
+// loadMealPlan returns the plan of the user for week, or an
+// empty plan if nothing has been planned yet.
+func (h *MealPlansHandler) loadMealPlan(uid string, week string) (*models.MealPlan, error) {
+	var plan models.MealPlan
+	err := h.collection.FindOne(h.ctx, bson.M{"userId": uid, "week": week}).Decode(&plan)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &models.MealPlan{
+			ID:        primitive.NewObjectID(),
+			UserID:    uid,
+			Week:      week,
+			Slots:     []models.MealSlot{},
+			CreatedAt: time.Now(),
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &plan, nil
+}
+
+// mealPlan loads the plan for the week in the path, responding with an error
+// if the week is invalid.
+func (h *MealPlansHandler) mealPlan(c *gin.Context) (*models.MealPlan, time.Time, bool) {
+	week := c.Param("week")
+
+	monday, err := parseISOWeek(week)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return nil, time.Time{}, false
+	}
+
+	plan, err := h.loadMealPlan(userID(c), week)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return nil, time.Time{}, false
+	}
+
+	return plan, monday, true
+}
+
+// editMealPlan copies a plan with its slots, so that the copy can be
+// changed while the plan is kept for the audit log.
+func editMealPlan(plan *models.MealPlan) *models.MealPlan {
+	edited := *plan
+	edited.Slots = append([]models.MealSlot{}, plan.Slots...)
+
+	return &edited
+}
+
+// saveMealPlan replaces the plan and records the change. Like cookbooks,
+// the plan is only replaced if it has not changed since before was read,
+// and only inserted if it did not exist yet.
+func (h *MealPlansHandler) saveMealPlan(c *gin.Context, before *models.MealPlan, after *models.MealPlan) {
+	sortSlots(after.Slots)
+	after.UpdatedAt = time.Now()
+
+	var err error
+	conflict := false
+	if before.UpdatedAt.IsZero() {
+		_, err = h.collection.InsertOne(h.ctx, after)
+		if mongo.IsDuplicateKeyError(err) {
+			conflict, err = true, nil
+		}
+	} else {
+		var res *mongo.UpdateResult
+		res, err = h.collection.ReplaceOne(h.ctx, bson.M{
+			"_id":       after.ID,
+			"updatedAt": before.UpdatedAt,
+		}, after)
+		conflict = err == nil && res.MatchedCount == 0
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error while saving meal plan",
+		})
+
+		return
+	}
+
+	if conflict {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Meal plan has been changed concurrently, please retry",
+		})
+
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action: models.AuditMealPlanUpdate,
+		Target: after.ID.Hex(),
+	}, before, after)
+
+	c.JSON(http.StatusOK, after)
+}
+
+func (h *MealPlansHandler) GetMealPlanHandler(c *gin.Context) {
+	// swagger:operation GET /mealplans/{week} mealPlans getMealPlan
+	//
+	// Get the meal plan of the authenticated user for an ISO week
+	//
+	// ---
+	// parameters:
+	//   - name: week
+	//     in: path
+	//     description: ISO 8601 week, e.g. 2023-W18
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid week
+
+	plan, _, ok := h.mealPlan(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+func (h *MealPlansHandler) FillSlotHandler(c *gin.Context) {
+	// swagger:operation PUT /mealplans/{week}/slots/{day}/{meal} mealPlans fillSlot
+	//
+	// Plan a recipe for a meal, replacing whatever was planned before
+	//
+	// ---
+	// parameters:
+	//   - name: week
+	//     in: path
+	//     description: ISO 8601 week, e.g. 2023-W18
+	//     required: true
+	//     type: string
+	//   - name: day
+	//     in: path
+	//     description: day of the week, from monday to sunday
+	//     required: true
+	//     type: string
+	//   - name: meal
+	//     in: path
+	//     description: one of breakfast, lunch, dinner, snack
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+	//  '404':
+	//   description: Invalid recipe ID
+	//  '409':
+	//   description: Meal plan changed concurrently
+
+	day, meal := c.Param("day"), c.Param("meal")
+	if err := validSlot(day, meal); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	var body struct {
+		RecipeID primitive.ObjectID `json:"recipeId" binding:"required"`
+		Servings int                `json:"servings" binding:"omitempty,min=1,max=100"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if body.Servings == 0 {
+		body.Servings = 1
+	}
+
+	count, err := h.recipesCollection.CountDocuments(h.ctx, visible(bson.M{"_id": body.RecipeID}, userID(c)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Recipe not found",
+		})
+
+		return
+	}
+
+	before, monday, ok := h.mealPlan(c)
+	if !ok {
+		return
+	}
+	plan := editMealPlan(before)
+
+	slot := models.MealSlot{
+		Day:      day,
+		Date:     monday.AddDate(0, 0, indexOf(weekdays, day)).Format(time.DateOnly),
+		Meal:     meal,
+		RecipeID: body.RecipeID,
+		Servings: body.Servings,
+	}
+
+	if i := slotIndex(plan, day, meal); i >= 0 {
+		plan.Slots[i] = slot
+	} else {
+		plan.Slots = append(plan.Slots, slot)
+	}
+
+	h.saveMealPlan(c, before, plan)
+}
+
+func (h *MealPlansHandler) ClearSlotHandler(c *gin.Context) {
+	// swagger:operation DELETE /mealplans/{week}/slots/{day}/{meal} mealPlans clearSlot
+	//
+	// Clear a planned meal
+	//
+	// ---
+	// parameters:
+	//   - name: week
+	//     in: path
+	//     description: ISO 8601 week, e.g. 2023-W18
+	//     required: true
+	//     type: string
+	//   - name: day
+	//     in: path
+	//     description: day of the week, from monday to sunday
+	//     required: true
+	//     type: string
+	//   - name: meal
+	//     in: path
+	//     description: one of breakfast, lunch, dinner, snack
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+	//  '404':
+	//   description: Nothing is planned for the meal
+	//  '409':
+	//   description: Meal plan changed concurrently
+
+	day, meal := c.Param("day"), c.Param("meal")
+	if err := validSlot(day, meal); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	before, _, ok := h.mealPlan(c)
+	if !ok {
+		return
+	}
+	plan := editMealPlan(before)
+
+	i := slotIndex(plan, day, meal)
+	if i < 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Nothing is planned for this meal",
+		})
+
+		return
+	}
+
+	plan.Slots = append(plan.Slots[:i], plan.Slots[i+1:]...)
+
+	h.saveMealPlan(c, before, plan)
+}
+
+func (h *MealPlansHandler) MoveSlotHandler(c *gin.Context) {
+	// swagger:operation POST /mealplans/{week}/move mealPlans moveSlot
+	//
+	// Move a planned meal to another slot of the week. If the target slot is
+	// planned too, the two are swapped
+	//
+	// ---
+	// parameters:
+	//   - name: week
+	//     in: path
+	//     description: ISO 8601 week, e.g. 2023-W18
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+	//  '404':
+	//   description: Nothing is planned for the source slot
+	//  '409':
+	//   description: Meal plan changed concurrently
+
+	var body struct {
+		From slotPosition `json:"from" binding:"required"`
+		To   slotPosition `json:"to" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	for _, position := range []slotPosition{body.From, body.To} {
+		if err := validSlot(position.Day, position.Meal); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+
+			return
+		}
+	}
+
+	before, monday, ok := h.mealPlan(c)
+	if !ok {
+		return
+	}
+	plan := editMealPlan(before)
+
+	from := slotIndex(plan, body.From.Day, body.From.Meal)
+	if from < 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Nothing is planned for the source slot",
+		})
+
+		return
+	}
+
+	move := func(i int, position slotPosition) {
+		plan.Slots[i].Day = position.Day
+		plan.Slots[i].Meal = position.Meal
+		plan.Slots[i].Date = monday.AddDate(0, 0, indexOf(weekdays, position.Day)).Format(time.DateOnly)
+	}
+
+	if to := slotIndex(plan, body.To.Day, body.To.Meal); to >= 0 {
+		move(to, body.From)
+	}
+	move(from, body.To)
+
+	h.saveMealPlan(c, before, plan)
+}
+
+func (h *MealPlansHandler) CopyMealPlanHandler(c *gin.Context) {
+	// swagger:operation POST /mealplans/{week}/copy mealPlans copyMealPlan
+	//
+	// Replace the plan of a week with a copy of another week, by default the
+	// previous one
+	//
+	// ---
+	// parameters:
+	//   - name: week
+	//     in: path
+	//     description: ISO 8601 week, e.g. 2023-W18
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid week
+	//  '409':
+	//   description: Meal plan changed concurrently
+
+	var body struct {
+		FromWeek string `json:"fromWeek"`
+	}
+	// The body is optional
+	if err := c.ShouldBindJSON(&body); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	before, monday, ok := h.mealPlan(c)
+	if !ok {
+		return
+	}
+	plan := editMealPlan(before)
+
+	if body.FromWeek == "" {
+		body.FromWeek = formatISOWeek(monday.AddDate(0, 0, -7))
+	}
+
+	if _, err := parseISOWeek(body.FromWeek); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	source, err := h.loadMealPlan(plan.UserID, body.FromWeek)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	plan.Slots = make([]models.MealSlot, len(source.Slots))
+	for i, slot := range source.Slots {
+		slot.Date = monday.AddDate(0, 0, indexOf(weekdays, slot.Day)).Format(time.DateOnly)
+		plan.Slots[i] = slot
+	}
+
+	h.saveMealPlan(c, before, plan)
+}
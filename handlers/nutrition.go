@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/harmlessevil/recipes-api/models"
+	"github.com/harmlessevil/recipes-api/nutrition"
+)
+
+// nutritionTTL bounds how long an estimate outlives changes to the bundled
+// nutrient table.
+const nutritionTTL = 24 * time.Hour
+
+func nutritionKey(recipeID primitive.ObjectID) string {
+	return "recipes:" + recipeID.Hex() + ":nutrition"
+}
+
+// cacheNutrition estimates the nutrients of a recipe and caches the result.
+func cacheNutrition(ctx context.Context, redisClient *redis.Client, recipe *models.Recipe) (nutrition.Estimate, error) {
+	estimate := nutrition.Calculate(recipe.Ingredients, recipeServings(recipe))
+
+	data, err := json.Marshal(estimate)
+	if err != nil {
+		return estimate, err
+	}
+
+	return estimate, redisClient.Set(ctx, nutritionKey(recipe.ID), data, nutritionTTL).Err()
+}
+
+type NutritionHandler struct {
+	ctx               context.Context
+	recipesCollection *mongo.Collection
+	redisClient       *redis.Client
+}
+
+func NewNutritionHandler(ctx context.Context, recipesCollection *mongo.Collection, redisClient *redis.Client) *NutritionHandler {
+	return &NutritionHandler{ctx: ctx, recipesCollection: recipesCollection, redisClient: redisClient}
+}
+
+func (h *NutritionHandler) GetNutritionHandler(c *gin.Context) {
+	// swagger:operation GET /recipes/{id}/nutrition recipes getNutrition
+	//
+	// Estimate calories, macronutrients and key micronutrients of a recipe,
+	// in total and per serving
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the recipe
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Invalid recipe ID
+
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	var recipe models.Recipe
+	if err := h.recipesCollection.FindOne(h.ctx, visible(bson.M{"_id": objectID}, userID(c))).Decode(&recipe); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Recipe not found",
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	val, err := h.redisClient.Get(h.ctx, nutritionKey(objectID)).Bytes()
+	if err == nil {
+		var estimate nutrition.Estimate
+		if err := json.Unmarshal(val, &estimate); err == nil {
+			c.JSON(http.StatusOK, estimate)
+			return
+		}
+	} else if !errors.Is(err, redis.Nil) {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	estimate, err := cacheNutrition(h.ctx, h.redisClient, &recipe)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, estimate)
+}
@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/harmlessevil/recipes-api/ingredients"
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+// staples are assumed to be in every kitchen, whether in the pantry or not.
+var staples = map[string]bool{
+	"water": true,
+	"ice":   true,
+	"salt":  true,
+}
+
+type PantryHandler struct {
+	ctx               context.Context
+	collection        *mongo.Collection
+	recipesCollection *mongo.Collection
+	auditHandler      *AuditHandler
+}
+
+func NewPantryHandler(ctx context.Context, collection *mongo.Collection, recipesCollection *mongo.Collection, auditHandler *AuditHandler) *PantryHandler {
+	return &PantryHandler{ctx: ctx, collection: collection, recipesCollection: recipesCollection, auditHandler: auditHandler}
+}
+
+func (h *PantryHandler) CreateIndexes() error {
+	_, err := h.collection.Indexes().CreateOne(h.ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+
+	return err
+}
+
+func (h *PantryHandler) listPantry(uid string) ([]models.PantryItem, error) {
+	cur, err := h.collection.Find(h.ctx, bson.M{"userId": uid}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]models.PantryItem, 0)
+	if err := cur.All(h.ctx, &items); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// onHand reports whether an ingredient is covered by the pantry. A pantry
+// item also covers more specific ingredients, so "flour" covers
+// "all-purpose flour".
+func onHand(pantry map[string]bool, name string) bool {
+	if staples[name] || pantry[name] {
+		return true
+	}
+
+	for i := strings.IndexByte(name, ' '); i >= 0; i = strings.IndexByte(name, ' ') {
+		name = name[i+1:]
+		if pantry[name] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *PantryHandler) ListPantryHandler(c *gin.Context) {
+	// swagger:operation GET /pantry pantry listPantry
+	//
+	// Returns the pantry of the authenticated user
+	//
+	// ---
+	// produces:
+	// - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+
+	items, err := h.listPantry(userID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, items)
+}
+
+func (h *PantryHandler) AddPantryItemHandler(c *gin.Context) {
+	// swagger:operation POST /pantry pantry addPantryItem
+	//
+	// Add an item to the pantry of the authenticated user. Adding an item
+	// that is already in the pantry updates its quantity
+	//
+	// ---
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+
+	var body models.PantryItem
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	name := ingredients.Normalize(body.Label)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid ingredient name",
+		})
+
+		return
+	}
+
+	now := time.Now()
+
+	var item models.PantryItem
+	err := h.collection.FindOneAndUpdate(h.ctx, bson.M{"userId": userID(c), "name": name}, bson.M{
+		"$set": bson.M{
+			"label":     strings.TrimSpace(body.Label),
+			"quantity":  body.Quantity,
+			"unit":      body.Unit,
+			"updatedAt": now,
+		},
+		"$setOnInsert": bson.M{
+			"_id":       primitive.NewObjectID(),
+			"createdAt": now,
+		},
+	}, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&item)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error while saving pantry item",
+		})
+
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action: models.AuditPantryAdd,
+		Target: item.ID.Hex(),
+	}, nil, item)
+
+	c.JSON(http.StatusOK, item)
+}
+
+func (h *PantryHandler) DeletePantryItemHandler(c *gin.Context) {
+	// swagger:operation DELETE /pantry/{id} pantry deletePantryItem
+	//
+	// Remove an item from the pantry of the authenticated user
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the pantry item
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Invalid pantry item ID
+
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	res, err := h.collection.DeleteOne(h.ctx, bson.M{"_id": objectID, "userId": userID(c)})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if res.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Pantry item not found",
+		})
+
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action: models.AuditPantryRemove,
+		Target: objectID.Hex(),
+	}, nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Pantry item has been deleted",
+	})
+}
+
+type cookableRecipe struct {
+	Recipe models.Recipe `json:"recipe"`
+	// Score is the fraction of ingredients on hand, from 0 to 1
+	Score   float64  `json:"score"`
+	OnHand  int      `json:"onHand"`
+	Total   int      `json:"total"`
+	Missing []string `json:"missing"`
+}
+
+func (h *PantryHandler) CookableRecipesHandler(c *gin.Context) {
+	// swagger:operation GET /recipes/cookable pantry cookableRecipes
+	//
+	// Returns recipes ranked by the fraction of their ingredients in the
+	// pantry of the authenticated user, with the ingredients still missing
+	//
+	// ---
+	// parameters:
+	//   - name: page
+	//     in: query
+	//     type: integer
+	//   - name: limit
+	//     in: query
+	//     type: integer
+	// produces:
+	// - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+
+	items, err := h.listPantry(userID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	pantry := make(map[string]bool, len(items))
+	for _, item := range items {
+		pantry[item.Name] = true
+	}
+
+	cur, err := h.recipesCollection.Find(h.ctx, published(bson.M{}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+	defer cur.Close(h.ctx)
+
+	ranked := make([]cookableRecipe, 0)
+	for cur.Next(h.ctx) {
+		var recipe models.Recipe
+		if err := cur.Decode(&recipe); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+
+			return
+		}
+
+		cookable := cookableRecipe{Recipe: recipe, Missing: []string{}}
+
+		seen := map[string]bool{}
+		for _, ingredient := range ingredients.ParseAll(recipe.Ingredients) {
+			if seen[ingredient.Name] {
+				continue
+			}
+			seen[ingredient.Name] = true
+
+			cookable.Total++
+			if onHand(pantry, ingredient.Name) {
+				cookable.OnHand++
+			} else {
+				cookable.Missing = append(cookable.Missing, ingredient.Name)
+			}
+		}
+
+		if cookable.OnHand == 0 {
+			continue
+		}
+
+		cookable.Score = ingredients.Round(float64(cookable.OnHand) / float64(cookable.Total))
+		ranked = append(ranked, cookable)
+	}
+	if err := cur.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+
+		return len(ranked[i].Missing) < len(ranked[j].Missing)
+	})
+
+	page, limit := pagination(c)
+
+	start := (page - 1) * limit
+	if start > int64(len(ranked)) {
+		start = int64(len(ranked))
+	}
+
+	end := start + limit
+	if end > int64(len(ranked)) {
+		end = int64(len(ranked))
+	}
+
+	c.JSON(http.StatusOK, ranked[start:end])
+}
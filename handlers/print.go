@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/harmlessevil/recipes-api/media"
+	"github.com/harmlessevil/recipes-api/models"
+	"github.com/harmlessevil/recipes-api/nutrition"
+	"github.com/harmlessevil/recipes-api/printable"
+)
+
+// maxCookbookPrintRecipes bounds the recipes printed at once, as the PDF is
+// rendered in memory.
+const maxCookbookPrintRecipes = 100
+
+type PrintHandler struct {
+	ctx               context.Context
+	recipesCollection *mongo.Collection
+	cookbooksHandler  *CookbooksHandler
+	store             media.BlobStore
+}
+
+func NewPrintHandler(ctx context.Context, recipesCollection *mongo.Collection, cookbooksHandler *CookbooksHandler, store media.BlobStore) *PrintHandler {
+	return &PrintHandler{ctx: ctx, recipesCollection: recipesCollection, cookbooksHandler: cookbooksHandler, store: store}
+}
+
+// printOptions reads the format and paper size of a print request.
+func printOptions(c *gin.Context) (string, bool) {
+	if format := c.DefaultQuery("format", "pdf"); format != "pdf" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "unknown format " + format + ", expected pdf",
+		})
+
+		return "", false
+	}
+
+	paper := c.DefaultQuery("paper", "a4")
+	if _, ok := printable.Papers[paper]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "unknown paper " + paper + ", expected a4 or letter",
+		})
+
+		return "", false
+	}
+
+	return paper, true
+}
+
+// fileName turns a name into a file name of lowercase letters, digits and
+// dashes.
+func fileName(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+
+	if b.Len() == 0 {
+		return "recipe"
+	}
+
+	return b.String()
+}
+
+// coverImage loads the cover of a recipe in its medium size, preferring
+// encodings other than WebP. Recipes without images or whose cover cannot
+// be loaded are printed without one.
+func (h *PrintHandler) coverImage(recipe *models.Recipe) []byte {
+	if len(recipe.Images) == 0 {
+		return nil
+	}
+
+	cover := recipe.Images[0]
+	for _, image := range recipe.Images {
+		if image.Cover {
+			cover = image
+		}
+	}
+	if len(cover.Variants) == 0 {
+		return nil
+	}
+
+	variant := cover.Variants[0]
+	for _, v := range cover.Variants {
+		if v.Name == "medium" && v.ContentType != "image/webp" {
+			variant = v
+			break
+		}
+	}
+
+	data, err := h.store.Get(h.ctx, variant.Key)
+	if err != nil {
+		log.Println("Error while loading image for printing:", err)
+		return nil
+	}
+
+	return data
+}
+
+func (h *PrintHandler) card(recipe models.Recipe, note string) printable.Card {
+	estimate := nutrition.Calculate(recipe.Ingredients, recipeServings(&recipe))
+
+	return printable.Card{
+		Recipe:    recipe,
+		Image:     h.coverImage(&recipe),
+		Nutrition: &estimate,
+		Note:      note,
+	}
+}
+
+func (h *PrintHandler) PrintRecipeHandler(c *gin.Context) {
+	// swagger:operation GET /recipes/{id}/print recipes printRecipe
+	//
+	// Print a recipe as a card with its cover, ingredients, numbered steps
+	// and nutrition per serving
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the recipe
+	//     required: true
+	//     type: string
+	//   - name: format
+	//     in: query
+	//     description: pdf, the default and only format
+	//     required: false
+	//     type: string
+	//   - name: paper
+	//     in: query
+	//     description: a4, the default, or letter
+	//     required: false
+	//     type: string
+	// produces:
+	//   - application/pdf
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid format or paper
+	//  '404':
+	//   description: Invalid recipe ID
+
+	paper, ok := printOptions(c)
+	if !ok {
+		return
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	var recipe models.Recipe
+	if err := h.recipesCollection.FindOne(h.ctx, visible(bson.M{"_id": objectID}, userID(c))).Decode(&recipe); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Recipe not found",
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	var b bytes.Buffer
+	if err := printable.WriteCard(&b, h.card(recipe, ""), paper); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	c.Header("Content-Disposition", `inline; filename="`+fileName(recipe.Name)+`.pdf"`)
+	c.Data(http.StatusOK, "application/pdf", b.Bytes())
+}
+
+func (h *PrintHandler) PrintCookbookHandler(c *gin.Context) {
+	// swagger:operation GET /cookbooks/{id}/print cookbooks printCookbook
+	//
+	// Print an own or public cookbook with a table of contents, each
+	// recipe as a card together with the note of the owner
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the cookbook
+	//     required: true
+	//     type: string
+	//   - name: format
+	//     in: query
+	//     description: pdf, the default and only format
+	//     required: false
+	//     type: string
+	//   - name: paper
+	//     in: query
+	//     description: a4, the default, or letter
+	//     required: false
+	//     type: string
+	// produces:
+	//   - application/pdf
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid format or paper, or too many recipes
+	//  '404':
+	//   description: Invalid cookbook ID
+
+	paper, ok := printOptions(c)
+	if !ok {
+		return
+	}
+
+	cookbook, ok := h.cookbooksHandler.findCookbook(c, true)
+	if !ok {
+		return
+	}
+
+	if len(cookbook.Recipes) > maxCookbookPrintRecipes {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "cannot print more than " + strconv.Itoa(maxCookbookPrintRecipes) + " recipes at once",
+		})
+
+		return
+	}
+
+	recipes, err := h.cookbooksHandler.cookbookRecipes(cookbook, userID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	notes := make(map[primitive.ObjectID]string, len(cookbook.Recipes))
+	for _, entry := range cookbook.Recipes {
+		notes[entry.RecipeID] = entry.Note
+	}
+
+	book := printable.Cookbook{Title: cookbook.Name, Description: cookbook.Description}
+	for _, recipe := range recipes {
+		book.Cards = append(book.Cards, h.card(recipe, notes[recipe.ID]))
+	}
+
+	var b bytes.Buffer
+	if err := printable.WriteCookbook(&b, book, paper); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	c.Header("Content-Disposition", `inline; filename="`+fileName(cookbook.Name)+`.pdf"`)
+	c.Data(http.StatusOK, "application/pdf", b.Bytes())
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// tokenBucketScript refills the bucket according to the time elapsed since the
+// previous request and takes one token from it if available. It returns
+// whether the request is allowed and the number of tokens left.
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(bucket[1]) or capacity
+local ts = tonumber(bucket[2]) or now
+
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate / 1000)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call("HSET", KEYS[1], "tokens", tokens, "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(capacity / rate * 1000))
+
+return {allowed, tostring(tokens)}
+`)
+
+// RateLimit allows bursts of up to Requests requests, refilled evenly over Period.
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+}
+
+func (l RateLimit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+type RateLimiter struct {
+	ctx         context.Context
+	redisClient *redis.Client
+	read        RateLimit
+	write       RateLimit
+}
+
+func NewRateLimiter(ctx context.Context, redisClient *redis.Client, read RateLimit, write RateLimit) *RateLimiter {
+	return &RateLimiter{ctx: ctx, redisClient: redisClient, read: read, write: write}
+}
+
+// rateLimitKey holds the bucket a request has been charged to, so that a
+// limiter running again after authentication only charges the caller once.
+const rateLimitKey = "rateLimitKey"
+
+// clientKey identifies the caller by API key, then by user, falling back to
+// the client IP for anonymous requests and before authentication.
+func clientKey(c *gin.Context) string {
+	if id := c.GetString(apiKeyIDKey); id != "" {
+		return "apikey:" + id
+	}
+
+	if id := userID(c); id != "" {
+		return "user:" + id
+	}
+
+	return "ip:" + c.ClientIP()
+}
+
+// Middleware limits requests by clientKey. Registered both before and after
+// authentication, it throttles callers by IP before credentials cost a
+// lookup, then by who they turn out to be.
+func (r *RateLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bucket, limit := "read", r.read
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			bucket, limit = "write", r.write
+		}
+
+		key := fmt.Sprintf("rateLimit:%s:%s", bucket, clientKey(c))
+		if c.GetString(rateLimitKey) == key {
+			c.Next()
+			return
+		}
+		c.Set(rateLimitKey, key)
+
+		res, err := tokenBucketScript.Run(r.ctx, r.redisClient, []string{key}, limit.Requests, limit.rate()).Slice()
+		if err != nil {
+			// Do not take the API down together with Redis
+			log.Println("Rate limiter:", err)
+			c.Next()
+			return
+		}
+
+		allowed := res[0].(int64) == 1
+		tokens, _ := strconv.ParseFloat(res[1].(string), 64)
+
+		c.Header("RateLimit-Limit", strconv.Itoa(limit.Requests))
+		c.Header("RateLimit-Remaining", strconv.Itoa(int(tokens)))
+		c.Header("RateLimit-Reset", strconv.Itoa(int(math.Ceil((float64(limit.Requests)-tokens)/limit.rate()))))
+
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil((1-tokens)/limit.rate()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error": "Too many requests",
+			})
+
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRateLimiter(t *testing.T) (*gin.Engine, *miniredis.Miniredis) {
+	gin.SetMode(gin.TestMode)
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	limiter := NewRateLimiter(context.Background(), client,
+		RateLimit{Requests: 2, Period: time.Minute},
+		RateLimit{Requests: 1, Period: time.Minute},
+	)
+
+	// Authenticates the user named by the X-User header, between two runs
+	// of the limiter as in the API
+	auth := func(c *gin.Context) {
+		if uid := c.GetHeader("X-User"); uid != "" {
+			c.Set(userIDKey, uid)
+		}
+	}
+
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+
+	router := gin.New()
+	router.Use(limiter.Middleware(), auth, limiter.Middleware())
+	router.GET("/", ok)
+	router.POST("/", ok)
+
+	return router, server
+}
+
+func serve(router *gin.Engine, method string, user string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	if user != "" {
+		req.Header.Set("X-User", user)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestRateLimiter(t *testing.T) {
+	router, _ := newTestRateLimiter(t)
+
+	for i, remaining := range []string{"1", "0"} {
+		w := serve(router, http.MethodGet, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("read %d status = %d, want %d", i, w.Code, http.StatusOK)
+		}
+		if got := w.Header().Get("RateLimit-Limit"); got != "2" {
+			t.Errorf("read %d RateLimit-Limit = %q, want 2", i, got)
+		}
+		if got := w.Header().Get("RateLimit-Remaining"); got != remaining {
+			t.Errorf("read %d RateLimit-Remaining = %q, want %s", i, got, remaining)
+		}
+	}
+
+	w := serve(router, http.MethodGet, "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("read over budget status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || retryAfter < 1 || retryAfter > 30 {
+		t.Errorf("Retry-After = %q, want the seconds until a token is back", w.Header().Get("Retry-After"))
+	}
+
+	// Writes have a budget of their own
+	if w := serve(router, http.MethodPost, ""); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "1" {
+		t.Errorf("write status = %d, RateLimit-Limit = %q, want %d and 1", w.Code, w.Header().Get("RateLimit-Limit"), http.StatusOK)
+	}
+	if w := serve(router, http.MethodPost, ""); w.Code != http.StatusTooManyRequests {
+		t.Errorf("write over budget status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestRateLimiterAuthenticated(t *testing.T) {
+	router, server := newTestRateLimiter(t)
+
+	// Charged to the IP before authentication and to the user after
+	if w := serve(router, http.MethodGet, "user"); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// Tokens refill continuously, so only whole tokens are compared
+	tokens := func(key string) int {
+		tokens, _ := strconv.ParseFloat(server.HGet(key, "tokens"), 64)
+		return int(tokens)
+	}
+
+	for _, key := range []string{"rateLimit:read:ip:192.0.2.1", "rateLimit:read:user:user"} {
+		if got := tokens(key); got != 1 {
+			t.Errorf("%s tokens = %d, want 1", key, got)
+		}
+	}
+
+	// Anonymous requests are only charged once
+	serve(router, http.MethodGet, "")
+	if got := tokens("rateLimit:read:ip:192.0.2.1"); got != 0 {
+		t.Errorf("IP tokens after an anonymous request = %d, want 0", got)
+	}
+}
+
+func TestRateLimiterFailsOpen(t *testing.T) {
+	router, server := newTestRateLimiter(t)
+	server.Close()
+
+	w := serve(router, http.MethodGet, "")
+	if w.Code != http.StatusOK {
+		t.Errorf("status without Redis = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("RateLimit-Limit"); got != "" {
+		t.Errorf("RateLimit-Limit without Redis = %q, want none", got)
+	}
+}
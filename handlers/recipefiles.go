@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/harmlessevil/recipes-api/models"
+	"github.com/harmlessevil/recipes-api/recipefile"
+)
+
+func (h *RecipesHandler) ImportRecipeFileHandler(c *gin.Context) {
+	// swagger:operation POST /recipes/import/file recipes importRecipeFile
+	//
+	// Import the recipes of a file exported by another recipe manager, as a
+	// multipart form: Paprika (.paprikarecipes), MealMaster (.mmf), Open
+	// Recipe Format (.yaml) or Cooklang (.cook). The recipes are saved as
+	// drafts unless publish is set, and the report lists for each whether
+	// it was created, a duplicate of one imported before or invalid
+	//
+	// ---
+	// consumes:
+	//   - multipart/form-data
+	// parameters:
+	//   - name: file
+	//     in: formData
+	//     description: the exported file
+	//     required: true
+	//     type: file
+	//   - name: format
+	//     in: query
+	//     description: one of paprika, mealmaster, orf, cooklang, told by the file name by default
+	//     required: false
+	//     type: string
+	//   - name: publish
+	//     in: query
+	//     description: whether to publish the recipes right away
+	//     required: false
+	//     type: boolean
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+	//  '413':
+	//   description: File too large
+	//  '422':
+	//   description: The file could not be read
+
+	format := c.Query("format")
+	if _, ok := recipefile.Formats[format]; format != "" && !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "unknown format " + format + ", expected one of " + strings.Join(recipefile.FormatNames, ", "),
+		})
+
+		return
+	}
+
+	publish, err := strconv.ParseBool(c.DefaultQuery("publish", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "publish must be true or false",
+		})
+
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBulkSize)
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": "file too large",
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	recipes, err := recipefile.Read(format, file.Filename, data)
+	if err != nil {
+		if errors.Is(err, recipefile.ErrUnknownFormat) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "cannot tell the format of " + file.Filename + ", expected one of " + strings.Join(recipefile.FormatNames, ", "),
+			})
+
+			return
+		}
+
+		if errors.Is(err, recipefile.ErrTooManyRecipes) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": errTooManyBulkItems.Error(),
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if len(recipes) > maxBulkItems {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": errTooManyBulkItems.Error(),
+		})
+
+		return
+	}
+
+	uid := userID(c)
+	report := models.BulkReport{Results: make([]models.BulkResult, len(recipes))}
+
+	var accepted []models.Recipe
+	var positions []int
+	seen := make(map[string]int)
+	for i := range recipes {
+		recipe := recipes[i]
+		result := &report.Results[i]
+		result.Index = i
+
+		if !admitBulkRecipe(&recipe, false, seen, result) {
+			continue
+		}
+
+		prepareRecipe(&recipe, uid)
+		recipe.Draft = !publish
+		accepted = append(accepted, recipe)
+		positions = append(positions, i)
+	}
+
+	if len(accepted) > 0 {
+		if err := h.insertRecipes(accepted, positions, &report); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error while importing recipes",
+			})
+
+			return
+		}
+	}
+
+	h.finishBulk(c, &report, accepted, positions, models.AuditRecipeImport)
+
+	c.JSON(http.StatusOK, report)
+}
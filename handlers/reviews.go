@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+type ReviewsHandler struct {
+	ctx               context.Context
+	collection        *mongo.Collection
+	recipesCollection *mongo.Collection
+	redisClient       *redis.Client
+	auditHandler      *AuditHandler
+}
+
+func NewReviewsHandler(ctx context.Context, collection *mongo.Collection, recipesCollection *mongo.Collection, redisClient *redis.Client, auditHandler *AuditHandler) *ReviewsHandler {
+	return &ReviewsHandler{ctx: ctx, collection: collection, recipesCollection: recipesCollection, redisClient: redisClient, auditHandler: auditHandler}
+}
+
+func (h *ReviewsHandler) CreateIndexes() error {
+	_, err := h.collection.Indexes().CreateMany(h.ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "recipeId", Value: 1}, {Key: "authorId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "recipeId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "authorId", Value: 1}, {Key: "createdAt", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = h.recipesCollection.Indexes().CreateOne(h.ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "ratingAverage", Value: -1}, {Key: "ratingCount", Value: -1}},
+	})
+
+	return err
+}
+
+// updateRating adjusts the denormalized rating of a recipe in a single atomic
+// update, so that concurrent reviews cannot leave the average out of sync.
+func (h *ReviewsHandler) updateRating(recipeID primitive.ObjectID, sumDelta int, countDelta int) error {
+	_, err := h.recipesCollection.UpdateOne(h.ctx, bson.M{"_id": recipeID}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"ratingSum":   bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$ratingSum", 0}}, sumDelta}},
+			"ratingCount": bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$ratingCount", 0}}, countDelta}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"ratingAverage": bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{"$ratingCount", 0}},
+				bson.M{"$divide": bson.A{"$ratingSum", "$ratingCount"}},
+				0,
+			}},
+		}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	return h.redisClient.Del(h.ctx, "recipes").Err()
+}
+
+func (h *ReviewsHandler) NewReviewHandler(c *gin.Context) {
+	// swagger:operation POST /recipes/{id}/reviews reviews newReview
+	//
+	// Review a recipe. Each user can review a recipe once
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the recipe
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+	//  '404':
+	//   description: Invalid recipe ID
+	//  '409':
+	//   description: Recipe has already been reviewed by the user
+
+	recipeID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	var review models.Review
+	if err := c.ShouldBindJSON(&review); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	count, err := h.recipesCollection.CountDocuments(h.ctx, visible(bson.M{"_id": recipeID}, userID(c)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Recipe not found",
+		})
+
+		return
+	}
+
+	review.ID = primitive.NewObjectID()
+	review.RecipeID = recipeID
+	review.AuthorID = userID(c)
+	review.CreatedAt = time.Now()
+	review.UpdatedAt = review.CreatedAt
+
+	if _, err := h.collection.InsertOne(h.ctx, review); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "You have already reviewed this recipe",
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error while inserting review",
+		})
+
+		return
+	}
+
+	if err := h.updateRating(recipeID, review.Rating, 1); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error while updating recipe rating",
+		})
+
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action:   models.AuditReviewCreate,
+		RecipeID: &recipeID,
+		Target:   review.ID.Hex(),
+	}, nil, review)
+
+	c.JSON(http.StatusOK, review)
+}
+
+func (h *ReviewsHandler) listReviews(c *gin.Context, filter bson.M) {
+	page, limit := pagination(c)
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip((page - 1) * limit).
+		SetLimit(limit)
+
+	cur, err := h.collection.Find(h.ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	reviews := make([]models.Review, 0, limit)
+	if err := cur.All(h.ctx, &reviews); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, reviews)
+}
+
+func (h *ReviewsHandler) ListReviewsHandler(c *gin.Context) {
+	// swagger:operation GET /recipes/{id}/reviews reviews listReviews
+	//
+	// Returns reviews of a recipe, most recent first
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the recipe
+	//     required: true
+	//     type: string
+	//   - name: page
+	//     in: query
+	//     type: integer
+	//   - name: limit
+	//     in: query
+	//     type: integer
+	// produces:
+	// - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+
+	recipeID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	h.listReviews(c, bson.M{"recipeId": recipeID})
+}
+
+func (h *ReviewsHandler) ListMyReviewsHandler(c *gin.Context) {
+	// swagger:operation GET /me/reviews reviews listMyReviews
+	//
+	// Returns reviews written by the authenticated user
+	//
+	// ---
+	// parameters:
+	//   - name: page
+	//     in: query
+	//     type: integer
+	//   - name: limit
+	//     in: query
+	//     type: integer
+	// produces:
+	// - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+
+	h.listReviews(c, bson.M{"authorId": userID(c)})
+}
+
+func (h *ReviewsHandler) UpdateReviewHandler(c *gin.Context) {
+	// swagger:operation PUT /reviews/{id} reviews updateReview
+	//
+	// Update an own review
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the review
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+	//  '404':
+	//   description: Invalid review ID
+
+	var body models.Review
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	now := time.Now()
+
+	// The rating replaced is read from the same atomic update, so that
+	// concurrent updates each adjust the recipe by what they changed
+	var before models.Review
+	err = h.collection.FindOneAndUpdate(h.ctx, bson.M{"_id": objectID, "authorId": userID(c)}, bson.D{{
+		Key: "$set", Value: bson.D{
+			{Key: "rating", Value: body.Rating},
+			{Key: "text", Value: body.Text},
+			{Key: "updatedAt", Value: now},
+		},
+	}}, options.FindOneAndUpdate().SetReturnDocument(options.Before)).Decode(&before)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Review not found",
+		})
+
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	after := before
+	after.Rating = body.Rating
+	after.Text = body.Text
+	after.UpdatedAt = now
+
+	if err := h.updateRating(after.RecipeID, after.Rating-before.Rating, 0); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error while updating recipe rating",
+		})
+
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action:   models.AuditReviewUpdate,
+		RecipeID: &after.RecipeID,
+		Target:   after.ID.Hex(),
+	}, before, after)
+
+	c.JSON(http.StatusOK, after)
+}
+
+func (h *ReviewsHandler) DeleteReviewHandler(c *gin.Context) {
+	// swagger:operation DELETE /reviews/{id} reviews deleteReview
+	//
+	// Delete an own review
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the review
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Invalid review ID
+
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	// The rating taken out is the one of the review deleted, so that an
+	// update landing in between does not leave the recipe rating off
+	var review models.Review
+	err = h.collection.FindOneAndDelete(h.ctx, bson.M{"_id": objectID, "authorId": userID(c)}).Decode(&review)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Review not found",
+		})
+
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if err := h.updateRating(review.RecipeID, -review.Rating, -1); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error while updating recipe rating",
+		})
+
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action:   models.AuditReviewDelete,
+		RecipeID: &review.RecipeID,
+		Target:   review.ID.Hex(),
+	}, review, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Review has been deleted",
+	})
+}
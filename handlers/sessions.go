@@ -0,0 +1,430 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+const (
+	accessTokenTTL = 15 * time.Minute
+	sessionTTL     = 30 * 24 * time.Hour
+)
+
+var (
+	errInvalidToken = errors.New("invalid or expired token")
+	errTokenReuse   = errors.New("refresh token reuse detected, session has been revoked")
+)
+
+func sessionKey(id string) string {
+	return fmt.Sprintf("session:%s", id)
+}
+
+// sessionTokensKey holds every access and refresh token key issued for a
+// session, so that the whole token family can be revoked at once.
+func sessionTokensKey(id string) string {
+	return fmt.Sprintf("session:%s:tokens", id)
+}
+
+func userSessionsKey(userID string) string {
+	return fmt.Sprintf("user:%s:sessions", userID)
+}
+
+func accessTokenKey(token string) string {
+	return fmt.Sprintf("accessToken:%s", hashToken(token))
+}
+
+func refreshTokenKey(token string) string {
+	return fmt.Sprintf("refreshToken:%s", hashToken(token))
+}
+
+func generateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (a *AuthHandler) loadSession(id string) (*models.Session, error) {
+	val, err := a.redisClient.Get(a.ctx, sessionKey(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var session models.Session
+	if err := json.Unmarshal([]byte(val), &session); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// issueTokens stores the session and a fresh access/refresh token pair for it.
+func (a *AuthHandler) issueTokens(session *models.Session) (*models.SessionTokens, error) {
+	accessToken, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = a.redisClient.TxPipelined(a.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(a.ctx, sessionKey(session.ID), data, sessionTTL)
+		pipe.Set(a.ctx, accessTokenKey(accessToken), session.ID, accessTokenTTL)
+		pipe.HSet(a.ctx, refreshTokenKey(refreshToken), "session", session.ID, "uses", 0)
+		pipe.Expire(a.ctx, refreshTokenKey(refreshToken), sessionTTL)
+		pipe.SAdd(a.ctx, sessionTokensKey(session.ID), accessTokenKey(accessToken), refreshTokenKey(refreshToken))
+		pipe.Expire(a.ctx, sessionTokensKey(session.ID), sessionTTL)
+		pipe.SAdd(a.ctx, userSessionsKey(session.UserID), session.ID)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SessionTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+		Session:      *session,
+	}, nil
+}
+
+// rotateRefreshToken exchanges a refresh token for a new token pair. A refresh
+// token can be used only once; presenting it again revokes the whole session.
+func (a *AuthHandler) rotateRefreshToken(c *gin.Context, refreshToken string) (*models.SessionTokens, error) {
+	key := refreshTokenKey(refreshToken)
+
+	sessionID, err := a.redisClient.HGet(a.ctx, key, "session").Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, errInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	uses, err := a.redisClient.HIncrBy(a.ctx, key, "uses", 1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if uses > 1 {
+		session, _ := a.loadSession(sessionID)
+		if err := a.revokeSession(sessionID); err != nil {
+			return nil, err
+		}
+
+		if session != nil {
+			a.auditHandler.Record(c, models.AuditEntry{
+				Actor:  session.UserID,
+				Action: models.AuditSessionReuse,
+				Target: sessionID,
+			}, nil, nil)
+		}
+
+		return nil, errTokenReuse
+	}
+
+	session, err := a.loadSession(sessionID)
+	if errors.Is(err, redis.Nil) {
+		return nil, errInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session.RefreshedAt = time.Now()
+	session.ExpiresAt = session.RefreshedAt.Add(sessionTTL)
+
+	return a.issueTokens(session)
+}
+
+// revokeSession deletes the session together with every token issued for it.
+func (a *AuthHandler) revokeSession(id string) error {
+	keys, err := a.redisClient.SMembers(a.ctx, sessionTokensKey(id)).Result()
+	if err != nil {
+		return err
+	}
+
+	session, err := a.loadSession(id)
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+
+	_, err = a.redisClient.TxPipelined(a.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(a.ctx, append(keys, sessionKey(id), sessionTokensKey(id))...)
+		if session != nil {
+			pipe.SRem(a.ctx, userSessionsKey(session.UserID), id)
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+// authenticateSession resolves an access token to its session.
+func (a *AuthHandler) authenticateSession(accessToken string) (*models.Session, error) {
+	sessionID, err := a.redisClient.Get(a.ctx, accessTokenKey(accessToken)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, errInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := a.loadSession(sessionID)
+	if errors.Is(err, redis.Nil) {
+		return nil, errInvalidToken
+	}
+
+	return session, err
+}
+
+func (a *AuthHandler) NewSessionHandler(c *gin.Context) {
+	// swagger:operation POST /sessions sessions newSession
+	//
+	// Start a first-party session for the user authenticated with an Auth0
+	// token
+	//
+	// ---
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '401':
+	//   description: Unauthorized
+	//  '403':
+	//   description: Called with a session access token or an API key
+
+	// Otherwise a leaked access token could start a session outliving the
+	// revocation of its own
+	if _, ok := c.Get(sessionIDKey); ok {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Sessions can only be started with an Auth0 token",
+		})
+
+		return
+	}
+
+	now := time.Now()
+	session := &models.Session{
+		UserID:      userID(c),
+		UserAgent:   c.Request.UserAgent(),
+		IP:          c.ClientIP(),
+		CreatedAt:   now,
+		RefreshedAt: now,
+		ExpiresAt:   now.Add(sessionTTL),
+	}
+
+	id, err := generateToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+	session.ID = id
+
+	tokens, err := a.issueTokens(session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error while creating session",
+		})
+
+		return
+	}
+
+	a.auditHandler.Record(c, models.AuditEntry{
+		Action: models.AuditSessionCreate,
+		Target: session.ID,
+	}, nil, nil)
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (a *AuthHandler) RefreshSessionHandler(c *gin.Context) {
+	// swagger:operation POST /sessions/refresh sessions refreshSession
+	//
+	// Exchange a refresh token for a new access and refresh token
+	//
+	// ---
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+	//  '401':
+	//   description: Invalid, expired or reused refresh token
+
+	var body struct {
+		RefreshToken string `json:"refreshToken" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	tokens, err := a.rotateRefreshToken(c, body.RefreshToken)
+	if errors.Is(err, errInvalidToken) || errors.Is(err, errTokenReuse) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	a.auditHandler.Record(c, models.AuditEntry{
+		Actor:  tokens.Session.UserID,
+		Action: models.AuditSessionRefresh,
+		Target: tokens.Session.ID,
+	}, nil, nil)
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (a *AuthHandler) ListSessionsHandler(c *gin.Context) {
+	// swagger:operation GET /sessions sessions listSessions
+	//
+	// Returns active sessions of the authenticated user
+	//
+	// ---
+	// produces:
+	// - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '403':
+	//   description: Called with an API key
+
+	uid := userID(c)
+
+	ids, err := a.redisClient.SMembers(a.ctx, userSessionsKey(uid)).Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	sessions := make([]models.Session, 0, len(ids))
+	for _, id := range ids {
+		session, err := a.loadSession(id)
+		if errors.Is(err, redis.Nil) {
+			// The session has expired, drop the dangling reference
+			a.redisClient.SRem(a.ctx, userSessionsKey(uid), id)
+			continue
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+
+			return
+		}
+
+		sessions = append(sessions, *session)
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+func (a *AuthHandler) DeleteSessionHandler(c *gin.Context) {
+	// swagger:operation DELETE /sessions/{id} sessions deleteSession
+	//
+	// Revoke a session, logging it out remotely
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the session
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Invalid session ID
+	//  '403':
+	//   description: Called with an API key
+
+	id := c.Param("id")
+
+	session, err := a.loadSession(id)
+	if errors.Is(err, redis.Nil) || (err == nil && session.UserID != userID(c)) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Session not found",
+		})
+
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if err := a.revokeSession(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	a.auditHandler.Record(c, models.AuditEntry{
+		Action: models.AuditSessionRevoke,
+		Target: id,
+	}, nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Session has been revoked",
+	})
+}
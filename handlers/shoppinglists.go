@@ -0,0 +1,542 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/harmlessevil/recipes-api/ingredients"
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+// defaultServings is assumed for recipes that do not say how many people
+// they are for.
+const defaultServings = 4
+
+type ShoppingListsHandler struct {
+	ctx                 context.Context
+	collection          *mongo.Collection
+	recipesCollection   *mongo.Collection
+	mealPlansCollection *mongo.Collection
+	usersCollection     *mongo.Collection
+	auditHandler        *AuditHandler
+}
+
+func NewShoppingListsHandler(ctx context.Context, collection *mongo.Collection, recipesCollection *mongo.Collection, mealPlansCollection *mongo.Collection, usersCollection *mongo.Collection, auditHandler *AuditHandler) *ShoppingListsHandler {
+	return &ShoppingListsHandler{ctx: ctx, collection: collection, recipesCollection: recipesCollection, mealPlansCollection: mealPlansCollection, usersCollection: usersCollection, auditHandler: auditHandler}
+}
+
+func (h *ShoppingListsHandler) CreateIndexes() error {
+	_, err := h.collection.Indexes().CreateOne(h.ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}},
+	})
+
+	return err
+}
+
+func recipeServings(recipe *models.Recipe) int {
+	if recipe.Servings > 0 {
+		return recipe.Servings
+	}
+
+	return defaultServings
+}
+
+// buildShoppingList merges the ingredients of the recipes, scaled to the
+// requested servings, into items grouped by aisle. Amounts of the same
+// ingredient are summed when their units can be converted into each other.
+func buildShoppingList(recipes []models.Recipe, servings map[primitive.ObjectID]int, system string) []models.ShoppingListAisle {
+	type key struct{ name, unit string }
+
+	var (
+		order      []key
+		quantities = map[key]float64{}
+		recipeIDs  = map[key][]primitive.ObjectID{}
+	)
+
+	for i := range recipes {
+		recipe := &recipes[i]
+		scale := float64(servings[recipe.ID]) / float64(recipeServings(recipe))
+
+		for _, ingredient := range ingredients.ParseAll(recipe.Ingredients) {
+			quantity, unit, _ := ingredients.ToBase(ingredient.Quantity*scale, ingredient.Unit)
+
+			k := key{ingredient.Name, unit}
+			if _, ok := quantities[k]; !ok {
+				order = append(order, k)
+			}
+			quantities[k] += quantity
+
+			if ids := recipeIDs[k]; len(ids) == 0 || ids[len(ids)-1] != recipe.ID {
+				recipeIDs[k] = append(ids, recipe.ID)
+			}
+		}
+	}
+
+	byAisle := map[string][]models.ShoppingListItem{}
+	for _, k := range order {
+		quantity, unit := ingredients.Display(quantities[k], k.unit, system)
+
+		aisle := ingredients.Aisle(k.name)
+		byAisle[aisle] = append(byAisle[aisle], models.ShoppingListItem{
+			ID:        primitive.NewObjectID(),
+			Name:      k.name,
+			Quantity:  quantity,
+			Unit:      unit,
+			RecipeIDs: recipeIDs[k],
+		})
+	}
+
+	aisles := make([]models.ShoppingListAisle, 0, len(byAisle))
+	for _, name := range ingredients.Aisles {
+		items, ok := byAisle[name]
+		if !ok {
+			continue
+		}
+
+		sort.SliceStable(items, func(i, j int) bool {
+			return items[i].Name < items[j].Name
+		})
+
+		aisles = append(aisles, models.ShoppingListAisle{Name: name, Items: items})
+	}
+
+	return aisles
+}
+
+// unitSystem returns the measurement system preferred by the user.
+func (h *ShoppingListsHandler) unitSystem(uid string) string {
+	var user models.User
+	if err := h.usersCollection.FindOne(h.ctx, bson.M{"_id": uid}).Decode(&user); err != nil || user.PreferredUnits == "" {
+		return models.UnitsMetric
+	}
+
+	return user.PreferredUnits
+}
+
+// findShoppingList loads the list from the path, responding with 404 unless
+// it belongs to the authenticated user.
+func (h *ShoppingListsHandler) findShoppingList(c *gin.Context) (*models.ShoppingList, bool) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return nil, false
+	}
+
+	var list models.ShoppingList
+	if err := h.collection.FindOne(h.ctx, bson.M{"_id": objectID, "userId": userID(c)}).Decode(&list); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Shopping list not found",
+			})
+
+			return nil, false
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return nil, false
+	}
+
+	return &list, true
+}
+
+func (h *ShoppingListsHandler) NewShoppingListHandler(c *gin.Context) {
+	// swagger:operation POST /shopping-lists shoppingLists newShoppingList
+	//
+	// Generate a shopping list from recipes or from the meal plan of a week.
+	// Duplicate ingredients are merged and items are grouped by store aisle
+	//
+	// ---
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+	//  '404':
+	//   description: Invalid recipe ID or meal plan week
+
+	var body struct {
+		Name    string                      `json:"name" binding:"max=100"`
+		Recipes []models.ShoppingListRecipe `json:"recipes" binding:"max=100"`
+		Week    string                      `json:"week"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if (len(body.Recipes) == 0) == (body.Week == "") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Either recipes or week is required",
+		})
+
+		return
+	}
+
+	list := models.ShoppingList{
+		ID:     primitive.NewObjectID(),
+		UserID: userID(c),
+		Name:   body.Name,
+		Week:   body.Week,
+	}
+
+	requested := body.Recipes
+	if body.Week != "" {
+		if _, err := parseISOWeek(body.Week); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+
+			return
+		}
+
+		var plan models.MealPlan
+		if err := h.mealPlansCollection.FindOne(h.ctx, bson.M{"userId": list.UserID, "week": body.Week}).Decode(&plan); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error": "Meal plan not found",
+				})
+
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+
+			return
+		}
+
+		requested = make([]models.ShoppingListRecipe, 0, len(plan.Slots))
+		for _, slot := range plan.Slots {
+			requested = append(requested, models.ShoppingListRecipe{RecipeID: slot.RecipeID, Servings: slot.Servings})
+		}
+
+		if list.Name == "" {
+			list.Name = "Shopping list for " + body.Week
+		}
+	}
+
+	if list.Name == "" {
+		list.Name = "Shopping list"
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(requested))
+	for _, r := range requested {
+		ids = append(ids, r.RecipeID)
+	}
+
+	cur, err := h.recipesCollection.Find(h.ctx, visible(bson.M{"_id": bson.M{"$in": ids}}, userID(c)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	var recipes []models.Recipe
+	if err := cur.All(h.ctx, &recipes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	found := make(map[primitive.ObjectID]*models.Recipe, len(recipes))
+	for i := range recipes {
+		found[recipes[i].ID] = &recipes[i]
+	}
+
+	// The same recipe may be planned for several meals
+	servings := map[primitive.ObjectID]int{}
+	for _, r := range requested {
+		recipe, ok := found[r.RecipeID]
+		// Recipes deleted since they were planned are left out
+		if !ok && body.Week != "" {
+			continue
+		}
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Recipe " + r.RecipeID.Hex() + " not found",
+			})
+
+			return
+		}
+
+		if r.Servings <= 0 {
+			r.Servings = recipeServings(recipe)
+		}
+
+		if _, ok := servings[r.RecipeID]; !ok {
+			list.Recipes = append(list.Recipes, models.ShoppingListRecipe{RecipeID: r.RecipeID})
+		}
+		servings[r.RecipeID] += r.Servings
+	}
+
+	for i := range list.Recipes {
+		list.Recipes[i].Servings = servings[list.Recipes[i].RecipeID]
+	}
+
+	list.Aisles = buildShoppingList(recipes, servings, h.unitSystem(list.UserID))
+	list.CreatedAt = time.Now()
+	list.UpdatedAt = list.CreatedAt
+
+	if _, err := h.collection.InsertOne(h.ctx, list); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error while inserting shopping list",
+		})
+
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action: models.AuditShoppingListCreate,
+		Target: list.ID.Hex(),
+	}, nil, list)
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *ShoppingListsHandler) ListShoppingListsHandler(c *gin.Context) {
+	// swagger:operation GET /shopping-lists shoppingLists listShoppingLists
+	//
+	// Returns shopping lists of the authenticated user, most recent first
+	//
+	// ---
+	// parameters:
+	//   - name: page
+	//     in: query
+	//     type: integer
+	//   - name: limit
+	//     in: query
+	//     type: integer
+	// produces:
+	// - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+
+	page, limit := pagination(c)
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip((page - 1) * limit).
+		SetLimit(limit)
+
+	cur, err := h.collection.Find(h.ctx, bson.M{"userId": userID(c)}, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	lists := make([]models.ShoppingList, 0, limit)
+	if err := cur.All(h.ctx, &lists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, lists)
+}
+
+func (h *ShoppingListsHandler) GetShoppingListHandler(c *gin.Context) {
+	// swagger:operation GET /shopping-lists/{id} shoppingLists getShoppingList
+	//
+	// Get an own shopping list
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the shopping list
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Invalid shopping list ID
+
+	list, ok := h.findShoppingList(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *ShoppingListsHandler) CheckItemHandler(c *gin.Context) {
+	// swagger:operation PATCH /shopping-lists/{id}/items/{itemId} shoppingLists checkItem
+	//
+	// Check or uncheck an item of an own shopping list
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the shopping list
+	//     required: true
+	//     type: string
+	//   - name: itemId
+	//     in: path
+	//     description: ID of the item
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+	//  '404':
+	//   description: Invalid shopping list or item ID
+
+	listID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	itemID, err := primitive.ObjectIDFromHex(c.Param("itemId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	var body struct {
+		Checked *bool `json:"checked" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	var list models.ShoppingList
+	err = h.collection.FindOneAndUpdate(h.ctx, bson.M{
+		"_id":              listID,
+		"userId":           userID(c),
+		"aisles.items._id": itemID,
+	}, bson.M{
+		"$set": bson.M{
+			"aisles.$[].items.$[item].checked": *body.Checked,
+			"updatedAt":                        time.Now(),
+		},
+	}, options.FindOneAndUpdate().
+		SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"item._id": itemID}}}).
+		SetReturnDocument(options.After)).Decode(&list)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Shopping list item not found",
+		})
+
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action: models.AuditShoppingListUpdate,
+		Target: list.ID.Hex(),
+	}, nil, list)
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *ShoppingListsHandler) DeleteShoppingListHandler(c *gin.Context) {
+	// swagger:operation DELETE /shopping-lists/{id} shoppingLists deleteShoppingList
+	//
+	// Delete an own shopping list
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the shopping list
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Invalid shopping list ID
+
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	res, err := h.collection.DeleteOne(h.ctx, bson.M{"_id": objectID, "userId": userID(c)})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if res.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Shopping list not found",
+		})
+
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action: models.AuditShoppingListDelete,
+		Target: objectID.Hex(),
+	}, nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Shopping list has been deleted",
+	})
+}
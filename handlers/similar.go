@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/harmlessevil/recipes-api/models"
+	"github.com/harmlessevil/recipes-api/similar"
+)
+
+const (
+	// maxSimilarRecipes is how many similar recipes are stored per recipe
+	maxSimilarRecipes     = 20
+	defaultSimilarRecipes = 10
+	similarLockKey        = "similar:lock"
+	// similarBatchSize bounds the commands sent to Redis at once
+	similarBatchSize = 1000
+)
+
+type SimilarHandler struct {
+	ctx               context.Context
+	recipesCollection *mongo.Collection
+	redisClient       *redis.Client
+}
+
+func NewSimilarHandler(ctx context.Context, recipesCollection *mongo.Collection, redisClient *redis.Client) *SimilarHandler {
+	return &SimilarHandler{ctx: ctx, recipesCollection: recipesCollection, redisClient: redisClient}
+}
+
+func similarKey(recipeID string) string {
+	return "recipes:" + recipeID + ":similar"
+}
+
+// RefreshSimilar ranks the published recipes against each other and stores
+// the most similar ones of each recipe in Redis, where they expire after
+// ttl.
+func (h *SimilarHandler) RefreshSimilar(ttl time.Duration) error {
+	cur, err := h.recipesCollection.Find(h.ctx, published(bson.M{}), options.Find().SetProjection(bson.M{
+		"tags": 1, "ingredients": 1,
+	}))
+	if err != nil {
+		return err
+	}
+
+	defer cur.Close(h.ctx)
+
+	// Only the documents are kept, not the recipes they are read from
+	var documents []similar.Document
+	for cur.Next(h.ctx) {
+		var recipe models.Recipe
+		if err := cur.Decode(&recipe); err != nil {
+			return err
+		}
+
+		documents = append(documents, similar.NewDocument(recipe.ID.Hex(), recipe.Tags, recipe.Ingredients))
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+
+	pipe := h.redisClient.Pipeline()
+	for i, matches := range similar.Rank(documents, maxSimilarRecipes) {
+		data, err := json.Marshal(matches)
+		if err != nil {
+			return err
+		}
+
+		pipe.Set(h.ctx, similarKey(documents[i].ID), data, ttl)
+
+		if pipe.Len() == similarBatchSize {
+			if _, err := pipe.Exec(h.ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = pipe.Exec(h.ctx)
+
+	return err
+}
+
+// Run refreshes the similar recipes now and then every interval, until the
+// context of the handler is done. Instances of the API take turns through a
+// lock in Redis, which expires before the next refresh is due in case the
+// instance holding it stops.
+func (h *SimilarHandler) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		locked, err := h.redisClient.SetNX(h.ctx, similarLockKey, time.Now().Unix(), interval*9/10).Result()
+		if err != nil {
+			log.Println("Error while locking similar recipes:", err)
+		}
+
+		if locked {
+			start := time.Now()
+
+			// Kept until the refresh after next, in case the next one fails
+			if err := h.RefreshSimilar(2*interval + time.Minute); err != nil {
+				log.Println("Error while refreshing similar recipes:", err)
+			} else {
+				log.Println("Refreshed similar recipes in", time.Since(start))
+			}
+		}
+
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *SimilarHandler) ListSimilarHandler(c *gin.Context) {
+	// swagger:operation GET /recipes/{id}/similar recipes listSimilar
+	//
+	// Returns recipes similar to a recipe by their ingredients and tags,
+	// most similar first, each with a score from 0 to 1. Similar recipes
+	// are ranked periodically, so recipes published since are not
+	// included yet
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the recipe
+	//     required: true
+	//     type: string
+	//   - name: limit
+	//     in: query
+	//     description: how many recipes to return, 10 by default and 20 at most
+	//     required: false
+	//     type: integer
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Invalid recipe ID
+
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit < 1 {
+		limit = defaultSimilarRecipes
+	}
+	if limit > maxSimilarRecipes {
+		limit = maxSimilarRecipes
+	}
+
+	var matches []similar.Match
+	val, err := h.redisClient.Get(h.ctx, similarKey(objectID.Hex())).Bytes()
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(val, &matches); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+
+			return
+		}
+	case errors.Is(err, redis.Nil):
+		// Not ranked yet, as long as the recipe exists
+		count, err := h.recipesCollection.CountDocuments(h.ctx, bson.M{"_id": objectID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+
+			return
+		}
+
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Recipe not found",
+			})
+
+			return
+		}
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	// Some of the recipes may have been deleted or unpublished since
+	// they were ranked, hence the surplus
+	ids := make([]primitive.ObjectID, 0, len(matches))
+	for _, match := range matches {
+		if id, err := primitive.ObjectIDFromHex(match.ID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	recipes := make([]models.SimilarRecipe, 0, limit)
+	if len(ids) > 0 {
+		cur, err := h.recipesCollection.Find(h.ctx, published(bson.M{"_id": bson.M{"$in": ids}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+
+			return
+		}
+
+		var found []models.Recipe
+		if err := cur.All(h.ctx, &found); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+
+			return
+		}
+
+		byID := make(map[string]models.Recipe, len(found))
+		for _, recipe := range found {
+			byID[recipe.ID.Hex()] = recipe
+		}
+
+		for _, match := range matches {
+			if recipe, ok := byID[match.ID]; ok && len(recipes) < limit {
+				recipes = append(recipes, models.SimilarRecipe{Recipe: recipe, Score: match.Score})
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, recipes)
+}
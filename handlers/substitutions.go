@@ -0,0 +1,529 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/harmlessevil/recipes-api/ingredients"
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+type SubstitutionsHandler struct {
+	ctx               context.Context
+	collection        *mongo.Collection
+	recipesCollection *mongo.Collection
+	auditHandler      *AuditHandler
+}
+
+func NewSubstitutionsHandler(ctx context.Context, collection *mongo.Collection, recipesCollection *mongo.Collection, auditHandler *AuditHandler) *SubstitutionsHandler {
+	return &SubstitutionsHandler{ctx: ctx, collection: collection, recipesCollection: recipesCollection, auditHandler: auditHandler}
+}
+
+func (h *SubstitutionsHandler) CreateIndexes() error {
+	_, err := h.collection.Indexes().CreateOne(h.ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "ingredient", Value: 1}, {Key: "substitute", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+
+	return err
+}
+
+// parseDiets reads the comma separated diet query parameter.
+func parseDiets(c *gin.Context) ([]string, error) {
+	var diets []string
+	for _, diet := range strings.Split(c.Query("diet"), ",") {
+		diet = strings.TrimSpace(strings.ToLower(diet))
+		if diet == "" {
+			continue
+		}
+
+		if !ingredients.IsDiet(diet) {
+			return nil, errUnknownDiet(diet)
+		}
+
+		diets = append(diets, diet)
+	}
+
+	return diets, nil
+}
+
+func errUnknownDiet(diet string) error {
+	return errors.New("unknown diet " + diet + ", expected one of " + strings.Join(ingredients.Diets, ", "))
+}
+
+// validDiets checks that the diets of a substitution are all supported.
+func validDiets(diets []string) error {
+	for _, diet := range diets {
+		if !ingredients.IsDiet(diet) {
+			return errUnknownDiet(diet)
+		}
+	}
+
+	return nil
+}
+
+func compliesWith(substitution *models.Substitution, diets []string) bool {
+	for _, diet := range diets {
+		if indexOf(substitution.Diets, diet) < 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+type suggestedSubstitute struct {
+	Substitute string   `json:"substitute"`
+	Quantity   float64  `json:"quantity,omitempty"`
+	Unit       string   `json:"unit,omitempty"`
+	Ratio      float64  `json:"ratio"`
+	Note       string   `json:"note,omitempty"`
+	Diets      []string `json:"diets"`
+}
+
+type ingredientSubstitutes struct {
+	Line string `json:"line"`
+	Name string `json:"name"`
+	// Violates lists the requested diets the ingredient does not comply with
+	Violates    []string              `json:"violates"`
+	Substitutes []suggestedSubstitute `json:"substitutes"`
+}
+
+func (h *SubstitutionsHandler) RecipeSubstitutionsHandler(c *gin.Context) {
+	// swagger:operation GET /recipes/{id}/substitutions substitutions recipeSubstitutions
+	//
+	// Suggest substitutes for the ingredients of a recipe. With diets, only
+	// ingredients that break one of the diets are listed, together with the
+	// substitutes that comply with all of them
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the recipe
+	//     required: true
+	//     type: string
+	//   - name: diet
+	//     in: query
+	//     description: comma separated diets, e.g. vegan,nut-free
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid diet
+	//  '404':
+	//   description: Invalid recipe ID
+
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	diets, err := parseDiets(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	var recipe models.Recipe
+	if err := h.recipesCollection.FindOne(h.ctx, visible(bson.M{"_id": objectID}, userID(c))).Decode(&recipe); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Recipe not found",
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	parsed := ingredients.ParseAll(recipe.Ingredients)
+
+	names := make([]string, 0, len(parsed))
+	for _, ingredient := range parsed {
+		names = append(names, ingredient.Name)
+	}
+
+	cur, err := h.collection.Find(h.ctx, bson.M{"ingredient": bson.M{"$in": names}}, options.Find().SetSort(bson.D{{Key: "substitute", Value: 1}}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	var substitutions []models.Substitution
+	if err := cur.All(h.ctx, &substitutions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	byIngredient := map[string][]*models.Substitution{}
+	for i := range substitutions {
+		byIngredient[substitutions[i].Ingredient] = append(byIngredient[substitutions[i].Ingredient], &substitutions[i])
+	}
+
+	// A recipe complies when every offending ingredient can be replaced
+	complies := true
+
+	result := make([]ingredientSubstitutes, 0)
+	for _, ingredient := range parsed {
+		suggestion := ingredientSubstitutes{
+			Line:        ingredient.Raw,
+			Name:        ingredient.Name,
+			Violates:    []string{},
+			Substitutes: []suggestedSubstitute{},
+		}
+
+		for _, diet := range diets {
+			if ingredients.Violates(ingredient.Name, diet) {
+				suggestion.Violates = append(suggestion.Violates, diet)
+			}
+		}
+
+		if len(diets) > 0 && len(suggestion.Violates) == 0 {
+			continue
+		}
+
+		for _, substitution := range byIngredient[ingredient.Name] {
+			if !compliesWith(substitution, diets) {
+				continue
+			}
+
+			suggestion.Substitutes = append(suggestion.Substitutes, suggestedSubstitute{
+				Substitute: substitution.Substitute,
+				Quantity:   ingredients.Round(ingredient.Quantity * substitution.Ratio),
+				Unit:       ingredient.Unit,
+				Ratio:      substitution.Ratio,
+				Note:       substitution.Note,
+				Diets:      substitution.Diets,
+			})
+		}
+
+		if len(suggestion.Substitutes) == 0 {
+			if len(diets) > 0 {
+				complies = false
+			} else {
+				continue
+			}
+		}
+
+		result = append(result, suggestion)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recipeId":    recipe.ID,
+		"diets":       diets,
+		"complies":    complies,
+		"ingredients": result,
+	})
+}
+
+func (h *SubstitutionsHandler) ListSubstitutionsHandler(c *gin.Context) {
+	// swagger:operation GET /substitutions substitutions listSubstitutions
+	//
+	// Returns the substitution table
+	//
+	// ---
+	// parameters:
+	//   - name: ingredient
+	//     in: query
+	//     description: only substitutes for this ingredient
+	//     type: string
+	//   - name: page
+	//     in: query
+	//     type: integer
+	//   - name: limit
+	//     in: query
+	//     type: integer
+	// produces:
+	// - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+
+	filter := bson.M{}
+	if ingredient := c.Query("ingredient"); ingredient != "" {
+		filter["ingredient"] = ingredients.Normalize(ingredient)
+	}
+
+	page, limit := pagination(c)
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "ingredient", Value: 1}, {Key: "substitute", Value: 1}}).
+		SetSkip((page - 1) * limit).
+		SetLimit(limit)
+
+	cur, err := h.collection.Find(h.ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	substitutions := make([]models.Substitution, 0, limit)
+	if err := cur.All(h.ctx, &substitutions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, substitutions)
+}
+
+func (h *SubstitutionsHandler) NewSubstitutionHandler(c *gin.Context) {
+	// swagger:operation POST /admin/substitutions substitutions newSubstitution
+	//
+	// Add an entry to the substitution table
+	//
+	// ---
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+	//  '409':
+	//   description: Substitution already exists
+
+	var substitution models.Substitution
+	if err := c.ShouldBindJSON(&substitution); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if err := validDiets(substitution.Diets); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	substitution.ID = primitive.NewObjectID()
+	substitution.Ingredient = ingredients.Normalize(substitution.Ingredient)
+	substitution.CreatedAt = time.Now()
+	substitution.UpdatedAt = substitution.CreatedAt
+	if substitution.Diets == nil {
+		substitution.Diets = []string{}
+	}
+
+	if _, err := h.collection.InsertOne(h.ctx, substitution); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "Substitution already exists",
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error while inserting substitution",
+		})
+
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action: models.AuditSubstitutionCreate,
+		Target: substitution.ID.Hex(),
+	}, nil, substitution)
+
+	c.JSON(http.StatusOK, substitution)
+}
+
+func (h *SubstitutionsHandler) UpdateSubstitutionHandler(c *gin.Context) {
+	// swagger:operation PUT /admin/substitutions/{id} substitutions updateSubstitution
+	//
+	// Update an entry of the substitution table
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the substitution
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+	//  '404':
+	//   description: Invalid substitution ID
+	//  '409':
+	//   description: Substitution already exists
+
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	var body models.Substitution
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if err := validDiets(body.Diets); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if body.Diets == nil {
+		body.Diets = []string{}
+	}
+
+	var before models.Substitution
+	err = h.collection.FindOneAndUpdate(h.ctx, bson.M{"_id": objectID}, bson.D{{
+		Key: "$set", Value: bson.D{
+			{Key: "ingredient", Value: ingredients.Normalize(body.Ingredient)},
+			{Key: "substitute", Value: body.Substitute},
+			{Key: "ratio", Value: body.Ratio},
+			{Key: "note", Value: body.Note},
+			{Key: "diets", Value: body.Diets},
+			{Key: "updatedAt", Value: time.Now()},
+		},
+	}}).Decode(&before)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Substitution not found",
+		})
+
+		return
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Substitution already exists",
+		})
+
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	var after models.Substitution
+	if err := h.collection.FindOne(h.ctx, bson.M{"_id": objectID}).Decode(&after); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action: models.AuditSubstitutionUpdate,
+		Target: objectID.Hex(),
+	}, before, after)
+
+	c.JSON(http.StatusOK, after)
+}
+
+func (h *SubstitutionsHandler) DeleteSubstitutionHandler(c *gin.Context) {
+	// swagger:operation DELETE /admin/substitutions/{id} substitutions deleteSubstitution
+	//
+	// Delete an entry of the substitution table
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the substitution
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Invalid substitution ID
+
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	var substitution models.Substitution
+	err = h.collection.FindOneAndDelete(h.ctx, bson.M{"_id": objectID}).Decode(&substitution)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Substitution not found",
+		})
+
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action: models.AuditSubstitutionDelete,
+		Target: objectID.Hex(),
+	}, substitution, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Substitution has been deleted",
+	})
+}
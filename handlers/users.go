@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+type UsersHandler struct {
+	ctx               context.Context
+	collection        *mongo.Collection
+	recipesCollection *mongo.Collection
+	auditHandler      *AuditHandler
+}
+
+func NewUsersHandler(ctx context.Context, collection *mongo.Collection, recipesCollection *mongo.Collection, auditHandler *AuditHandler) *UsersHandler {
+	return &UsersHandler{ctx: ctx, collection: collection, recipesCollection: recipesCollection, auditHandler: auditHandler}
+}
+
+func (h *UsersHandler) CreateIndexes() error {
+	_, err := h.recipesCollection.Indexes().CreateOne(h.ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "authorId", Value: 1}, {Key: "publishedAt", Value: -1}},
+	})
+
+	return err
+}
+
+func (h *UsersHandler) findUser(c *gin.Context, id string) (*models.User, bool) {
+	var user models.User
+	if err := h.collection.FindOne(h.ctx, bson.M{"_id": id}).Decode(&user); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+			})
+
+			return nil, false
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return nil, false
+	}
+
+	return &user, true
+}
+
+func (h *UsersHandler) GetMeHandler(c *gin.Context) {
+	// swagger:operation GET /me users getMe
+	//
+	// Get the profile of the authenticated user
+	//
+	// ---
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+
+	user, ok := h.findUser(c, userID(c))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+func (h *UsersHandler) UpdateMeHandler(c *gin.Context) {
+	// swagger:operation PUT /me users updateProfile
+	//
+	// Update the profile of the authenticated user
+	//
+	// ---
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '400':
+	//   description: Invalid input
+
+	var body struct {
+		DisplayName        string   `json:"displayName" binding:"max=64"`
+		AvatarURL          string   `json:"avatarUrl" binding:"omitempty,url"`
+		Bio                string   `json:"bio" binding:"max=1000"`
+		DietaryPreferences []string `json:"dietaryPreferences"`
+		PreferredUnits     string   `json:"preferredUnits" binding:"omitempty,oneof=metric imperial"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	if body.PreferredUnits == "" {
+		body.PreferredUnits = models.UnitsMetric
+	}
+
+	preferences := make([]string, 0, len(body.DietaryPreferences))
+	for _, preference := range body.DietaryPreferences {
+		if preference = strings.ToLower(strings.TrimSpace(preference)); preference != "" {
+			preferences = append(preferences, preference)
+		}
+	}
+
+	var before models.User
+	after := models.User{
+		DisplayName:        strings.TrimSpace(body.DisplayName),
+		AvatarURL:          body.AvatarURL,
+		Bio:                body.Bio,
+		DietaryPreferences: preferences,
+		PreferredUnits:     body.PreferredUnits,
+		UpdatedAt:          time.Now(),
+	}
+	err := h.collection.FindOneAndUpdate(h.ctx, bson.M{"_id": userID(c)}, bson.D{{
+		Key: "$set", Value: bson.D{
+			{Key: "displayName", Value: after.DisplayName},
+			{Key: "avatarUrl", Value: after.AvatarURL},
+			{Key: "bio", Value: after.Bio},
+			{Key: "dietaryPreferences", Value: after.DietaryPreferences},
+			{Key: "preferredUnits", Value: after.PreferredUnits},
+			{Key: "updatedAt", Value: after.UpdatedAt},
+		},
+	}}, options.FindOneAndUpdate().SetReturnDocument(options.Before)).Decode(&before)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	after.ID = before.ID
+	after.Roles = before.Roles
+	after.CreatedAt = before.CreatedAt
+
+	h.auditHandler.Record(c, models.AuditEntry{
+		Action: models.AuditUserUpdate,
+		Target: after.ID,
+	}, before, after)
+
+	c.JSON(http.StatusOK, after)
+}
+
+func (h *UsersHandler) GetUserHandler(c *gin.Context) {
+	// swagger:operation GET /users/{id} users getUser
+	//
+	// Get the public profile of a user together with their published recipes
+	//
+	// ---
+	// parameters:
+	//   - name: id
+	//     in: path
+	//     description: ID of the user
+	//     required: true
+	//     type: string
+	// produces:
+	//   - application/json
+	// responses:
+	//  '200':
+	//   description: Successful operation
+	//  '404':
+	//   description: Invalid user ID
+
+	user, ok := h.findUser(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "publishedAt", Value: -1}})
+
+	cur, err := h.recipesCollection.Find(h.ctx, published(bson.M{"authorId": user.ID}), opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	recipes := make([]models.Recipe, 0)
+	if err := cur.All(h.ctx, &recipes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":          user.ID,
+		"displayName": user.DisplayName,
+		"avatarUrl":   user.AvatarURL,
+		"bio":         user.Bio,
+		"createdAt":   user.CreatedAt,
+		"recipes":     recipes,
+	})
+}
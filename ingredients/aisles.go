@@ -0,0 +1,116 @@
+package ingredients
+
+import "strings"
+
+const (
+	AisleProduce    = "Produce"
+	AisleMeat       = "Meat & Seafood"
+	AisleDairy      = "Dairy & Eggs"
+	AisleBakery     = "Bakery"
+	AisleBaking     = "Baking"
+	AisleSpices     = "Spices & Seasonings"
+	AisleCanned     = "Canned & Jarred"
+	AisleGrains     = "Pasta, Rice & Grains"
+	AisleCondiments = "Oils, Vinegars & Condiments"
+	AisleNuts       = "Nuts & Seeds"
+	AisleBeverages  = "Beverages"
+	AisleFrozen     = "Frozen"
+	AisleOther      = "Other"
+)
+
+// Aisles lists the aisles in the order a typical store is walked through.
+var Aisles = []string{
+	AisleProduce, AisleBakery, AisleMeat, AisleDairy, AisleGrains, AisleCanned,
+	AisleCondiments, AisleSpices, AisleBaking, AisleNuts, AisleBeverages,
+	AisleFrozen, AisleOther,
+}
+
+var aisleKeywords = map[string][]string{
+	AisleProduce: {
+		"apple", "apricot", "arugula", "asparagus", "avocado", "banana", "basil",
+		"bean sprout", "beet", "bell pepper", "berry", "blackberry", "blueberry",
+		"bok choy", "broccoli", "brussels sprout", "cabbage", "carrot", "cauliflower",
+		"celery", "chard", "cherry", "chili", "chive", "cilantro", "corn", "cucumber",
+		"dill", "eggplant", "fennel", "garlic", "ginger", "grape", "green bean",
+		"green onion", "herb", "jalapeno", "kale", "leek", "lemon", "lemon juice",
+		"lemongrass", "lettuce", "lime", "lime juice", "mango", "melon", "mint",
+		"mushroom", "onion", "orange", "parsley", "peach", "pear", "pea", "pineapple",
+		"plum", "potato", "pumpkin", "radish", "raspberry", "rosemary", "sage",
+		"shallot", "spinach", "squash", "strawberry", "sweet potato", "thyme",
+		"tomato", "zucchini",
+	},
+	AisleMeat: {
+		"anchovy", "bacon", "beef", "chicken", "chorizo", "cod", "crab", "duck",
+		"fish", "ham", "lamb", "lobster", "mussel", "pancetta", "pork", "prosciutto",
+		"salmon", "sausage", "scallop", "shrimp", "steak", "tuna", "turkey", "veal",
+	},
+	AisleDairy: {
+		"butter", "buttermilk", "cheddar", "cheese", "cream", "cream cheese",
+		"creme fraiche", "egg", "feta", "ghee", "half-and-half", "milk", "mozzarella",
+		"parmesan", "ricotta", "sour cream", "yogurt",
+	},
+	AisleBakery: {"bagel", "baguette", "bread", "brioche", "bun", "pita", "roll", "tortilla"},
+	AisleBaking: {
+		"baking powder", "baking soda", "brown sugar", "chocolate", "chocolate chip",
+		"cocoa", "cornmeal", "cornstarch", "extract", "flour", "gelatin", "honey",
+		"maple syrup", "powdered sugar", "sugar", "vanilla", "yeast",
+	},
+	AisleSpices: {
+		"bay leaf", "black pepper", "cardamom", "cayenne", "chili flake", "chili powder",
+		"cinnamon", "clove", "coriander", "cumin", "curry", "garam masala", "nutmeg",
+		"oregano", "paprika", "pepper", "red pepper flake", "salt", "seasoning",
+		"spice", "turmeric",
+	},
+	AisleCanned: {
+		"bean", "broth", "chickpea", "coconut milk", "lentil", "olive", "pickle",
+		"stock", "tomato paste", "tomato sauce", "canned tomato",
+	},
+	AisleGrains: {
+		"barley", "bulgur", "couscous", "fettuccine", "lasagna", "linguine", "macaroni",
+		"noodle", "oats", "pasta", "penne", "quinoa", "rice", "spaghetti", "breadcrumb",
+		"panko",
+	},
+	AisleCondiments: {
+		"dressing", "fish sauce", "hot sauce", "ketchup", "mayonnaise", "mirin",
+		"mustard", "oil", "peanut butter", "salsa", "sauce", "soy sauce", "sriracha",
+		"tahini", "vinegar", "worcestershire",
+	},
+	AisleNuts: {
+		"almond", "cashew", "hazelnut", "nut", "peanut", "pecan", "pine nut",
+		"pistachio", "seed", "walnut",
+	},
+	AisleBeverages: {"beer", "brandy", "coffee", "juice", "liqueur", "rum", "tea", "vodka", "wine"},
+	AisleFrozen:    {"frozen", "ice cream"},
+}
+
+// Aisle returns the store aisle a normalized ingredient name is found in.
+// Keywords matching the end of the name win, since in English the last word
+// tells what an ingredient is ("chicken broth" is a broth), and among those
+// the longest keyword wins ("bell pepper" over "pepper").
+func Aisle(name string) string {
+	if strings.HasPrefix(name, "frozen ") {
+		return AisleFrozen
+	}
+
+	padded := " " + name + " "
+
+	best, bestScore := AisleOther, 0
+	for _, aisle := range Aisles {
+		for _, keyword := range aisleKeywords[aisle] {
+			if !strings.Contains(padded, " "+keyword+" ") {
+				continue
+			}
+
+			score := len(keyword)
+			if strings.HasSuffix(name, keyword) {
+				score += 1000
+			}
+
+			if score > bestScore {
+				best, bestScore = aisle, score
+			}
+		}
+	}
+
+	return best
+}
@@ -0,0 +1,102 @@
+package ingredients
+
+import "sort"
+
+// The 14 allergens that must be declared in the EU.
+const (
+	AllergenGluten      = "gluten"
+	AllergenCrustaceans = "crustaceans"
+	AllergenEggs        = "eggs"
+	AllergenFish        = "fish"
+	AllergenPeanuts     = "peanuts"
+	AllergenSoybeans    = "soybeans"
+	AllergenMilk        = "milk"
+	AllergenNuts        = "nuts"
+	AllergenCelery      = "celery"
+	AllergenMustard     = "mustard"
+	AllergenSesame      = "sesame"
+	AllergenSulphites   = "sulphites"
+	AllergenLupin       = "lupin"
+	AllergenMolluscs    = "molluscs"
+)
+
+// Allergens lists the supported allergens.
+var Allergens = []string{
+	AllergenGluten, AllergenCrustaceans, AllergenEggs, AllergenFish, AllergenPeanuts,
+	AllergenSoybeans, AllergenMilk, AllergenNuts, AllergenCelery, AllergenMustard,
+	AllergenSesame, AllergenSulphites, AllergenLupin, AllergenMolluscs,
+}
+
+var allergenRules = map[string]dietRule{
+	AllergenGluten:      glutenRule,
+	AllergenCrustaceans: {keywords: []string{"crab", "crayfish", "langoustine", "lobster", "prawn", "shrimp"}},
+	AllergenEggs:        eggRule,
+	AllergenFish: {keywords: []string{
+		"anchovy", "cod", "fish", "fish sauce", "haddock", "halibut", "mackerel",
+		"salmon", "sardine", "trout", "tuna", "worcestershire", "worcestershire sauce",
+	}},
+	AllergenPeanuts: {keywords: []string{"peanut", "peanut butter", "peanut oil"}},
+	AllergenSoybeans: {keywords: []string{
+		"edamame", "miso", "soy", "soy milk", "soy sauce", "soybean", "tamari", "tempeh", "tofu",
+	}},
+	AllergenMilk: dairyRule,
+	AllergenNuts: {keywords: []string{
+		"almond", "brazil nut", "cashew", "hazelnut", "macadamia", "marzipan", "nut",
+		"pecan", "pistachio", "praline", "walnut",
+	}},
+	AllergenCelery:    {keywords: []string{"celeriac", "celery", "celery salt", "celery seed"}},
+	AllergenMustard:   {keywords: []string{"dijon", "mustard", "mustard seed"}},
+	AllergenSesame:    {keywords: []string{"sesame", "sesame oil", "sesame seed", "tahini"}},
+	AllergenSulphites: {keywords: []string{"dried apricot", "sherry", "wine", "wine vinegar"}},
+	AllergenLupin:     {keywords: []string{"lupin", "lupini"}},
+	AllergenMolluscs: {keywords: []string{
+		"calamari", "clam", "mussel", "octopus", "oyster", "oyster sauce", "scallop", "snail", "squid",
+	}},
+}
+
+// IsAllergen reports whether allergen is one of Allergens.
+func IsAllergen(allergen string) bool {
+	_, ok := allergenRules[allergen]
+	return ok
+}
+
+// Labels derives the diets a recipe complies with and the allergens it
+// contains from its ingredient lines. A recipe without recognizable
+// ingredients gets no labels.
+func Labels(lines []string) (diets []string, allergens []string) {
+	parsed := ParseAll(lines)
+	if len(parsed) == 0 {
+		return []string{}, []string{}
+	}
+
+	violated := map[string]bool{}
+	contained := map[string]bool{}
+	for _, ingredient := range parsed {
+		for diet := range dietRules {
+			if Violates(ingredient.Name, diet) {
+				violated[diet] = true
+			}
+		}
+
+		for allergen, rule := range allergenRules {
+			if rule.matches(ingredient.Name) {
+				contained[allergen] = true
+			}
+		}
+	}
+
+	diets = []string{}
+	for _, diet := range Diets {
+		if !violated[diet] {
+			diets = append(diets, diet)
+		}
+	}
+
+	allergens = make([]string, 0, len(contained))
+	for allergen := range contained {
+		allergens = append(allergens, allergen)
+	}
+	sort.Strings(allergens)
+
+	return diets, allergens
+}
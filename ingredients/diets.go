@@ -0,0 +1,111 @@
+package ingredients
+
+import "strings"
+
+const (
+	DietVegan      = "vegan"
+	DietVegetarian = "vegetarian"
+	DietDairyFree  = "dairy-free"
+	DietEggFree    = "egg-free"
+	DietNutFree    = "nut-free"
+	DietGlutenFree = "gluten-free"
+)
+
+// Diets lists the supported diets.
+var Diets = []string{DietVegan, DietVegetarian, DietDairyFree, DietEggFree, DietNutFree, DietGlutenFree}
+
+type dietRule struct {
+	keywords []string
+	// exceptions are names containing a keyword that are nevertheless
+	// allowed, such as "coconut milk" for dairy
+	exceptions []string
+}
+
+var (
+	meatRule = dietRule{
+		keywords: []string{
+			"anchovy", "bacon", "beef", "chicken", "chorizo", "clam", "cod", "crab",
+			"duck", "fish", "gelatin", "ham", "lamb", "lard", "lobster", "mussel",
+			"oyster", "pancetta", "pepperoni", "pork", "prosciutto", "salami", "salmon",
+			"sausage", "scallop", "shrimp", "steak", "tuna", "turkey", "veal",
+		},
+	}
+	dairyRule = dietRule{
+		keywords: []string{
+			"butter", "buttermilk", "cheddar", "cheese", "cream", "creme fraiche", "feta",
+			"ghee", "half-and-half", "milk", "mozzarella", "parmesan", "ricotta", "whey",
+			"yogurt",
+		},
+		exceptions: []string{
+			"almond butter", "almond milk", "cashew cheese", "cocoa butter", "coconut cream",
+			"coconut milk", "coconut yogurt", "cream of tartar", "oat milk", "peanut butter",
+			"rice milk", "soy milk", "vegan butter", "vegan cheese",
+		},
+	}
+	eggRule = dietRule{
+		keywords: []string{"egg", "egg white", "egg yolk", "mayonnaise", "meringue"},
+		exceptions: []string{
+			"egg replacer", "vegan mayonnaise",
+		},
+	}
+	nutRule = dietRule{
+		keywords: []string{
+			"almond", "cashew", "hazelnut", "macadamia", "marzipan", "nut", "peanut",
+			"pecan", "pine nut", "pistachio", "praline", "walnut",
+		},
+	}
+	glutenRule = dietRule{
+		keywords: []string{
+			"barley", "bread", "breadcrumb", "bulgur", "cake", "cookie", "couscous",
+			"cracker", "flour", "noodle", "panko", "pasta", "rye", "semolina",
+			"soy sauce", "spaghetti", "tortilla", "wheat", "beer",
+		},
+		exceptions: []string{
+			"almond flour", "buckwheat", "coconut flour", "corn tortilla", "gluten-free",
+			"rice flour", "rice noodle", "tamari",
+		},
+	}
+	honeyRule = dietRule{keywords: []string{"honey"}}
+)
+
+var dietRules = map[string][]dietRule{
+	DietVegan:      {meatRule, dairyRule, eggRule, honeyRule},
+	DietVegetarian: {meatRule},
+	DietDairyFree:  {dairyRule},
+	DietEggFree:    {eggRule},
+	DietNutFree:    {nutRule},
+	DietGlutenFree: {glutenRule},
+}
+
+// IsDiet reports whether diet is one of Diets.
+func IsDiet(diet string) bool {
+	_, ok := dietRules[diet]
+	return ok
+}
+
+func (r dietRule) matches(name string) bool {
+	padded := " " + name + " "
+	for _, exception := range r.exceptions {
+		padded = strings.ReplaceAll(padded, " "+exception+" ", "  ")
+	}
+
+	for _, keyword := range r.keywords {
+		if strings.Contains(padded, " "+keyword+" ") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Violates reports whether a normalized ingredient name is not allowed in a
+// diet. Names are matched by keyword, so unknown ingredients are allowed.
+func Violates(name string, diet string) bool {
+	for _, rule := range dietRules[diet] {
+		if rule.matches(name) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,131 @@
+package ingredients
+
+import (
+	"regexp"
+	"strings"
+)
+
+// descriptors are words that describe how an ingredient is prepared or
+// bought rather than what it is.
+var descriptors = map[string]bool{
+	"about": true, "approximately": true, "beaten": true, "big": true, "boneless": true,
+	"chilled": true, "chopped": true, "coarse": true, "coarsely": true, "cold": true,
+	"cooked": true, "crumbled": true, "crushed": true, "cubed": true, "diced": true,
+	"divided": true, "drained": true, "extra-large": true, "extra-virgin": true,
+	"finely": true, "firmly": true, "fresh": true, "freshly": true, "good-quality": true,
+	"grated": true, "halved": true, "heaping": true, "homemade": true, "jumbo": true,
+	"large": true, "level": true, "lightly": true, "low-sodium": true, "medium": true,
+	"melted": true, "minced": true, "optional": true, "organic": true, "packed": true,
+	"peeled": true, "pitted": true, "quartered": true, "rinsed": true, "roughly": true,
+	"room-temperature": true, "salted": true, "seeded": true, "shredded": true,
+	"skinless": true, "sliced": true, "small": true, "softened": true, "stemmed": true,
+	"store-bought": true, "thickly": true, "thinly": true, "toasted": true,
+	"trimmed": true, "uncooked": true, "unsalted": true, "virgin": true, "warm": true,
+}
+
+// singulars lists plurals that the suffix rules get wrong.
+var singulars = map[string]string{
+	"asparagus": "asparagus", "couscous": "couscous", "cookies": "cookie",
+	"grits": "grits", "halves": "half", "hummus": "hummus", "leaves": "leaf",
+	"loaves": "loaf", "molasses": "molasses", "oats": "oats", "swiss": "swiss",
+	"brussels": "brussels", "anise": "anise", "lettuce": "lettuce",
+}
+
+// synonyms maps names of the same ingredient to one spelling.
+var synonyms = map[string]string{
+	"kosher salt":          "salt",
+	"sea salt":             "salt",
+	"table salt":           "salt",
+	"fine salt":            "salt",
+	"scallion":             "green onion",
+	"spring onion":         "green onion",
+	"coriander leaf":       "cilantro",
+	"garbanzo bean":        "chickpea",
+	"confectioners sugar":  "powdered sugar",
+	"confectioners' sugar": "powdered sugar",
+	"icing sugar":          "powdered sugar",
+	"caster sugar":         "sugar",
+	"granulated sugar":     "sugar",
+	"white sugar":          "sugar",
+	"all purpose flour":    "all-purpose flour",
+	"plain flour":          "all-purpose flour",
+	"ground black pepper":  "black pepper",
+	"black peppercorn":     "black pepper",
+	"ground pepper":        "black pepper",
+	"garlic clove":         "garlic",
+	"heavy whipping cream": "heavy cream",
+	"whipping cream":       "heavy cream",
+	"double cream":         "heavy cream",
+	"bicarbonate of soda":  "baking soda",
+	"cornflour":            "cornstarch",
+	"aubergine":            "eggplant",
+	"courgette":            "zucchini",
+	"chicken stock":        "chicken broth",
+	"vegetable stock":      "vegetable broth",
+	"beef stock":           "beef broth",
+	"parmigiano-reggiano":  "parmesan",
+	"parmesan cheese":      "parmesan",
+	"parmigiano reggiano":  "parmesan",
+}
+
+var nonLetters = regexp.MustCompile(`[^\p{L}\s'-]+`)
+
+// singularize turns the last word of a name into its singular form.
+func singularize(word string) string {
+	if singular, ok := singulars[word]; ok {
+		return singular
+	}
+
+	switch {
+	case len(word) < 4 || strings.HasSuffix(word, "ss") || strings.HasSuffix(word, "us"):
+		return word
+	case strings.HasSuffix(word, "ies"):
+		return strings.TrimSuffix(word, "ies") + "y"
+	case strings.HasSuffix(word, "oes"), strings.HasSuffix(word, "ches"),
+		strings.HasSuffix(word, "shes"), strings.HasSuffix(word, "sses"),
+		strings.HasSuffix(word, "xes"):
+		return strings.TrimSuffix(word, "es")
+	case strings.HasSuffix(word, "s"):
+		return strings.TrimSuffix(word, "s")
+	}
+
+	return word
+}
+
+// Normalize reduces an ingredient name to a canonical form, so that
+// "2 Large Eggs" and "egg, beaten" both become "egg". Only the first of
+// several alternatives ("butter or margarine") is kept.
+func Normalize(name string) string {
+	name = strings.ToLower(name)
+	name = parenthesesPattern.ReplaceAllString(name, " ")
+	name, _, _ = strings.Cut(name, ",")
+	name, _, _ = strings.Cut(name, " or ")
+	name, _, _ = strings.Cut(name, " such as ")
+	name, _, _ = strings.Cut(name, " for ")
+	name, _, _ = strings.Cut(name, " to taste")
+	name = strings.ReplaceAll(name, "extra virgin", "extra-virgin")
+	name = nonLetters.ReplaceAllString(name, " ")
+
+	var words []string
+	for _, word := range strings.Fields(name) {
+		word = strings.Trim(word, "-'")
+		if word == "" || descriptors[word] {
+			continue
+		}
+
+		words = append(words, word)
+	}
+
+	if len(words) == 0 {
+		return ""
+	}
+
+	words[len(words)-1] = singularize(words[len(words)-1])
+
+	name = strings.Join(words, " ")
+	if synonym, ok := synonyms[name]; ok {
+		return synonym
+	}
+
+	return name
+}
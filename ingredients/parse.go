@@ -0,0 +1,250 @@
+// Package ingredients parses free-text ingredient lines such as
+// "1 1/2 cups all-purpose flour, sifted" into quantities, units and
+// normalized names.
+package ingredients
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type Ingredient struct {
+	Raw string `json:"raw"`
+	// Quantity is 0 when the line does not specify one, e.g. "salt to taste".
+	// For ranges such as "4 to 5" it is the upper bound.
+	Quantity float64 `json:"quantity"`
+	// Unit is the canonical spelling of the unit, or empty for plain counts
+	Unit string `json:"unit"`
+	// Name is the normalized ingredient name, see Normalize
+	Name string `json:"name"`
+	// Note holds preparation instructions and remarks, e.g. "finely chopped"
+	Note string `json:"note,omitempty"`
+}
+
+var (
+	parenthesesPattern = regexp.MustCompile(`\(([^)]*)\)`)
+	attachedUnitRegexp = regexp.MustCompile(`^(\d+(?:[.,]\d+)?)-?([a-z]+\.?)$`)
+	rangePattern       = regexp.MustCompile(`^([^-–]+)[-–]([^-–]+)$`)
+)
+
+var unicodeFractions = map[rune]float64{
+	'½': 1.0 / 2, '⅓': 1.0 / 3, '⅔': 2.0 / 3, '¼': 1.0 / 4, '¾': 3.0 / 4,
+	'⅕': 1.0 / 5, '⅖': 2.0 / 5, '⅗': 3.0 / 5, '⅘': 4.0 / 5, '⅙': 1.0 / 6,
+	'⅚': 5.0 / 6, '⅛': 1.0 / 8, '⅜': 3.0 / 8, '⅝': 5.0 / 8, '⅞': 7.0 / 8,
+}
+
+var numberWords = map[string]float64{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5,
+	"six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10, "twelve": 12,
+	"dozen": 12, "half": 0.5,
+}
+
+// parseNumber parses "2", "1.5", "3/4", "½" and "1½".
+func parseNumber(s string) (float64, bool) {
+	if s == "" {
+		return 0, false
+	}
+
+	runes := []rune(s)
+	if fraction, ok := unicodeFractions[runes[len(runes)-1]]; ok {
+		if len(runes) == 1 {
+			return fraction, true
+		}
+
+		whole, ok := parseNumber(string(runes[:len(runes)-1]))
+		return whole + fraction, ok
+	}
+
+	if numerator, denominator, found := strings.Cut(s, "/"); found {
+		n, err := strconv.ParseFloat(numerator, 64)
+		if err != nil {
+			return 0, false
+		}
+
+		d, err := strconv.ParseFloat(denominator, 64)
+		if err != nil || d == 0 {
+			return 0, false
+		}
+
+		return n / d, true
+	}
+
+	value, err := strconv.ParseFloat(strings.Replace(s, ",", ".", 1), 64)
+	return value, err == nil
+}
+
+// parseRange parses a single number or a range such as "4-5", returning the
+// upper bound.
+func parseRange(s string) (float64, bool) {
+	if match := rangePattern.FindStringSubmatch(s); match != nil {
+		if _, ok := parseNumber(match[1]); ok {
+			return parseNumber(match[2])
+		}
+	}
+
+	return parseNumber(s)
+}
+
+// parseQuantity reads a quantity from the leading tokens, returning how many
+// tokens it consumed.
+func parseQuantity(tokens []string) (float64, int) {
+	if len(tokens) == 0 {
+		return 0, 0
+	}
+
+	quantity, ok := parseRange(tokens[0])
+	if !ok {
+		if value, ok := numberWords[tokens[0]]; ok && len(tokens) > 1 {
+			return value, 1
+		}
+
+		return 0, 0
+	}
+
+	n := 1
+
+	// Mixed numbers, e.g. 1 1/2
+	if n < len(tokens) && quantity == float64(int(quantity)) {
+		if fraction, ok := parseNumber(tokens[n]); ok && fraction < 1 {
+			quantity += fraction
+			n++
+		}
+	}
+
+	// Ranges written out, e.g. 4 to 5
+	if n+1 < len(tokens) && (tokens[n] == "to" || tokens[n] == "-" || tokens[n] == "–" || tokens[n] == "or") {
+		if upper, ok := parseNumber(tokens[n+1]); ok {
+			quantity = upper
+			n += 2
+		}
+	}
+
+	return quantity, n
+}
+
+// tokenize splits the line into words, separating units glued to numbers
+// as in "500g".
+func tokenize(s string) []string {
+	var tokens []string
+	for _, field := range strings.Fields(s) {
+		if match := attachedUnitRegexp.FindStringSubmatch(field); match != nil && IsUnit(match[2]) {
+			tokens = append(tokens, match[1], match[2])
+			continue
+		}
+
+		tokens = append(tokens, field)
+	}
+
+	return tokens
+}
+
+// parseUnit reads a unit from the leading tokens, returning how many tokens
+// it consumed.
+func parseUnit(tokens []string) (string, int) {
+	if len(tokens) > 1 {
+		if u, ok := lookupUnit(tokens[0] + " " + tokens[1]); ok {
+			return u.name, 2
+		}
+	}
+
+	if len(tokens) > 0 {
+		if u, ok := lookupUnit(tokens[0]); ok {
+			return u.name, 1
+		}
+	}
+
+	return "", 0
+}
+
+// Parse parses an ingredient line. It reports false for lines that are not
+// ingredients, such as blank lines, HTML separators and section headings.
+func Parse(line string) (Ingredient, bool) {
+	raw := strings.TrimSpace(strings.ReplaceAll(line, "\r", ""))
+	if raw == "" || strings.HasPrefix(raw, "<") || strings.HasSuffix(raw, ":") {
+		return Ingredient{}, false
+	}
+
+	ingredient := Ingredient{Raw: raw}
+
+	text := strings.ToLower(raw)
+
+	var notes []string
+	for _, match := range parenthesesPattern.FindAllStringSubmatch(text, -1) {
+		notes = append(notes, strings.TrimSpace(match[1]))
+	}
+	text = parenthesesPattern.ReplaceAllString(text, " ")
+
+	text, note, _ := strings.Cut(text, ",")
+	if note = strings.TrimSpace(note); note != "" {
+		notes = append([]string{note}, notes...)
+	}
+	ingredient.Note = strings.Join(notes, "; ")
+
+	tokens := tokenize(text)
+
+	quantity, n := parseQuantity(tokens)
+	ingredient.Quantity = quantity
+	tokens = tokens[n:]
+
+	// Sized containers, e.g. 1 14-oz can
+	if n > 0 && len(tokens) > 2 {
+		if _, ok := parseRange(tokens[0]); ok {
+			if size, m := parseUnit(tokens[1:]); size != "" {
+				if container, k := parseUnit(tokens[1+m:]); container != "" {
+					if u, _ := lookupUnit(container); u.dimension == Count {
+						ingredient.Unit = container
+						tokens = tokens[1+m+k:]
+					}
+				}
+			}
+		}
+	}
+
+	if ingredient.Unit == "" {
+		var m int
+		ingredient.Unit, m = parseUnit(tokens)
+		tokens = tokens[m:]
+
+		// A single sized container, e.g. 14-oz can, is measured by its size
+		if u, _ := lookupUnit(ingredient.Unit); m > 0 && u.dimension != Count {
+			if container, k := parseUnit(tokens); container != "" {
+				if u, _ := lookupUnit(container); u.dimension == Count {
+					tokens = tokens[k:]
+				}
+			}
+		}
+	}
+
+	if len(tokens) > 0 && tokens[0] == "of" {
+		tokens = tokens[1:]
+	}
+
+	// Units after the name, e.g. 2 garlic cloves
+	if ingredient.Unit == "" && quantity > 0 && len(tokens) > 1 {
+		if u, ok := lookupUnit(tokens[len(tokens)-1]); ok && u.dimension == Count {
+			ingredient.Unit = u.name
+			tokens = tokens[:len(tokens)-1]
+		}
+	}
+
+	ingredient.Name = Normalize(strings.Join(tokens, " "))
+	if ingredient.Name == "" || strings.IndexFunc(ingredient.Name, unicode.IsLetter) < 0 {
+		return Ingredient{}, false
+	}
+
+	return ingredient, true
+}
+
+// ParseAll parses ingredient lines, skipping the ones that are not ingredients.
+func ParseAll(lines []string) []Ingredient {
+	ingredients := make([]Ingredient, 0, len(lines))
+	for _, line := range lines {
+		if ingredient, ok := Parse(line); ok {
+			ingredients = append(ingredients, ingredient)
+		}
+	}
+
+	return ingredients
+}
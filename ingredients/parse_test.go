@@ -0,0 +1,136 @@
+package ingredients
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		line string
+		want Ingredient
+	}{
+		{"2 cups all-purpose flour", Ingredient{Quantity: 2, Unit: "cup", Name: "all-purpose flour"}},
+		{"1 1/2 teaspoons kosher salt", Ingredient{Quantity: 1.5, Unit: "tsp", Name: "salt"}},
+		{"½ cup extra-virgin olive oil", Ingredient{Quantity: 0.5, Unit: "cup", Name: "olive oil"}},
+		{"500g spaghetti", Ingredient{Quantity: 500, Unit: "g", Name: "spaghetti"}},
+		{"3 large eggs, beaten", Ingredient{Quantity: 3, Name: "egg", Note: "beaten"}},
+		{"2 garlic cloves, minced", Ingredient{Quantity: 2, Unit: "clove", Name: "garlic", Note: "minced"}},
+		{"1 (14-ounce) can diced tomatoes", Ingredient{Quantity: 1, Unit: "can", Name: "tomato", Note: "14-ounce"}},
+		{"1 14 oz can chickpeas, drained", Ingredient{Quantity: 1, Unit: "can", Name: "chickpea", Note: "drained"}},
+		{"2 14-oz cans tomatoes", Ingredient{Quantity: 2, Unit: "can", Name: "tomato"}},
+		{"14-oz can chickpeas", Ingredient{Quantity: 14, Unit: "oz", Name: "chickpea"}},
+		{"4 to 5 tomatoes", Ingredient{Quantity: 5, Name: "tomato"}},
+		{"2-3 tbsp butter or margarine", Ingredient{Quantity: 3, Unit: "tbsp", Name: "butter"}},
+		{"Salt to taste", Ingredient{Name: "salt"}},
+		{"3 scallions, thinly sliced\r", Ingredient{Quantity: 3, Name: "green onion", Note: "thinly sliced"}},
+	}
+
+	for _, tt := range tests {
+		got, ok := Parse(tt.line)
+		if !ok {
+			t.Errorf("Parse(%q) is not an ingredient", tt.line)
+			continue
+		}
+
+		got.Raw = ""
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseSkipsNonIngredients(t *testing.T) {
+	for _, line := range []string{"", "  ", "<hr>", "For the dressing:"} {
+		if got, ok := Parse(line); ok {
+			t.Errorf("Parse(%q) = %+v, want no ingredient", line, got)
+		}
+	}
+}
+
+func TestDisplay(t *testing.T) {
+	tests := []struct {
+		quantity float64
+		unit     string
+		system   string
+		want     float64
+		wantUnit string
+	}{
+		{1500, "g", Metric, 1.5, "kg"},
+		{250, "g", Metric, 250, "g"},
+		{453.592, "g", Imperial, 1, "lb"},
+		{236.588, "ml", Imperial, 1, "cup"},
+		{2, "can", Imperial, 2, "can"},
+	}
+
+	for _, tt := range tests {
+		got, gotUnit := Display(tt.quantity, tt.unit, tt.system)
+		if got != tt.want || gotUnit != tt.wantUnit {
+			t.Errorf("Display(%v, %q, %q) = %v %q, want %v %q", tt.quantity, tt.unit, tt.system, got, gotUnit, tt.want, tt.wantUnit)
+		}
+	}
+}
+
+func TestAisle(t *testing.T) {
+	tests := map[string]string{
+		"chicken broth":     AisleCanned,
+		"chicken breast":    AisleMeat,
+		"bell pepper":       AisleProduce,
+		"black pepper":      AisleSpices,
+		"olive oil":         AisleCondiments,
+		"egg":               AisleDairy,
+		"all-purpose flour": AisleBaking,
+		"frozen pea":        AisleFrozen,
+		"unobtainium":       AisleOther,
+	}
+
+	for name, want := range tests {
+		if got := Aisle(name); got != want {
+			t.Errorf("Aisle(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestViolates(t *testing.T) {
+	tests := []struct {
+		name string
+		diet string
+		want bool
+	}{
+		{"butter", DietVegan, true},
+		{"peanut butter", DietVegan, false},
+		{"peanut butter", DietNutFree, true},
+		{"coconut milk", DietDairyFree, false},
+		{"eggplant", DietEggFree, false},
+		{"egg", DietVegetarian, false},
+		{"chicken broth", DietVegetarian, true},
+		{"all-purpose flour", DietGlutenFree, true},
+		{"rice flour", DietGlutenFree, false},
+		{"nutmeg", DietNutFree, false},
+	}
+
+	for _, tt := range tests {
+		if got := Violates(tt.name, tt.diet); got != tt.want {
+			t.Errorf("Violates(%q, %q) = %v, want %v", tt.name, tt.diet, got, tt.want)
+		}
+	}
+}
+
+func TestLabels(t *testing.T) {
+	diets, allergens := Labels([]string{
+		"2 cups all-purpose flour",
+		"1 cup whole milk",
+		"1 tbsp Dijon mustard",
+		"2 tbsp olive oil",
+	})
+
+	wantDiets := []string{DietVegetarian, DietEggFree, DietNutFree}
+	if strings.Join(diets, ",") != strings.Join(wantDiets, ",") {
+		t.Errorf("diets = %q, want %q", diets, wantDiets)
+	}
+
+	wantAllergens := []string{AllergenGluten, AllergenMilk, AllergenMustard}
+	if strings.Join(allergens, ",") != strings.Join(wantAllergens, ",") {
+		t.Errorf("allergens = %q, want %q", allergens, wantAllergens)
+	}
+}
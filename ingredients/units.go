@@ -0,0 +1,161 @@
+package ingredients
+
+import (
+	"math"
+	"strings"
+)
+
+// Dimension tells how amounts of an ingredient can be converted.
+type Dimension int
+
+const (
+	// Count is used for pieces and for containers such as cans, which cannot
+	// be converted to anything else.
+	Count Dimension = iota
+	Mass
+	Volume
+)
+
+const (
+	Metric   = "metric"
+	Imperial = "imperial"
+)
+
+type unit struct {
+	name      string
+	dimension Dimension
+	// factor converts the unit to grams or millilitres
+	factor float64
+}
+
+var canonicalUnits = []unit{
+	{"mg", Mass, 0.001},
+	{"g", Mass, 1},
+	{"kg", Mass, 1000},
+	{"oz", Mass, 28.3495},
+	{"lb", Mass, 453.592},
+	{"ml", Volume, 1},
+	{"cl", Volume, 10},
+	{"dl", Volume, 100},
+	{"l", Volume, 1000},
+	{"tsp", Volume, 4.92892},
+	{"tbsp", Volume, 14.7868},
+	{"fl oz", Volume, 29.5735},
+	{"cup", Volume, 236.588},
+	{"pint", Volume, 473.176},
+	{"quart", Volume, 946.353},
+	{"gallon", Volume, 3785.41},
+	{"bag", Count, 1},
+	{"bottle", Count, 1},
+	{"box", Count, 1},
+	{"bunch", Count, 1},
+	{"can", Count, 1},
+	{"clove", Count, 1},
+	{"dash", Count, 1},
+	{"envelope", Count, 1},
+	{"handful", Count, 1},
+	{"head", Count, 1},
+	{"jar", Count, 1},
+	{"loaf", Count, 1},
+	{"package", Count, 1},
+	{"piece", Count, 1},
+	{"pinch", Count, 1},
+	{"slice", Count, 1},
+	{"sprig", Count, 1},
+	{"stalk", Count, 1},
+	{"stick", Count, 1},
+}
+
+var unitAliases = map[string]string{
+	"milligram": "mg", "milligrams": "mg",
+	"gram": "g", "grams": "g", "gr": "g",
+	"kilogram": "kg", "kilograms": "kg", "kilo": "kg", "kilos": "kg",
+	"ounce": "oz", "ounces": "oz",
+	"pound": "lb", "pounds": "lb", "lbs": "lb",
+	"millilitre": "ml", "milliliter": "ml", "millilitres": "ml", "milliliters": "ml",
+	"litre": "l", "liter": "l", "litres": "l", "liters": "l",
+	"teaspoon": "tsp", "teaspoons": "tsp", "tsps": "tsp",
+	"tablespoon": "tbsp", "tablespoons": "tbsp", "tbsps": "tbsp", "tbs": "tbsp", "tbl": "tbsp",
+	"fluid ounce": "fl oz", "fluid ounces": "fl oz", "fl. oz": "fl oz",
+	"cups":  "cup",
+	"pints": "pint", "pt": "pint",
+	"quarts": "quart", "qt": "quart",
+	"gallons": "gallon", "gal": "gallon",
+	"bags": "bag", "bottles": "bottle", "boxes": "box", "bunches": "bunch",
+	"cans": "can", "tin": "can", "tins": "can", "cloves": "clove", "dashes": "dash",
+	"envelopes": "envelope", "handfuls": "handful", "heads": "head", "jars": "jar",
+	"loaves": "loaf", "packages": "package", "pkg": "package", "packet": "package",
+	"packets": "package", "pieces": "piece", "pinches": "pinch", "slices": "slice",
+	"sprigs": "sprig", "stalks": "stalk", "sticks": "stick",
+}
+
+func lookupUnit(s string) (unit, bool) {
+	s = strings.TrimSuffix(strings.ToLower(s), ".")
+	if alias, ok := unitAliases[s]; ok {
+		s = alias
+	}
+
+	for _, u := range canonicalUnits {
+		if u.name == s {
+			return u, true
+		}
+	}
+
+	return unit{}, false
+}
+
+// IsUnit reports whether s is a known unit or one of its spellings.
+func IsUnit(s string) bool {
+	_, ok := lookupUnit(s)
+	return ok
+}
+
+// ToBase converts an amount to grams or millilitres. Amounts in count units
+// are returned unchanged.
+func ToBase(quantity float64, unitName string) (float64, string, Dimension) {
+	u, ok := lookupUnit(unitName)
+	if !ok {
+		return quantity, unitName, Count
+	}
+
+	switch u.dimension {
+	case Mass:
+		return quantity * u.factor, "g", Mass
+	case Volume:
+		return quantity * u.factor, "ml", Volume
+	default:
+		return quantity, u.name, Count
+	}
+}
+
+// Display converts an amount in grams or millilitres to the most readable
+// unit of the measurement system.
+func Display(quantity float64, baseUnit string, system string) (float64, string) {
+	var candidates []string
+	switch {
+	case baseUnit == "g" && system == Imperial:
+		candidates = []string{"lb", "oz"}
+	case baseUnit == "g":
+		candidates = []string{"kg", "g"}
+	case baseUnit == "ml" && system == Imperial:
+		candidates = []string{"gallon", "quart", "cup", "tbsp", "tsp"}
+	case baseUnit == "ml":
+		candidates = []string{"l", "ml"}
+	default:
+		return Round(quantity), baseUnit
+	}
+
+	for _, name := range candidates {
+		u, _ := lookupUnit(name)
+		if value := quantity / u.factor; value >= 1 || name == candidates[len(candidates)-1] {
+			return Round(value), name
+		}
+	}
+
+	return Round(quantity), baseUnit
+}
+
+// Round rounds to two decimal places, which is as precise as a kitchen gets.
+func Round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -25,9 +25,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -37,6 +40,9 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 
 	"github.com/harmlessevil/recipes-api/handlers"
+	"github.com/harmlessevil/recipes-api/media"
+	"github.com/harmlessevil/recipes-api/models"
+	"github.com/harmlessevil/recipes-api/scraper"
 
 	_ "embed"
 )
@@ -70,6 +76,45 @@ func connectToRedis(ctx context.Context) (*redis.Client, error) {
 	return redisClient, nil
 }
 
+// newBlobStore stores uploaded media in the directory MEDIA_DIR, or in an
+// S3 compatible bucket if MEDIA_STORE is s3. MEDIA_DIR defaults to uploads
+// in the working directory, and to the /uploads volume in the Docker image.
+func newBlobStore() (media.BlobStore, error) {
+	switch os.Getenv("MEDIA_STORE") {
+	case "", "local":
+		dir := os.Getenv("MEDIA_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+
+		baseURL := os.Getenv("MEDIA_BASE_URL")
+		if baseURL == "" {
+			baseURL = "/media"
+		}
+
+		return &media.LocalStore{Dir: dir, BaseURL: baseURL}, nil
+	case "s3":
+		return &media.S3Store{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			PublicURL: os.Getenv("S3_PUBLIC_URL"),
+			Client:    &http.Client{Timeout: 30 * time.Second},
+		}, nil
+	default:
+		return nil, errors.New("unknown MEDIA_STORE " + os.Getenv("MEDIA_STORE") + ", expected local or s3")
+	}
+}
+
+// defaultTrustedProxies are the networks X-Forwarded-For is trusted from
+// unless TRUSTED_PROXIES lists others.
+var defaultTrustedProxies = []string{
+	"127.0.0.0/8", "::1/128",
+	"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7",
+}
+
 func versionHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"version": os.Getenv("API_VERSION"),
@@ -91,36 +136,269 @@ func runMain() error {
 
 	recipesCollection := mongoDBClient.Database(os.Getenv("MONGO_DATABASE")).Collection("stepByStepRecipes")
 	usersCollection := mongoDBClient.Database(os.Getenv("MONGO_DATABASE")).Collection("users")
+	apiKeysCollection := mongoDBClient.Database(os.Getenv("MONGO_DATABASE")).Collection("apiKeys")
+	auditLogCollection := mongoDBClient.Database(os.Getenv("MONGO_DATABASE")).Collection("auditLog")
+
+	auditHandler := handlers.NewAuditHandler(ctx, auditLogCollection)
+	if err := auditHandler.CreateIndexes(); err != nil {
+		return err
+	}
+
+	authHandler := handlers.NewAuthHandler(ctx, usersCollection, apiKeysCollection, redisClient, auditHandler)
+	if err := authHandler.CreateIndexes(); err != nil {
+		return err
+	}
+
+	usersHandler := handlers.NewUsersHandler(ctx, usersCollection, recipesCollection, auditHandler)
+	if err := usersHandler.CreateIndexes(); err != nil {
+		return err
+	}
+
+	blobStore, err := newBlobStore()
+	if err != nil {
+		return err
+	}
+
+	recipesHandler := handlers.NewRecipesHandler(ctx, recipesCollection, redisClient, blobStore, auditHandler)
+	if err := recipesHandler.CreateIndexes(); err != nil {
+		return err
+	}
+
+	if err := recipesHandler.BackfillDerivedFields(); err != nil {
+		return err
+	}
+
+	reviewsCollection := mongoDBClient.Database(os.Getenv("MONGO_DATABASE")).Collection("reviews")
+	reviewsHandler := handlers.NewReviewsHandler(ctx, reviewsCollection, recipesCollection, redisClient, auditHandler)
+	if err := reviewsHandler.CreateIndexes(); err != nil {
+		return err
+	}
+
+	commentsCollection := mongoDBClient.Database(os.Getenv("MONGO_DATABASE")).Collection("comments")
+	commentsHandler := handlers.NewCommentsHandler(ctx, commentsCollection, recipesCollection, redisClient, auditHandler)
+	if err := commentsHandler.CreateIndexes(); err != nil {
+		return err
+	}
+
+	favoritesCollection := mongoDBClient.Database(os.Getenv("MONGO_DATABASE")).Collection("favorites")
+	favoritesHandler := handlers.NewFavoritesHandler(ctx, favoritesCollection, recipesCollection, redisClient, auditHandler)
+	if err := favoritesHandler.CreateIndexes(); err != nil {
+		return err
+	}
+
+	cookbooksCollection := mongoDBClient.Database(os.Getenv("MONGO_DATABASE")).Collection("cookbooks")
+	cookbooksHandler := handlers.NewCookbooksHandler(ctx, cookbooksCollection, recipesCollection, auditHandler)
+	if err := cookbooksHandler.CreateIndexes(); err != nil {
+		return err
+	}
+
+	mealPlansCollection := mongoDBClient.Database(os.Getenv("MONGO_DATABASE")).Collection("mealPlans")
+	mealPlansHandler := handlers.NewMealPlansHandler(ctx, mealPlansCollection, recipesCollection, auditHandler)
+	if err := mealPlansHandler.CreateIndexes(); err != nil {
+		return err
+	}
+
+	shoppingListsCollection := mongoDBClient.Database(os.Getenv("MONGO_DATABASE")).Collection("shoppingLists")
+	shoppingListsHandler := handlers.NewShoppingListsHandler(ctx, shoppingListsCollection, recipesCollection, mealPlansCollection, usersCollection, auditHandler)
+	if err := shoppingListsHandler.CreateIndexes(); err != nil {
+		return err
+	}
+
+	pantryCollection := mongoDBClient.Database(os.Getenv("MONGO_DATABASE")).Collection("pantry")
+	pantryHandler := handlers.NewPantryHandler(ctx, pantryCollection, recipesCollection, auditHandler)
+	if err := pantryHandler.CreateIndexes(); err != nil {
+		return err
+	}
+
+	substitutionsCollection := mongoDBClient.Database(os.Getenv("MONGO_DATABASE")).Collection("substitutions")
+	substitutionsHandler := handlers.NewSubstitutionsHandler(ctx, substitutionsCollection, recipesCollection, auditHandler)
+	if err := substitutionsHandler.CreateIndexes(); err != nil {
+		return err
+	}
+
+	nutritionHandler := handlers.NewNutritionHandler(ctx, recipesCollection, redisClient)
+
+	cookingHandler := handlers.NewCookingHandler(ctx, recipesCollection, redisClient, auditHandler)
+
+	scraperClient := &scraper.Client{HTTPClient: scraper.NewHTTPClient(15 * time.Second)}
+	importHandler := handlers.NewImportHandler(ctx, recipesCollection, scraperClient, auditHandler)
+
+	imagesHandler := handlers.NewImagesHandler(ctx, recipesCollection, blobStore, redisClient, auditHandler)
 
-	authHandler := handlers.NewAuthHandler(ctx, usersCollection)
-	recipesHandler := handlers.NewRecipesHandler(ctx, recipesCollection, redisClient)
+	printHandler := handlers.NewPrintHandler(ctx, recipesCollection, cookbooksHandler, blobStore)
+
+	similarHandler := handlers.NewSimilarHandler(ctx, recipesCollection, redisClient)
+	similarInterval := time.Hour
+	if value := os.Getenv("SIMILAR_REFRESH_INTERVAL"); value != "" {
+		if similarInterval, err = time.ParseDuration(value); err != nil || similarInterval <= 0 {
+			return errors.New("invalid SIMILAR_REFRESH_INTERVAL " + value + ", expected a duration such as 1h")
+		}
+	}
+	go similarHandler.Run(similarInterval)
+
+	duplicatesHandler := handlers.NewDuplicatesHandler(ctx, recipesCollection, reviewsCollection, commentsCollection, favoritesCollection,
+		cookbooksCollection, mealPlansCollection, shoppingListsCollection, redisClient, auditHandler)
+
+	rateLimiter := handlers.NewRateLimiter(ctx, redisClient,
+		handlers.RateLimit{Requests: 300, Period: time.Minute},
+		handlers.RateLimit{Requests: 60, Period: time.Minute},
+	)
 
 	router := gin.Default()
 
+	// Client IPs come from the X-Forwarded-For header set by nginx, which
+	// is only trusted from the proxies, by default the loopback and private
+	// networks nginx runs on
+	router.RemoteIPHeaders = []string{"X-Forwarded-For"}
+	trustedProxies := defaultTrustedProxies
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		trustedProxies = strings.Split(proxies, ",")
+	}
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		return err
+	}
+
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowCredentials = true
-	corsConfig.AllowHeaders = append(corsConfig.AllowHeaders, "Authorization")
+	corsConfig.AllowHeaders = append(corsConfig.AllowHeaders, "Authorization", "X-Request-ID")
 	corsConfig.AllowOrigins = []string{"http://localhost:5173"}
+	corsConfig.ExposeHeaders = []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", "X-Request-ID"}
 
-	router.Use(cors.New(corsConfig))
+	router.Use(cors.New(corsConfig), handlers.RequestID())
 
 	router.GET("/version", versionHandler)
-	router.GET("/recipes", recipesHandler.ListRecipesHandler)
-	router.GET("/recipes/:id", recipesHandler.GetRecipeHandler)
-	router.GET("/recipes/search", recipesHandler.SearchRecipesHandler)
 
-	authenticated := router.Group("/")
+	if localStore, ok := blobStore.(*media.LocalStore); ok {
+		router.Static("/media", localStore.Dir)
+	}
 
 	authMiddleware, err := authHandler.AuthMiddleware()
 	if err != nil {
 		return err
 	}
 
-	authenticated.Use(authMiddleware)
+	// Public routes authenticate callers that send credentials, who can
+	// see their own drafts there
+	public := router.Group("/")
+	public.Use(rateLimiter.Middleware(), handlers.OptionalAuth(authMiddleware), rateLimiter.Middleware())
+	{
+		public.GET("/recipes", recipesHandler.ListRecipesHandler)
+		public.GET("/recipes/:id", recipesHandler.GetRecipeHandler)
+		public.GET("/recipes/:id/print", printHandler.PrintRecipeHandler)
+		public.GET("/recipes/:id/similar", similarHandler.ListSimilarHandler)
+		public.GET("/recipes/search", recipesHandler.SearchRecipesHandler)
+		public.GET("/recipes/:id/reviews", reviewsHandler.ListReviewsHandler)
+		public.GET("/recipes/:id/comments", commentsHandler.ListCommentsHandler)
+		public.GET("/recipes/:id/substitutions", substitutionsHandler.RecipeSubstitutionsHandler)
+		public.GET("/recipes/:id/nutrition", nutritionHandler.GetNutritionHandler)
+		public.GET("/recipes/:id/steps/:n", cookingHandler.GetStepHandler)
+		public.GET("/substitutions", substitutionsHandler.ListSubstitutionsHandler)
+		public.GET("/users/:id", usersHandler.GetUserHandler)
+	}
+
+	// Refreshing takes the refresh token in place of credentials, which may
+	// have expired by then
+	router.POST("/sessions/refresh", rateLimiter.Middleware(), authHandler.RefreshSessionHandler)
+
+	authenticated := router.Group("/")
+
+	// Throttled by IP first, so that invalid credentials are not looked up
+	// without limit
+	authenticated.Use(rateLimiter.Middleware(), authMiddleware, rateLimiter.Middleware(), authHandler.ProvisionUser)
+	{
+		authenticated.POST("/recipes", authHandler.RequireScope(handlers.ScopeRecipesWrite), recipesHandler.NewRecipeHandler)
+		authenticated.PUT("/recipes/:id", authHandler.RequireScope(handlers.ScopeRecipesWrite), recipesHandler.UpdateRecipeHandler)
+		authenticated.DELETE("/recipes/:id", authHandler.RequireScope(handlers.ScopeRecipesWrite), recipesHandler.DeleteRecipeHandler)
+		authenticated.PUT("/recipes/:id/labels", authHandler.RequireScope(handlers.ScopeRecipesWrite), recipesHandler.OverrideLabelsHandler)
+		authenticated.POST("/recipes/:id/publish", authHandler.RequireScope(handlers.ScopeRecipesWrite), recipesHandler.PublishRecipeHandler)
+		authenticated.GET("/recipes/export", authHandler.RequireScope(handlers.ScopeRecipesRead), recipesHandler.ExportRecipesHandler)
+		authenticated.GET("/me/drafts", authHandler.RequireScope(handlers.ScopeRecipesRead), recipesHandler.ListDraftsHandler)
+		authenticated.POST("/recipes/bulk", authHandler.RequireScope(handlers.ScopeRecipesWrite), recipesHandler.BulkRecipesHandler)
+		authenticated.POST("/recipes/import", authHandler.RequireScope(handlers.ScopeRecipesWrite), importHandler.ImportRecipeHandler)
+		authenticated.POST("/recipes/import/file", authHandler.RequireScope(handlers.ScopeRecipesWrite), recipesHandler.ImportRecipeFileHandler)
+		authenticated.POST("/recipes/:id/images", authHandler.RequireScope(handlers.ScopeRecipesWrite), imagesHandler.UploadImageHandler)
+		authenticated.PUT("/recipes/:id/images/order", authHandler.RequireScope(handlers.ScopeRecipesWrite), imagesHandler.ReorderImagesHandler)
+		authenticated.DELETE("/recipes/:id/images/:imageId", authHandler.RequireScope(handlers.ScopeRecipesWrite), imagesHandler.DeleteImageHandler)
+	}
+
+	// API keys are limited to the routes above, granted by their scopes
+	interactive := authenticated.Group("/")
+	interactive.Use(authHandler.RejectAPIKey())
+	{
+		interactive.POST("/sessions", authHandler.NewSessionHandler)
+		interactive.GET("/sessions", authHandler.ListSessionsHandler)
+		interactive.DELETE("/sessions/:id", authHandler.DeleteSessionHandler)
+
+		interactive.GET("/me", usersHandler.GetMeHandler)
+		interactive.PUT("/me", usersHandler.UpdateMeHandler)
+
+		interactive.POST("/recipes/:id/reviews", reviewsHandler.NewReviewHandler)
+		interactive.GET("/me/reviews", reviewsHandler.ListMyReviewsHandler)
+		interactive.PUT("/reviews/:id", reviewsHandler.UpdateReviewHandler)
+		interactive.DELETE("/reviews/:id", reviewsHandler.DeleteReviewHandler)
+
+		interactive.POST("/recipes/:id/comments", commentsHandler.NewCommentHandler)
+		interactive.PUT("/comments/:id", commentsHandler.UpdateCommentHandler)
+		interactive.DELETE("/comments/:id", commentsHandler.DeleteCommentHandler)
+		interactive.POST("/comments/:id/flag", commentsHandler.FlagCommentHandler)
+
+		interactive.POST("/recipes/:id/favorite", favoritesHandler.AddFavoriteHandler)
+		interactive.DELETE("/recipes/:id/favorite", favoritesHandler.RemoveFavoriteHandler)
+		interactive.GET("/me/favorites", favoritesHandler.ListFavoritesHandler)
+
+		interactive.POST("/cookbooks", cookbooksHandler.NewCookbookHandler)
+		interactive.GET("/me/cookbooks", cookbooksHandler.ListMyCookbooksHandler)
+		interactive.GET("/cookbooks/:id", cookbooksHandler.GetCookbookHandler)
+		interactive.GET("/cookbooks/:id/print", printHandler.PrintCookbookHandler)
+		interactive.PUT("/cookbooks/:id", cookbooksHandler.UpdateCookbookHandler)
+		interactive.DELETE("/cookbooks/:id", cookbooksHandler.DeleteCookbookHandler)
+		interactive.POST("/cookbooks/:id/recipes", cookbooksHandler.AddCookbookRecipeHandler)
+		interactive.PUT("/cookbooks/:id/recipes/:recipeId", cookbooksHandler.UpdateCookbookRecipeHandler)
+		interactive.DELETE("/cookbooks/:id/recipes/:recipeId", cookbooksHandler.RemoveCookbookRecipeHandler)
+		interactive.PUT("/cookbooks/:id/order", cookbooksHandler.ReorderCookbookHandler)
+
+		interactive.GET("/mealplans/:week", mealPlansHandler.GetMealPlanHandler)
+		interactive.PUT("/mealplans/:week/slots/:day/:meal", mealPlansHandler.FillSlotHandler)
+		interactive.DELETE("/mealplans/:week/slots/:day/:meal", mealPlansHandler.ClearSlotHandler)
+		interactive.POST("/mealplans/:week/move", mealPlansHandler.MoveSlotHandler)
+		interactive.POST("/mealplans/:week/copy", mealPlansHandler.CopyMealPlanHandler)
+
+		interactive.POST("/shopping-lists", shoppingListsHandler.NewShoppingListHandler)
+		interactive.GET("/shopping-lists", shoppingListsHandler.ListShoppingListsHandler)
+		interactive.GET("/shopping-lists/:id", shoppingListsHandler.GetShoppingListHandler)
+		interactive.PATCH("/shopping-lists/:id/items/:itemId", shoppingListsHandler.CheckItemHandler)
+		interactive.DELETE("/shopping-lists/:id", shoppingListsHandler.DeleteShoppingListHandler)
+
+		interactive.GET("/pantry", pantryHandler.ListPantryHandler)
+		interactive.POST("/pantry", pantryHandler.AddPantryItemHandler)
+		interactive.DELETE("/pantry/:id", pantryHandler.DeletePantryItemHandler)
+		interactive.GET("/recipes/cookable", pantryHandler.CookableRecipesHandler)
+
+		interactive.GET("/me/cooking", cookingHandler.ListCookingSessionsHandler)
+		interactive.GET("/recipes/:id/cooking", cookingHandler.GetCookingSessionHandler)
+		interactive.PUT("/recipes/:id/cooking", cookingHandler.UpdateCookingSessionHandler)
+		interactive.DELETE("/recipes/:id/cooking", cookingHandler.DeleteCookingSessionHandler)
+		interactive.POST("/recipes/:id/cooking/timers", cookingHandler.StartTimerHandler)
+		interactive.PATCH("/recipes/:id/cooking/timers/:timerId", cookingHandler.UpdateTimerHandler)
+		interactive.DELETE("/recipes/:id/cooking/timers/:timerId", cookingHandler.DeleteTimerHandler)
+
+		interactive.POST("/apikeys", authHandler.NewAPIKeyHandler)
+		interactive.GET("/apikeys", authHandler.ListAPIKeysHandler)
+		interactive.DELETE("/apikeys/:id", authHandler.DeleteAPIKeyHandler)
+	}
+
+	moderators := interactive.Group("/admin")
+	moderators.Use(authHandler.RequireRole(models.RoleModerator))
 	{
-		authenticated.POST("/recipes", recipesHandler.NewRecipeHandler)
-		authenticated.PUT("/recipes/:id", recipesHandler.UpdateRecipeHandler)
-		authenticated.DELETE("/recipes/:id", recipesHandler.DeleteRecipeHandler)
+		moderators.GET("/audit", auditHandler.ListAuditHandler)
+		moderators.GET("/recipes/duplicates", duplicatesHandler.ListDuplicatesHandler)
+		moderators.POST("/recipes/:id/merge", duplicatesHandler.MergeRecipesHandler)
+		moderators.GET("/comments/flagged", commentsHandler.ListFlaggedCommentsHandler)
+		moderators.POST("/comments/:id/approve", commentsHandler.ApproveCommentHandler)
+		moderators.POST("/comments/:id/reject", commentsHandler.RejectCommentHandler)
+		moderators.POST("/substitutions", substitutionsHandler.NewSubstitutionHandler)
+		moderators.PUT("/substitutions/:id", substitutionsHandler.UpdateSubstitutionHandler)
+		moderators.DELETE("/substitutions/:id", substitutionsHandler.DeleteSubstitutionHandler)
 	}
 
 	return router.Run()
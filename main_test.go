@@ -9,12 +9,17 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
+	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
+	"github.com/auth0/go-jwt-middleware/v2/validator"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/assert/v2"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -33,9 +38,10 @@ func setupRouter(t *testing.T) *gin.Engine {
 	require.NoError(t, err)
 
 	c := mongoDBClient.Database(os.Getenv("MONGO_DATABASE")).Collection("stepByStepRecipes")
-	h := handlers.NewRecipesHandler(ctx, c, redisClient)
+	h := handlers.NewRecipesHandler(ctx, c, redisClient, nil, nil)
 
 	router := gin.Default()
+	router.Use(handlers.OptionalAuth(testAuth))
 
 	router.GET("/recipes", h.ListRecipesHandler)
 	router.POST("/recipes", h.NewRecipeHandler)
@@ -46,6 +52,14 @@ func setupRouter(t *testing.T) *gin.Engine {
 	return router
 }
 
+// testAuth authenticates the user named by an Authorization header of the
+// form "Test <user>", as if they had sent a valid token.
+func testAuth(c *gin.Context) {
+	uid := strings.TrimPrefix(c.GetHeader("Authorization"), "Test ")
+	claims := &validator.ValidatedClaims{RegisteredClaims: validator.RegisteredClaims{Subject: uid}}
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), jwtmiddleware.ContextKey{}, claims))
+}
+
 func connectToMongoDB(ctx context.Context) (*mongo.Client, error) {
 	client, err := mongo.Connect(ctx, options.Client().ApplyURI(os.Getenv("MONGO_URI")))
 	if err != nil {
@@ -262,3 +276,42 @@ func TestDeleteRecipeHandler(t *testing.T) {
 
 	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
 }
+
+func TestGetDraftRecipeHandler(t *testing.T) {
+	ts := httptest.NewServer(setupRouter(t))
+	defer ts.Close()
+
+	mongoDBClient, err := connectToMongoDB(context.Background())
+	require.NoError(t, err)
+
+	c := mongoDBClient.Database(os.Getenv("MONGO_DATABASE")).Collection("stepByStepRecipes")
+	draft := models.Recipe{ID: primitive.NewObjectID(), Name: "Imported Pizza", AuthorID: "author", Draft: true}
+	_, err = c.InsertOne(context.Background(), draft)
+	require.NoError(t, err)
+	defer func() {
+		_, _ = c.DeleteOne(context.Background(), bson.M{"_id": draft.ID})
+	}()
+
+	tests := []struct {
+		user string
+		want int
+	}{
+		{"author", http.StatusOK},
+		{"other", http.StatusNotFound},
+		{"", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/recipes/%s", ts.URL, draft.ID.Hex()), nil)
+		require.NoError(t, err)
+		if test.user != "" {
+			req.Header.Set("Authorization", "Test "+test.user)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+
+		assert.Equal(t, test.want, resp.StatusCode)
+	}
+}
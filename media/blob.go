@@ -0,0 +1,93 @@
+// Package media processes uploaded images and stores them in a blob store.
+package media
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// BlobStore stores uploaded files under slash separated keys.
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+	// URL returns where clients can download the file
+	URL(key string) string
+}
+
+var (
+	ErrNotFound   = errors.New("media: not found")
+	errInvalidKey = errors.New("media: invalid key")
+)
+
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + key)[1:]
+	if cleaned == "" || cleaned != key {
+		return "", errInvalidKey
+	}
+
+	return cleaned, nil
+}
+
+// LocalStore stores files in a directory, which the API serves under
+// BaseURL.
+type LocalStore struct {
+	Dir     string
+	BaseURL string
+}
+
+func (s *LocalStore) Put(_ context.Context, key string, data []byte, _ string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Join(s.Dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that readers never see partial files
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, name)
+}
+
+func (s *LocalStore) Get(_ context.Context, key string) ([]byte, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.Dir, filepath.FromSlash(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	return data, err
+}
+
+func (s *LocalStore) Delete(_ context.Context, key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(filepath.Join(s.Dir, filepath.FromSlash(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+func (s *LocalStore) URL(key string) string {
+	return strings.TrimSuffix(s.BaseURL, "/") + "/" + key
+}
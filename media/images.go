@@ -0,0 +1,167 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// MaxUploadSize is the largest image file accepted
+	MaxUploadSize = 10 << 20
+	// maxPixels bounds the memory needed to decode an image
+	maxPixels   = 40_000_000
+	jpegQuality = 85
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported image type, expected JPEG, PNG, GIF or WebP")
+	ErrTooLarge        = errors.New("image is too large")
+)
+
+// Sizes are the resized variants generated for each image, by the length of
+// their longest side.
+var Sizes = []struct {
+	Name string
+	Max  int
+}{
+	{"thumbnail", 320},
+	{"medium", 960},
+}
+
+var contentTypes = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// Extension returns the file extension for a supported content type.
+func Extension(contentType string) string {
+	return contentTypes[contentType]
+}
+
+// Variant is an encoded version of an uploaded image.
+type Variant struct {
+	Name        string
+	ContentType string
+	Width       int
+	Height      int
+	Data        []byte
+}
+
+// Process validates an uploaded image and returns the original followed by
+// the resized variants, each encoded as JPEG, or PNG if the image is
+// transparent, and also as WebP when that is smaller.
+func Process(data []byte) ([]Variant, error) {
+	if len(data) > MaxUploadSize {
+		return nil, ErrTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	if Extension(contentType) == "" {
+		return nil, ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	variants := []Variant{{
+		Name:        "original",
+		ContentType: contentType,
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+		Data:        data,
+	}}
+
+	opaque := isOpaque(img)
+	for _, size := range Sizes {
+		resized := resize(img, size.Max)
+
+		var encoded bytes.Buffer
+		fallback := "image/jpeg"
+		if opaque {
+			err = jpeg.Encode(&encoded, resized, &jpeg.Options{Quality: jpegQuality})
+		} else {
+			fallback = "image/png"
+			err = png.Encode(&encoded, resized)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var webp bytes.Buffer
+		if err := EncodeWebP(&webp, resized); err != nil {
+			return nil, err
+		}
+
+		width, height := resized.Bounds().Dx(), resized.Bounds().Dy()
+		variants = append(variants, Variant{Name: size.Name, ContentType: fallback, Width: width, Height: height, Data: encoded.Bytes()})
+
+		// WebP is encoded losslessly, which only pays off for flat images
+		// such as illustrations, while photos compress better as JPEG
+		if webp.Len() < encoded.Len() {
+			variants = append(variants, Variant{Name: size.Name, ContentType: "image/webp", Width: width, Height: height, Data: webp.Bytes()})
+		}
+	}
+
+	return variants, nil
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+
+	return false
+}
+
+// resize scales an image down so that its longest side is at most max,
+// keeping the aspect ratio. Smaller images are only copied.
+func resize(img image.Image, max int) *image.NRGBA {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > max || height > max {
+		if width >= height {
+			width, height = max, maxInt(1, height*max/width)
+		} else {
+			width, height = maxInt(1, width*max/height), max
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	if width == bounds.Dx() && height == bounds.Dy() {
+		draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+	} else {
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	}
+
+	return dst
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,105 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+type wantVariant struct {
+	name, contentType string
+	width, height     int
+}
+
+func encodePNG(t *testing.T, fill func(x, y int) color.NRGBA) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, 1200, 600))
+	for y := 0; y < 600; y++ {
+		for x := 0; x < 1200; x++ {
+			img.Set(x, y, fill(x, y))
+		}
+	}
+
+	var data bytes.Buffer
+	if err := png.Encode(&data, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return data.Bytes()
+}
+
+func TestProcess(t *testing.T) {
+	tests := []struct {
+		name string
+		fill func(x, y int) color.NRGBA
+		want []wantVariant
+	}{
+		{
+			// Smooth gradients compress better as JPEG than as lossless WebP
+			name: "photo",
+			fill: func(x, y int) color.NRGBA { return color.NRGBA{uint8(x), uint8(y), 128, 255} },
+			want: []wantVariant{
+				{"original", "image/png", 1200, 600},
+				{"thumbnail", "image/jpeg", 320, 160},
+				{"medium", "image/jpeg", 960, 480},
+			},
+		},
+		{
+			name: "illustration",
+			fill: func(x, y int) color.NRGBA {
+				if x < 600 {
+					return color.NRGBA{200, 40, 40, 255}
+				}
+
+				return color.NRGBA{40, 40, 200, 255}
+			},
+			want: []wantVariant{
+				{"original", "image/png", 1200, 600},
+				{"thumbnail", "image/jpeg", 320, 160},
+				{"thumbnail", "image/webp", 320, 160},
+				{"medium", "image/jpeg", 960, 480},
+				{"medium", "image/webp", 960, 480},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		variants, err := Process(encodePNG(t, test.fill))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(variants) != len(test.want) {
+			t.Fatalf("%s: got %d variants, want %d", test.name, len(variants), len(test.want))
+		}
+
+		for i, w := range test.want {
+			v := variants[i]
+			if v.Name != w.name || v.ContentType != w.contentType || v.Width != w.width || v.Height != w.height {
+				t.Errorf("%s: variant %d = %s %s %dx%d, want %s %s %dx%d", test.name, i,
+					v.Name, v.ContentType, v.Width, v.Height, w.name, w.contentType, w.width, w.height)
+			}
+
+			config, format, err := image.DecodeConfig(bytes.NewReader(v.Data))
+			if err != nil {
+				t.Errorf("%s: variant %d does not decode: %v", test.name, i, err)
+				continue
+			}
+
+			if "image/"+format != w.contentType || config.Width != w.width || config.Height != w.height {
+				t.Errorf("%s: variant %d decodes as %s %dx%d", test.name, i, format, config.Width, config.Height)
+			}
+		}
+	}
+}
+
+func TestProcessRejects(t *testing.T) {
+	if _, err := Process([]byte("%PDF-1.4 not an image")); err != ErrUnsupportedType {
+		t.Errorf("Process(pdf) error = %v, want %v", err, ErrUnsupportedType)
+	}
+
+	if _, err := Process(make([]byte, MaxUploadSize+1)); err != ErrTooLarge {
+		t.Errorf("Process(oversized) error = %v, want %v", err, ErrTooLarge)
+	}
+}
@@ -0,0 +1,458 @@
+package media
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"sort"
+)
+
+// The standard library and golang.org/x/image can only decode WebP, so
+// EncodeWebP implements the lossless VP8L format. It applies the subtract
+// green transform and encodes runs of identical pixels as backward
+// references, which is enough for thumbnails while staying small.
+
+const (
+	vp8lSignature     = 0x2f
+	vp8lMaxDimension  = 1 << 14
+	vp8lMaxCodeLength = 15
+	vp8lMaxRunLength  = 4096
+	subtractGreen     = 2
+
+	numLiterals     = 256
+	numLengthCodes  = 24
+	numDistanceCode = 40
+)
+
+// codeLengthOrder is the order in which the lengths of the code length
+// code are written.
+var codeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+// write appends the n low bits of v, least significant bit first.
+func (w *bitWriter) write(v uint32, n uint) {
+	w.acc |= uint64(v) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nbits -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.nbits = 0, 0
+	}
+
+	return w.buf
+}
+
+// prefixCode encodes a value of a length or distance into a prefix symbol
+// and extra bits.
+func prefixCode(value int) (symbol int, extraBits uint, extra uint32) {
+	d := value - 1
+	if d < 4 {
+		return d, 0, 0
+	}
+
+	highest := uint(0)
+	for v := d; v > 1; v >>= 1 {
+		highest++
+	}
+
+	second := (d >> (highest - 1)) & 1
+	extraBits = highest - 1
+
+	return int(2*highest) + second, extraBits, uint32(d & (1<<extraBits - 1))
+}
+
+type huffmanNode struct {
+	weight int
+	symbol int
+	left   *huffmanNode
+	right  *huffmanNode
+}
+
+type nodeHeap []*huffmanNode
+
+func (h nodeHeap) Len() int { return len(h) }
+func (h nodeHeap) Less(i, j int) bool {
+	if h[i].weight != h[j].weight {
+		return h[i].weight < h[j].weight
+	}
+
+	return h[i].symbol < h[j].symbol
+}
+func (h nodeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *nodeHeap) Push(x any)   { *h = append(*h, x.(*huffmanNode)) }
+func (h *nodeHeap) Pop() any {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
+
+// codeLengths builds Huffman code lengths no longer than limit. Frequencies
+// are flattened until the tree is shallow enough.
+func codeLengths(freqs []int, limit int) []int {
+	lengths := make([]int, len(freqs))
+
+	for shift := 0; ; shift++ {
+		h := &nodeHeap{}
+		for symbol, freq := range freqs {
+			if freq > 0 {
+				weight := freq >> shift
+				if weight == 0 {
+					weight = 1
+				}
+				*h = append(*h, &huffmanNode{weight: weight, symbol: symbol})
+			}
+		}
+
+		if h.Len() < 2 {
+			for _, n := range *h {
+				lengths[n.symbol] = 1
+			}
+			return lengths
+		}
+
+		heap.Init(h)
+		for next := len(freqs); h.Len() > 1; next++ {
+			a := heap.Pop(h).(*huffmanNode)
+			b := heap.Pop(h).(*huffmanNode)
+			heap.Push(h, &huffmanNode{weight: a.weight + b.weight, symbol: next, left: a, right: b})
+		}
+
+		for i := range lengths {
+			lengths[i] = 0
+		}
+
+		maxLength := 0
+		var walk func(n *huffmanNode, depth int)
+		walk = func(n *huffmanNode, depth int) {
+			if n.left == nil {
+				lengths[n.symbol] = depth
+				if depth > maxLength {
+					maxLength = depth
+				}
+				return
+			}
+			walk(n.left, depth+1)
+			walk(n.right, depth+1)
+		}
+		walk((*h)[0], 0)
+
+		if maxLength <= limit {
+			return lengths
+		}
+	}
+}
+
+// canonicalCodes assigns canonical codes to code lengths, bit-reversed so
+// that they can be written least significant bit first.
+func canonicalCodes(lengths []int) []uint32 {
+	type entry struct{ symbol, length int }
+
+	var entries []entry
+	for symbol, length := range lengths {
+		if length > 0 {
+			entries = append(entries, entry{symbol, length})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].length != entries[j].length {
+			return entries[i].length < entries[j].length
+		}
+
+		return entries[i].symbol < entries[j].symbol
+	})
+
+	codes := make([]uint32, len(lengths))
+
+	code, prevLength := uint32(0), 0
+	for _, e := range entries {
+		code <<= uint(e.length - prevLength)
+		prevLength = e.length
+
+		var reversed uint32
+		for i := 0; i < e.length; i++ {
+			reversed |= (code >> uint(i) & 1) << uint(e.length-1-i)
+		}
+
+		codes[e.symbol] = reversed
+		code++
+	}
+
+	return codes
+}
+
+type prefixCodeTable struct {
+	lengths []int
+	codes   []uint32
+}
+
+func (t *prefixCodeTable) writeSymbol(w *bitWriter, symbol int) {
+	w.write(t.codes[symbol], uint(t.lengths[symbol]))
+}
+
+// writePrefixCode writes the code for freqs and returns it.
+func writePrefixCode(w *bitWriter, freqs []int) *prefixCodeTable {
+	var used []int
+	for symbol, freq := range freqs {
+		if freq > 0 {
+			used = append(used, symbol)
+		}
+	}
+
+	// Simple codes hold one or two 8 bit symbols, one symbol taking no bits
+	if len(used) <= 2 && (len(used) == 0 || used[len(used)-1] < 256) {
+		if len(used) == 0 {
+			used = []int{0}
+		}
+
+		w.write(1, 1)
+		w.write(uint32(len(used)-1), 1)
+		w.write(1, 1)
+		for _, symbol := range used {
+			w.write(uint32(symbol), 8)
+		}
+
+		table := &prefixCodeTable{lengths: make([]int, len(freqs)), codes: make([]uint32, len(freqs))}
+		if len(used) == 2 {
+			table.lengths[used[0]], table.lengths[used[1]] = 1, 1
+			table.codes[used[1]] = 1
+		}
+
+		return table
+	}
+
+	lengths := codeLengths(freqs, vp8lMaxCodeLength)
+
+	// Code lengths are written with a code of their own, using symbol 17
+	// and 18 for runs of zeros
+	type token struct{ symbol, extra int }
+
+	var tokens []token
+	for i := 0; i < len(lengths); {
+		if lengths[i] != 0 {
+			tokens = append(tokens, token{lengths[i], 0})
+			i++
+			continue
+		}
+
+		run := 0
+		for i+run < len(lengths) && lengths[i+run] == 0 && run < 138 {
+			run++
+		}
+
+		switch {
+		case run >= 11:
+			tokens = append(tokens, token{18, run - 11})
+		case run >= 3:
+			tokens = append(tokens, token{17, run - 3})
+		default:
+			for j := 0; j < run; j++ {
+				tokens = append(tokens, token{0, 0})
+			}
+		}
+		i += run
+	}
+
+	lengthFreqs := make([]int, 19)
+	for _, t := range tokens {
+		lengthFreqs[t.symbol]++
+	}
+
+	lengthLengths := codeLengths(lengthFreqs, 7)
+
+	// A normal code needs two symbols, so a lone symbol gets an unused partner
+	used = used[:0]
+	for symbol, length := range lengthLengths {
+		if length > 0 {
+			used = append(used, symbol)
+		}
+	}
+	if len(used) == 1 {
+		lengthLengths[(used[0]+1)%len(lengthLengths)] = 1
+	}
+	lengthCodes := canonicalCodes(lengthLengths)
+
+	numCodes := 19
+	for numCodes > 4 && lengthLengths[codeLengthOrder[numCodes-1]] == 0 {
+		numCodes--
+	}
+
+	w.write(0, 1)
+	w.write(uint32(numCodes-4), 4)
+	for i := 0; i < numCodes; i++ {
+		w.write(uint32(lengthLengths[codeLengthOrder[i]]), 3)
+	}
+
+	// All symbols are written, so there is no max_symbol
+	w.write(0, 1)
+
+	for _, t := range tokens {
+		w.write(lengthCodes[t.symbol], uint(lengthLengths[t.symbol]))
+		switch t.symbol {
+		case 17:
+			w.write(uint32(t.extra), 3)
+		case 18:
+			w.write(uint32(t.extra), 7)
+		}
+	}
+
+	return &prefixCodeTable{lengths: lengths, codes: canonicalCodes(lengths)}
+}
+
+// EncodeWebP writes img as a lossless WebP image.
+func EncodeWebP(out io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > vp8lMaxDimension || height > vp8lMaxDimension {
+		return errors.New("webp: invalid image size")
+	}
+
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok || nrgba.Rect.Min != (image.Point{}) {
+		nrgba = image.NewNRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(nrgba, nrgba.Rect, img, bounds.Min, draw.Src)
+	}
+
+	// Pixels as ARGB with the subtract green transform applied
+	pixels := make([]uint32, 0, width*height)
+	opaque := true
+	for y := 0; y < height; y++ {
+		row := nrgba.Pix[y*nrgba.Stride : y*nrgba.Stride+width*4]
+		for x := 0; x < width*4; x += 4 {
+			r, g, b, a := row[x], row[x+1], row[x+2], row[x+3]
+			opaque = opaque && a == 0xff
+			pixels = append(pixels, uint32(a)<<24|uint32(r-g)<<16|uint32(g)<<8|uint32(b-g))
+		}
+	}
+
+	// Runs of the previous pixel become backward references to distance 1,
+	// which is the distance code 2 of the left neighbour
+	type ref struct {
+		pixel  uint32
+		length int
+	}
+
+	var refs []ref
+	for i := 0; i < len(pixels); {
+		run := 0
+		if i > 0 {
+			for i+run < len(pixels) && pixels[i+run] == pixels[i-1] && run < vp8lMaxRunLength {
+				run++
+			}
+		}
+
+		if run >= 3 {
+			refs = append(refs, ref{length: run})
+			i += run
+			continue
+		}
+
+		refs = append(refs, ref{pixel: pixels[i]})
+		i++
+	}
+
+	green := make([]int, numLiterals+numLengthCodes)
+	red := make([]int, numLiterals)
+	blue := make([]int, numLiterals)
+	alpha := make([]int, numLiterals)
+	distance := make([]int, numDistanceCode)
+
+	const leftDistance = 2
+	distanceSymbol, _, _ := prefixCode(leftDistance)
+
+	for _, r := range refs {
+		if r.length > 0 {
+			symbol, _, _ := prefixCode(r.length)
+			green[numLiterals+symbol]++
+			distance[distanceSymbol]++
+			continue
+		}
+
+		alpha[r.pixel>>24]++
+		red[r.pixel>>16&0xff]++
+		green[r.pixel>>8&0xff]++
+		blue[r.pixel&0xff]++
+	}
+
+	w := &bitWriter{}
+	w.write(vp8lSignature, 8)
+	w.write(uint32(width-1), 14)
+	w.write(uint32(height-1), 14)
+	if opaque {
+		w.write(0, 1)
+	} else {
+		w.write(1, 1)
+	}
+	w.write(0, 3)
+
+	w.write(1, 1)
+	w.write(subtractGreen, 2)
+	w.write(0, 1)
+
+	// No color cache and a single group of prefix codes
+	w.write(0, 1)
+	w.write(0, 1)
+
+	greenCode := writePrefixCode(w, green)
+	redCode := writePrefixCode(w, red)
+	blueCode := writePrefixCode(w, blue)
+	alphaCode := writePrefixCode(w, alpha)
+	distanceCode := writePrefixCode(w, distance)
+
+	for _, r := range refs {
+		if r.length > 0 {
+			symbol, extraBits, extra := prefixCode(r.length)
+			greenCode.writeSymbol(w, numLiterals+symbol)
+			w.write(extra, extraBits)
+
+			symbol, extraBits, extra = prefixCode(leftDistance)
+			distanceCode.writeSymbol(w, symbol)
+			w.write(extra, extraBits)
+			continue
+		}
+
+		greenCode.writeSymbol(w, int(r.pixel>>8&0xff))
+		redCode.writeSymbol(w, int(r.pixel>>16&0xff))
+		blueCode.writeSymbol(w, int(r.pixel&0xff))
+		alphaCode.writeSymbol(w, int(r.pixel>>24))
+	}
+
+	data := w.bytes()
+
+	chunkSize := len(data)
+	padded := chunkSize + chunkSize&1
+
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(4+8+padded))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(chunkSize))
+
+	if _, err := out.Write(header); err != nil {
+		return err
+	}
+
+	if chunkSize&1 == 1 {
+		data = append(data, 0)
+	}
+
+	_, err := out.Write(data)
+
+	return err
+}
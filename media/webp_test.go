@@ -0,0 +1,71 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/bits"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+func TestEncodeWebP(t *testing.T) {
+	const width, height = 300, 230
+
+	tests := map[string]func(x, y int) color.NRGBA{
+		"gradient": func(x, y int) color.NRGBA {
+			return color.NRGBA{R: uint8(x * 7), G: uint8(y * 5), B: uint8(x * y), A: 0xff}
+		},
+		"flat": func(x, y int) color.NRGBA {
+			return color.NRGBA{R: 200, G: 100, B: 50, A: 0xff}
+		},
+		"stripes with alpha": func(x, y int) color.NRGBA {
+			if y%3 == 0 {
+				return color.NRGBA{R: 10, G: 20, B: 30, A: 0x80}
+			}
+			return color.NRGBA{R: uint8(x), G: 0, B: 0, A: 0xff}
+		},
+		// A skewed distribution needs codes longer than allowed
+		"skewed": func(x, y int) color.NRGBA {
+			return color.NRGBA{R: uint8(bits.TrailingZeros(uint(y*300+x+1)) * 9), G: 0, B: 0, A: 0xff}
+		},
+		"two colors": func(x, y int) color.NRGBA {
+			return color.NRGBA{R: uint8((x + y) % 2 * 255), G: 0, B: 0, A: 0xff}
+		},
+	}
+
+	for name, pixel := range tests {
+		t.Run(name, func(t *testing.T) {
+			img := image.NewNRGBA(image.Rect(0, 0, width, height))
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					img.SetNRGBA(x, y, pixel(x, y))
+				}
+			}
+
+			var buf bytes.Buffer
+			if err := EncodeWebP(&buf, img); err != nil {
+				t.Fatal(err)
+			}
+
+			decoded, err := webp.Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if decoded.Bounds() != img.Bounds() {
+				t.Fatalf("bounds = %v, want %v", decoded.Bounds(), img.Bounds())
+			}
+
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					got := color.NRGBAModel.Convert(decoded.At(x, y)).(color.NRGBA)
+					if want := pixel(x, y); got != want {
+						t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	AuditRecipeCreate       = "recipe.create"
+	AuditRecipeUpdate       = "recipe.update"
+	AuditRecipeDelete       = "recipe.delete"
+	AuditRecipeLabels       = "recipe.labels"
+	AuditRecipeImport       = "recipe.import"
+	AuditRecipePublish      = "recipe.publish"
+	AuditRecipeMerge        = "recipe.merge"
+	AuditSessionCreate      = "session.create"
+	AuditSessionRefresh     = "session.refresh"
+	AuditSessionReuse       = "session.reuse"
+	AuditSessionRevoke      = "session.revoke"
+	AuditAPIKeyCreate       = "apikey.create"
+	AuditAPIKeyRevoke       = "apikey.revoke"
+	AuditReviewCreate       = "review.create"
+	AuditReviewUpdate       = "review.update"
+	AuditReviewDelete       = "review.delete"
+	AuditCommentCreate      = "comment.create"
+	AuditCommentUpdate      = "comment.update"
+	AuditCommentDelete      = "comment.delete"
+	AuditCommentApprove     = "comment.approve"
+	AuditCommentReject      = "comment.reject"
+	AuditCommentFlag        = "comment.flag"
+	AuditFavoriteAdd        = "favorite.add"
+	AuditFavoriteRemove     = "favorite.remove"
+	AuditCookbookCreate     = "cookbook.create"
+	AuditCookbookUpdate     = "cookbook.update"
+	AuditCookbookDelete     = "cookbook.delete"
+	AuditSubstitutionCreate = "substitution.create"
+	AuditSubstitutionUpdate = "substitution.update"
+	AuditSubstitutionDelete = "substitution.delete"
+	AuditImageUpload        = "image.upload"
+	AuditImageDelete        = "image.delete"
+	AuditImageReorder       = "image.reorder"
+	AuditUserUpdate         = "user.update"
+	AuditMealPlanUpdate     = "mealplan.update"
+	AuditShoppingListCreate = "shoppinglist.create"
+	AuditShoppingListUpdate = "shoppinglist.update"
+	AuditShoppingListDelete = "shoppinglist.delete"
+	AuditPantryAdd          = "pantry.add"
+	AuditPantryRemove       = "pantry.remove"
+	AuditCookingUpdate      = "cooking.update"
+	AuditCookingDelete      = "cooking.delete"
+)
+
+type AuditEntry struct {
+	ID       primitive.ObjectID  `json:"id" bson:"_id"`
+	Actor    string              `json:"actor" bson:"actor"`
+	Action   string              `json:"action" bson:"action"`
+	RecipeID *primitive.ObjectID `json:"recipeId,omitempty" bson:"recipeId,omitempty"`
+	// Target identifies the subject of actions that are not about a recipe, e.g. a session or an API key
+	Target     string    `json:"target,omitempty" bson:"target,omitempty"`
+	BeforeHash string    `json:"beforeHash,omitempty" bson:"beforeHash,omitempty"`
+	AfterHash  string    `json:"afterHash,omitempty" bson:"afterHash,omitempty"`
+	IP         string    `json:"ip" bson:"ip"`
+	RequestID  string    `json:"requestId" bson:"requestId"`
+	Timestamp  time.Time `json:"timestamp" bson:"timestamp"`
+}
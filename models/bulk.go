@@ -0,0 +1,28 @@
+package models
+
+const (
+	BulkCreated   = "created"
+	BulkUpdated   = "updated"
+	BulkDuplicate = "duplicate"
+	BulkInvalid   = "invalid"
+	BulkFailed    = "failed"
+)
+
+// BulkResult is the outcome for one recipe of a bulk import, by its
+// position in the request.
+type BulkResult struct {
+	Index      int    `json:"index"`
+	Status     string `json:"status"`
+	ID         string `json:"id,omitempty"`
+	ExternalID string `json:"externalId,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type BulkReport struct {
+	Created   int          `json:"created"`
+	Updated   int          `json:"updated"`
+	Duplicate int          `json:"duplicate"`
+	Invalid   int          `json:"invalid"`
+	Failed    int          `json:"failed"`
+	Results   []BulkResult `json:"results"`
+}
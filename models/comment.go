@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	CommentVisible = "visible"
+	// CommentFlagged comments are hidden until a moderator reviews them
+	CommentFlagged = "flagged"
+	CommentRemoved = "removed"
+)
+
+type CommentFlag struct {
+	UserID    string    `json:"userId" bson:"userId"`
+	Reason    string    `json:"reason" bson:"reason"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// swagger:parameters comments newComment
+type Comment struct {
+	// swagger:ignore
+	ID primitive.ObjectID `json:"id" bson:"_id"`
+	// swagger:ignore
+	RecipeID primitive.ObjectID  `json:"recipeId" bson:"recipeId"`
+	ParentID *primitive.ObjectID `json:"parentId,omitempty" bson:"parentId,omitempty"`
+	// swagger:ignore
+	ThreadID primitive.ObjectID `json:"threadId" bson:"threadId"`
+	// swagger:ignore
+	AuthorID string `json:"authorId" bson:"authorId"`
+	Text     string `json:"text" bson:"text" binding:"required,max=5000"`
+	// swagger:ignore
+	Status string `json:"status" bson:"status"`
+	// swagger:ignore
+	Flags []CommentFlag `json:"flags,omitempty" bson:"flags,omitempty"`
+	// swagger:ignore
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	// swagger:ignore
+	EditedAt *time.Time `json:"editedAt,omitempty" bson:"editedAt,omitempty"`
+	// swagger:ignore
+	DeletedAt *time.Time `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	// swagger:ignore
+	Replies []Comment `json:"replies,omitempty" bson:"-"`
+}
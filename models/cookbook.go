@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	VisibilityPublic  = "public"
+	VisibilityPrivate = "private"
+)
+
+type CookbookEntry struct {
+	RecipeID primitive.ObjectID `json:"recipeId" bson:"recipeId" binding:"required"`
+	Note     string             `json:"note" bson:"note" binding:"max=1000"`
+	AddedAt  time.Time          `json:"addedAt" bson:"addedAt"`
+}
+
+// swagger:parameters cookbooks newCookbook
+type Cookbook struct {
+	// swagger:ignore
+	ID primitive.ObjectID `json:"id" bson:"_id"`
+	// swagger:ignore
+	OwnerID     string `json:"ownerId" bson:"ownerId"`
+	Name        string `json:"name" bson:"name" binding:"required,max=100"`
+	Description string `json:"description" bson:"description" binding:"max=1000"`
+	Visibility  string `json:"visibility" bson:"visibility" binding:"omitempty,oneof=public private"`
+	// Recipes are kept in the order chosen by the owner
+	// swagger:ignore
+	Recipes []CookbookEntry `json:"recipes" bson:"recipes"`
+	// swagger:ignore
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	// swagger:ignore
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
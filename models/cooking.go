@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// StepDetail is a single step of a recipe as shown in cooking mode.
+type StepDetail struct {
+	RecipeID   string `json:"recipeId"`
+	RecipeName string `json:"recipeName"`
+	Step       Step   `json:"step"`
+	TotalSteps int    `json:"totalSteps"`
+	// Ingredients are the ingredient lines the step refers to
+	Ingredients []string `json:"ingredients"`
+	// Previous and Next link to the neighbouring steps, if any
+	Previous *string `json:"previous"`
+	Next     *string `json:"next"`
+}
+
+// CookingTimer counts down in a cooking session. A paused timer keeps its
+// remaining time instead of an end time.
+type CookingTimer struct {
+	ID    string `json:"id"`
+	Step  int    `json:"step"`
+	Label string `json:"label"`
+	// Duration is in seconds
+	Duration  int        `json:"duration"`
+	StartedAt time.Time  `json:"startedAt"`
+	EndsAt    *time.Time `json:"endsAt,omitempty"`
+	Paused    bool       `json:"paused"`
+	// Remaining is in seconds
+	Remaining int  `json:"remaining"`
+	Done      bool `json:"done"`
+}
+
+// CookingSession tracks the progress of a user through a recipe, shared
+// by all of their devices.
+type CookingSession struct {
+	RecipeID    string         `json:"recipeId"`
+	RecipeName  string         `json:"recipeName"`
+	CurrentStep int            `json:"currentStep"`
+	TotalSteps  int            `json:"totalSteps"`
+	Timers      []CookingTimer `json:"timers"`
+	StartedAt   time.Time      `json:"startedAt"`
+	UpdatedAt   time.Time      `json:"updatedAt"`
+}
+
+type CookingStepRequest struct {
+	Step int `json:"step" binding:"required,gt=0"`
+}
+
+type CookingTimerRequest struct {
+	Step  int    `json:"step" binding:"required,gt=0"`
+	Label string `json:"label"`
+	// Duration is in seconds, defaulting to the longest duration the step
+	// mentions
+	Duration int `json:"duration" binding:"gte=0,lte=86400"`
+}
+
+type CookingTimerUpdate struct {
+	Paused bool `json:"paused"`
+}
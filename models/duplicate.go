@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DuplicateMatch is an existing recipe that a recipe likely duplicates.
+type DuplicateMatch struct {
+	RecipeID   primitive.ObjectID `json:"recipeId"`
+	Name       string             `json:"name"`
+	Similarity float64            `json:"similarity"`
+}
+
+type DuplicateRecipe struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id"`
+	Name          string             `json:"name" bson:"name"`
+	AuthorID      string             `json:"authorId,omitempty" bson:"authorId,omitempty"`
+	PublishedAt   time.Time          `json:"publishedAt" bson:"publishedAt"`
+	Draft         bool               `json:"draft" bson:"draft,omitempty"`
+	RatingCount   int                `json:"ratingCount" bson:"ratingCount"`
+	FavoriteCount int                `json:"favoriteCount" bson:"favoriteCount"`
+	CommentCount  int                `json:"commentCount" bson:"commentCount"`
+}
+
+// DuplicateCluster is a group of recipes that are likely duplicates of
+// each other.
+type DuplicateCluster struct {
+	// Similarity is the lowest similarity among the pairs of recipes found
+	// to be alike
+	Similarity float64           `json:"similarity"`
+	Recipes    []DuplicateRecipe `json:"recipes"`
+}
+
+// RecipeMerge lists the duplicates to merge into a recipe.
+type RecipeMerge struct {
+	DuplicateIDs []primitive.ObjectID `json:"duplicateIds" binding:"required,min=1,max=50"`
+}
+
+// MergeReport tells what has been moved to the recipe kept.
+type MergeReport struct {
+	Recipe        Recipe `json:"recipe"`
+	Merged        int    `json:"merged"`
+	Reviews       int    `json:"reviews"`
+	Comments      int    `json:"comments"`
+	Favorites     int    `json:"favorites"`
+	Cookbooks     int    `json:"cookbooks"`
+	MealPlans     int    `json:"mealPlans"`
+	ShoppingLists int    `json:"shoppingLists"`
+	Images        int    `json:"images"`
+}
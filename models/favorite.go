@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Favorite struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	UserID    string             `json:"userId" bson:"userId"`
+	RecipeID  primitive.ObjectID `json:"recipeId" bson:"recipeId"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ImageVariant is one size and encoding of an uploaded image.
+type ImageVariant struct {
+	// Name is original, thumbnail or medium
+	Name        string `json:"name" bson:"name"`
+	ContentType string `json:"contentType" bson:"contentType"`
+	Width       int    `json:"width" bson:"width"`
+	Height      int    `json:"height" bson:"height"`
+	Size        int    `json:"size" bson:"size"`
+	// swagger:ignore
+	Key string `json:"-" bson:"key"`
+	URL string `json:"url" bson:"url"`
+}
+
+type RecipeImage struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id"`
+	Cover      bool               `json:"cover" bson:"cover"`
+	Variants   []ImageVariant     `json:"variants" bson:"variants"`
+	UploadedBy string             `json:"uploadedBy" bson:"uploadedBy"`
+	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// ImageOrder rearranges the images of a recipe.
+type ImageOrder struct {
+	// ImageIDs lists every image of the recipe in the new order
+	ImageIDs []primitive.ObjectID `json:"imageIds" binding:"required"`
+	// CoverID defaults to the first image
+	CoverID *primitive.ObjectID `json:"coverId"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	MealBreakfast = "breakfast"
+	MealLunch     = "lunch"
+	MealDinner    = "dinner"
+	MealSnack     = "snack"
+)
+
+type MealSlot struct {
+	// Day is the day of the week, from monday to sunday
+	Day string `json:"day" bson:"day"`
+	// Date is the calendar date of Day in the plan's week
+	Date     string             `json:"date" bson:"date"`
+	Meal     string             `json:"meal" bson:"meal"`
+	RecipeID primitive.ObjectID `json:"recipeId" bson:"recipeId"`
+	Servings int                `json:"servings" bson:"servings"`
+}
+
+type MealPlan struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id"`
+	UserID string             `json:"userId" bson:"userId"`
+	// Week is an ISO 8601 week, e.g. 2023-W18
+	Week      string     `json:"week" bson:"week"`
+	Slots     []MealSlot `json:"slots" bson:"slots"`
+	CreatedAt time.Time  `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt" bson:"updatedAt"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// swagger:parameters pantry addPantryItem
+type PantryItem struct {
+	// swagger:ignore
+	ID primitive.ObjectID `json:"id" bson:"_id"`
+	// swagger:ignore
+	UserID string `json:"userId" bson:"userId"`
+	// Label is the name as entered by the user
+	Label string `json:"label" bson:"label" binding:"required,max=100"`
+	// Name is the normalized name used to match recipe ingredients
+	// swagger:ignore
+	Name     string  `json:"name" bson:"name"`
+	Quantity float64 `json:"quantity,omitempty" bson:"quantity,omitempty" binding:"min=0"`
+	Unit     string  `json:"unit,omitempty" bson:"unit,omitempty" binding:"max=20"`
+	// swagger:ignore
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	// swagger:ignore
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
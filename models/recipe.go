@@ -14,5 +14,79 @@ type Recipe struct {
 	Tags         []string           `json:"tags" bson:"tags"`
 	Ingredients  []string           `json:"ingredients" bson:"ingredients"`
 	Instructions []string           `json:"instructions" bson:"instructions"`
-	PublishedAt  time.Time          `json:"publishedAt" bson:"publishedAt"`
+	// Servings is how many people the ingredients are for
+	Servings    int       `json:"servings,omitempty" bson:"servings,omitempty"`
+	PublishedAt time.Time `json:"publishedAt" bson:"publishedAt"`
+	// swagger:ignore
+	AuthorID string `json:"authorId,omitempty" bson:"authorId,omitempty"`
+	// Steps are parsed from Instructions
+	// swagger:ignore
+	Steps []Step `json:"steps" bson:"steps"`
+	// PrepTime, CookTime and TotalTime are in minutes, derived from the timers of the steps
+	// swagger:ignore
+	PrepTime int `json:"prepTime" bson:"prepTime"`
+	// swagger:ignore
+	CookTime int `json:"cookTime" bson:"cookTime"`
+	// swagger:ignore
+	TotalTime int `json:"totalTime" bson:"totalTime"`
+	// swagger:ignore
+	RatingAverage float64 `json:"ratingAverage" bson:"ratingAverage"`
+	// swagger:ignore
+	RatingCount int `json:"ratingCount" bson:"ratingCount"`
+	// swagger:ignore
+	RatingSum int `json:"-" bson:"ratingSum"`
+	// swagger:ignore
+	CommentCount int `json:"commentCount" bson:"commentCount"`
+	// swagger:ignore
+	FavoriteCount int `json:"favoriteCount" bson:"favoriteCount"`
+	// Diets the recipe complies with, derived from the ingredients unless
+	// overridden by the author
+	// swagger:ignore
+	Diets []string `json:"diets" bson:"diets"`
+	// Allergens the recipe contains, derived like Diets
+	// swagger:ignore
+	Allergens []string `json:"allergens" bson:"allergens"`
+	// swagger:ignore
+	LabelOverrides *LabelOverrides `json:"labelOverrides,omitempty" bson:"labelOverrides,omitempty"`
+	// Images in display order, exactly one of which is the cover
+	// swagger:ignore
+	Images []RecipeImage `json:"images" bson:"images"`
+	// Source attributes a recipe imported from elsewhere
+	Source *RecipeSource `json:"source,omitempty" bson:"source,omitempty"`
+	// ExternalID identifies the recipe in the system it was imported from
+	// and is unique per author, so that bulk imports can be repeated
+	ExternalID string `json:"externalId,omitempty" bson:"externalId,omitempty"`
+	// Drafts are only listed to their author until they are published
+	// swagger:ignore
+	Draft bool `json:"draft" bson:"draft,omitempty"`
+	// Fingerprint holds the MinHash band keys of the name and ingredients,
+	// by which likely duplicates are looked up
+	// swagger:ignore
+	Fingerprint []string `json:"-" bson:"fingerprint,omitempty"`
+	// PossibleDuplicates are reported when creating a recipe
+	// swagger:ignore
+	PossibleDuplicates []DuplicateMatch `json:"possibleDuplicates,omitempty" bson:"-"`
+}
+
+type RecipeSource struct {
+	URL      string `json:"url,omitempty" bson:"url,omitempty"`
+	SiteName string `json:"siteName,omitempty" bson:"siteName,omitempty"`
+	// Method is how the recipe was extracted, e.g. json-ld, microdata or
+	// heuristic for web pages
+	Method     string    `json:"method,omitempty" bson:"method,omitempty"`
+	ImportedAt time.Time `json:"importedAt" bson:"importedAt"`
+}
+
+// LabelOverrides correct derived labels. A label mapped to true is always
+// set, one mapped to false never is.
+type LabelOverrides struct {
+	Diets     map[string]bool `json:"diets,omitempty" bson:"diets,omitempty"`
+	Allergens map[string]bool `json:"allergens,omitempty" bson:"allergens,omitempty"`
+}
+
+// RecipeImport is a web page to import a recipe from, by URL or by its
+// HTML. The URL of pasted HTML is only used for attribution.
+type RecipeImport struct {
+	URL  string `json:"url"`
+	HTML string `json:"html"`
 }
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// swagger:parameters reviews newReview
+type Review struct {
+	// swagger:ignore
+	ID primitive.ObjectID `json:"id" bson:"_id"`
+	// swagger:ignore
+	RecipeID primitive.ObjectID `json:"recipeId" bson:"recipeId"`
+	// swagger:ignore
+	AuthorID  string    `json:"authorId" bson:"authorId"`
+	Rating    int       `json:"rating" bson:"rating" binding:"required,min=1,max=5"`
+	Text      string    `json:"text" bson:"text" binding:"max=5000"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+type Session struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"userId"`
+	UserAgent   string    `json:"userAgent"`
+	IP          string    `json:"ip"`
+	CreatedAt   time.Time `json:"createdAt"`
+	RefreshedAt time.Time `json:"refreshedAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+type SessionTokens struct {
+	AccessToken  string  `json:"accessToken"`
+	RefreshToken string  `json:"refreshToken"`
+	ExpiresIn    int     `json:"expiresIn"`
+	Session      Session `json:"session"`
+}
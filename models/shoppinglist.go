@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ShoppingListItem struct {
+	ID       primitive.ObjectID `json:"id" bson:"_id"`
+	Name     string             `json:"name" bson:"name"`
+	Quantity float64            `json:"quantity,omitempty" bson:"quantity,omitempty"`
+	Unit     string             `json:"unit,omitempty" bson:"unit,omitempty"`
+	Checked  bool               `json:"checked" bson:"checked"`
+	// RecipeIDs are the recipes that call for the item
+	RecipeIDs []primitive.ObjectID `json:"recipeIds" bson:"recipeIds"`
+}
+
+type ShoppingListAisle struct {
+	Name  string             `json:"name" bson:"name"`
+	Items []ShoppingListItem `json:"items" bson:"items"`
+}
+
+type ShoppingListRecipe struct {
+	RecipeID primitive.ObjectID `json:"recipeId" bson:"recipeId"`
+	Servings int                `json:"servings" bson:"servings"`
+}
+
+type ShoppingList struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id"`
+	UserID string             `json:"userId" bson:"userId"`
+	Name   string             `json:"name" bson:"name"`
+	// Week is set when the list has been generated from a meal plan
+	Week      string               `json:"week,omitempty" bson:"week,omitempty"`
+	Recipes   []ShoppingListRecipe `json:"recipes" bson:"recipes"`
+	Aisles    []ShoppingListAisle  `json:"aisles" bson:"aisles"`
+	CreatedAt time.Time            `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time            `json:"updatedAt" bson:"updatedAt"`
+}
@@ -0,0 +1,7 @@
+package models
+
+// SimilarRecipe is a recipe with how similar it is to another, from 0 to 1.
+type SimilarRecipe struct {
+	Recipe
+	Score float64 `json:"score"`
+}
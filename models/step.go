@@ -0,0 +1,26 @@
+package models
+
+// Timer is a duration in seconds. Min and Max differ for ranges such as
+// "4 to 5 minutes".
+type Timer struct {
+	Min int `json:"min" bson:"min"`
+	Max int `json:"max" bson:"max"`
+	// Text is the phrase the timer was detected in
+	Text string `json:"text" bson:"text"`
+}
+
+type Temperature struct {
+	Value int `json:"value" bson:"value"`
+	// Unit is C or F
+	Unit string `json:"unit" bson:"unit"`
+}
+
+type Step struct {
+	Number      int          `json:"number" bson:"number"`
+	Text        string       `json:"text" bson:"text"`
+	Timer       *Timer       `json:"timer,omitempty" bson:"timer,omitempty"`
+	Temperature *Temperature `json:"temperature,omitempty" bson:"temperature,omitempty"`
+	Equipment   []string     `json:"equipment" bson:"equipment"`
+	// Ingredients are indexes into the ingredients of the recipe
+	Ingredients []int `json:"ingredients" bson:"ingredients"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// swagger:parameters substitutions newSubstitution
+type Substitution struct {
+	// swagger:ignore
+	ID primitive.ObjectID `json:"id" bson:"_id"`
+	// Ingredient is the normalized name of the ingredient being replaced
+	Ingredient string `json:"ingredient" bson:"ingredient" binding:"required,max=100"`
+	Substitute string `json:"substitute" bson:"substitute" binding:"required,max=200"`
+	// Ratio is the amount of substitute to use per unit of the ingredient
+	Ratio float64 `json:"ratio" bson:"ratio" binding:"required,gt=0"`
+	Note  string  `json:"note,omitempty" bson:"note,omitempty" binding:"max=1000"`
+	// Diets are the diets the substitute complies with, e.g. vegan. The
+	// handlers check them against ingredients.Diets
+	Diets []string `json:"diets" bson:"diets"`
+	// swagger:ignore
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	// swagger:ignore
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
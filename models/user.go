@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+const (
+	UnitsMetric   = "metric"
+	UnitsImperial = "imperial"
+
+	RoleModerator = "moderator"
+)
+
+// swagger:parameters users updateProfile
+type User struct {
+	// swagger:ignore
+	ID                 string   `json:"id" bson:"_id"`
+	DisplayName        string   `json:"displayName" bson:"displayName"`
+	AvatarURL          string   `json:"avatarUrl" bson:"avatarUrl"`
+	Bio                string   `json:"bio" bson:"bio"`
+	DietaryPreferences []string `json:"dietaryPreferences" bson:"dietaryPreferences"`
+	PreferredUnits     string   `json:"preferredUnits" bson:"preferredUnits"`
+	// swagger:ignore
+	Roles     []string  `json:"roles,omitempty" bson:"roles,omitempty"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
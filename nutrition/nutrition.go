@@ -0,0 +1,174 @@
+// Package nutrition estimates the nutrients of recipes from their ingredient
+// lines, using a bundled table of USDA-derived values per 100 g.
+package nutrition
+
+import (
+	_ "embed"
+	"encoding/json"
+	"strings"
+
+	"github.com/harmlessevil/recipes-api/ingredients"
+)
+
+//go:embed nutrients.json
+var nutrientsJSON []byte
+
+// Nutrients holds energy in kcal, macronutrients in grams and sodium,
+// calcium, iron, potassium and vitamin C in milligrams.
+type Nutrients struct {
+	Calories      float64 `json:"calories"`
+	Protein       float64 `json:"protein"`
+	Fat           float64 `json:"fat"`
+	SaturatedFat  float64 `json:"saturatedFat"`
+	Carbohydrates float64 `json:"carbohydrates"`
+	Fiber         float64 `json:"fiber"`
+	Sugar         float64 `json:"sugar"`
+	Sodium        float64 `json:"sodium"`
+	Calcium       float64 `json:"calcium"`
+	Iron          float64 `json:"iron"`
+	Potassium     float64 `json:"potassium"`
+	VitaminC      float64 `json:"vitaminC"`
+}
+
+// add adds other scaled by factor.
+func (n *Nutrients) add(other Nutrients, factor float64) {
+	n.Calories += other.Calories * factor
+	n.Protein += other.Protein * factor
+	n.Fat += other.Fat * factor
+	n.SaturatedFat += other.SaturatedFat * factor
+	n.Carbohydrates += other.Carbohydrates * factor
+	n.Fiber += other.Fiber * factor
+	n.Sugar += other.Sugar * factor
+	n.Sodium += other.Sodium * factor
+	n.Calcium += other.Calcium * factor
+	n.Iron += other.Iron * factor
+	n.Potassium += other.Potassium * factor
+	n.VitaminC += other.VitaminC * factor
+}
+
+func (n Nutrients) rounded() Nutrients {
+	return Nutrients{
+		Calories:      ingredients.Round(n.Calories),
+		Protein:       ingredients.Round(n.Protein),
+		Fat:           ingredients.Round(n.Fat),
+		SaturatedFat:  ingredients.Round(n.SaturatedFat),
+		Carbohydrates: ingredients.Round(n.Carbohydrates),
+		Fiber:         ingredients.Round(n.Fiber),
+		Sugar:         ingredients.Round(n.Sugar),
+		Sodium:        ingredients.Round(n.Sodium),
+		Calcium:       ingredients.Round(n.Calcium),
+		Iron:          ingredients.Round(n.Iron),
+		Potassium:     ingredients.Round(n.Potassium),
+		VitaminC:      ingredients.Round(n.VitaminC),
+	}
+}
+
+type food struct {
+	Name    string    `json:"name"`
+	Aliases []string  `json:"aliases"`
+	Per100g Nutrients `json:"per100g"`
+	// GramsPerMl converts volumes to weights
+	GramsPerMl float64 `json:"gramsPerMl"`
+	// GramsPerUnit converts counts to weights. The empty unit is the weight
+	// of one piece, e.g. one egg.
+	GramsPerUnit map[string]float64 `json:"gramsPerUnit"`
+}
+
+var foods = loadFoods()
+
+func loadFoods() map[string]*food {
+	var list []*food
+	if err := json.Unmarshal(nutrientsJSON, &list); err != nil {
+		panic(err)
+	}
+
+	foods := make(map[string]*food, len(list))
+	for _, f := range list {
+		foods[ingredients.Normalize(f.Name)] = f
+		for _, alias := range f.Aliases {
+			foods[ingredients.Normalize(alias)] = f
+		}
+	}
+
+	return foods
+}
+
+// lookup finds a food by name, falling back to less specific names, so that
+// "green bell pepper" is found as "bell pepper".
+func lookup(name string) (*food, bool) {
+	for {
+		if f, ok := foods[name]; ok {
+			return f, true
+		}
+
+		i := strings.IndexByte(name, ' ')
+		if i < 0 {
+			return nil, false
+		}
+		name = name[i+1:]
+	}
+}
+
+// grams returns the weight of an ingredient amount.
+func (f *food) grams(ingredient ingredients.Ingredient) (float64, bool) {
+	quantity, unit, dimension := ingredients.ToBase(ingredient.Quantity, ingredient.Unit)
+
+	switch dimension {
+	case ingredients.Mass:
+		return quantity, true
+	case ingredients.Volume:
+		return quantity * f.GramsPerMl, true
+	default:
+		grams, ok := f.GramsPerUnit[unit]
+		return quantity * grams, ok
+	}
+}
+
+type Estimate struct {
+	Servings   int       `json:"servings"`
+	Total      Nutrients `json:"total"`
+	PerServing Nutrients `json:"perServing"`
+	// Unmatched lists ingredient lines that could not be accounted for,
+	// either because the ingredient is unknown or because its amount is
+	// missing or cannot be converted to a weight.
+	Unmatched []string `json:"unmatched"`
+}
+
+// Calculate estimates the nutrients of a recipe from its ingredient lines.
+func Calculate(lines []string, servings int) Estimate {
+	if servings <= 0 {
+		servings = 1
+	}
+
+	estimate := Estimate{Servings: servings, Unmatched: []string{}}
+
+	var total Nutrients
+	for _, ingredient := range ingredients.ParseAll(lines) {
+		f, ok := lookup(ingredient.Name)
+		if !ok {
+			estimate.Unmatched = append(estimate.Unmatched, ingredient.Raw)
+			continue
+		}
+
+		grams, ok := f.grams(ingredient)
+		if !ok || grams == 0 {
+			// Salt to taste and the like add too little to matter
+			if ingredient.Quantity == 0 && ingredient.Unit == "" {
+				continue
+			}
+
+			estimate.Unmatched = append(estimate.Unmatched, ingredient.Raw)
+			continue
+		}
+
+		total.add(f.Per100g, grams/100)
+	}
+
+	var perServing Nutrients
+	perServing.add(total, 1/float64(servings))
+
+	estimate.Total = total.rounded()
+	estimate.PerServing = perServing.rounded()
+
+	return estimate
+}
@@ -0,0 +1,51 @@
+package nutrition
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCalculate(t *testing.T) {
+	estimate := Calculate([]string{
+		"200g all-purpose flour",
+		"2 large eggs",
+		"1 cup whole milk",
+		"Salt to taste",
+		"1 handful of unobtainium",
+	}, 2)
+
+	// 728 kcal of flour, 143 of eggs and 144 of milk
+	if math.Abs(estimate.Total.Calories-1015) > 5 {
+		t.Errorf("total calories = %v, want about 1015", estimate.Total.Calories)
+	}
+
+	if math.Abs(estimate.PerServing.Calories-estimate.Total.Calories/2) > 0.01 {
+		t.Errorf("calories per serving = %v, want half of %v", estimate.PerServing.Calories, estimate.Total.Calories)
+	}
+
+	if len(estimate.Unmatched) != 1 || estimate.Unmatched[0] != "1 handful of unobtainium" {
+		t.Errorf("unmatched = %q, want the unknown ingredient only", estimate.Unmatched)
+	}
+}
+
+func TestLookupFallsBackToLessSpecificNames(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"green bell pepper", "bell pepper"},
+		{"unsalted butter", "butter"},
+		// Plant-based foods are not their dairy namesakes
+		{"almond milk", "almond milk"},
+		{"chocolate almond milk", "almond milk"},
+		{"oat milk", "oat milk"},
+		{"soy milk", "soy milk"},
+		{"almond butter", "almond butter"},
+	}
+
+	for _, test := range tests {
+		if f, ok := lookup(test.name); !ok || f.Name != test.want {
+			t.Errorf("lookup(%s) = %v, %v, want %s", test.name, f, ok, test.want)
+		}
+	}
+}
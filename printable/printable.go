@@ -0,0 +1,502 @@
+// Package printable lays out recipes for printing as PDF, either as a card
+// for a single recipe or as a cookbook of several.
+package printable
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	_ "golang.org/x/image/webp"
+
+	"github.com/harmlessevil/recipes-api/models"
+	"github.com/harmlessevil/recipes-api/nutrition"
+)
+
+var ErrUnknownPaper = errors.New("printable: unknown paper size")
+
+// Papers maps the supported paper sizes to their names in fpdf.
+var Papers = map[string]string{
+	"a4":     "A4",
+	"letter": "Letter",
+}
+
+// Card is a recipe with what is printed alongside it.
+type Card struct {
+	Recipe models.Recipe
+	// Image is the cover of the recipe as JPEG, PNG or WebP, if any
+	Image []byte
+	// Nutrition is shown per serving, if set
+	Nutrition *nutrition.Estimate
+	// Note is the remark of a cookbook owner on the recipe
+	Note string
+}
+
+type Cookbook struct {
+	Title       string
+	Description string
+	Cards       []Card
+}
+
+// Sizes are in millimetres and points for fonts.
+const (
+	margin          = 18
+	lineHeight      = 5
+	maxImageHeight  = 80
+	columnGap       = 8
+	bulletWidth     = 4
+	stepNumberWidth = 8
+	nutritionHeight = 30
+	// minColumnItems is how many ingredients it takes to use two columns
+	minColumnItems = 6
+)
+
+var (
+	textColor  = [3]int{33, 33, 33}
+	mutedColor = [3]int{110, 110, 110}
+	boxColor   = [3]int{243, 240, 234}
+)
+
+// compress is turned off in tests to inspect the output.
+var compress = true
+
+// outsideCodePage spells out characters missing from the code page of the
+// core fonts, which would be printed as dots.
+var outsideCodePage = strings.NewReplacer(
+	"⅓", "1/3", "⅔", "2/3", "⅛", "1/8", "⅜", "3/8", "⅝", "5/8", "⅞", "7/8",
+	"⅕", "1/5", "⅖", "2/5", "⅗", "3/5", "⅘", "4/5", "⅙", "1/6", "⅚", "5/6",
+	"→", "->", "≈", "~",
+)
+
+type document struct {
+	pdf       *fpdf.Fpdf
+	translate func(string) string
+	width     float64
+	images    int
+	// book is the title of the cookbook printed, if any
+	book string
+	// footer is printed at the bottom of the page, with its number
+	footer string
+}
+
+func newDocument(paper string, title string) (*document, error) {
+	size, ok := Papers[paper]
+	if !ok {
+		return nil, ErrUnknownPaper
+	}
+
+	pdf := fpdf.New("P", "mm", size, "")
+	pdf.SetMargins(margin, margin, margin)
+	pdf.SetAutoPageBreak(true, margin)
+	pdf.SetCompression(compress)
+	pdf.SetTitle(title, true)
+	pdf.SetCreator("Recipes API", true)
+	pdf.AliasNbPages("")
+
+	pageWidth, _ := pdf.GetPageSize()
+	d := &document{
+		pdf:       pdf,
+		translate: pdf.UnicodeTranslatorFromDescriptor(""),
+		width:     pageWidth - 2*margin,
+	}
+
+	pdf.SetFooterFunc(func() {
+		if d.footer == "" {
+			return
+		}
+
+		pdf.SetY(-margin + 6)
+		d.font("", 8, mutedColor)
+		footer := fmt.Sprintf("%s  ·  page %d of {nb}", d.footer, pdf.PageNo())
+		pdf.CellFormat(0, 4, d.text(footer), "", 0, "C", false, 0, "")
+	})
+
+	return d, nil
+}
+
+func (d *document) text(s string) string {
+	return d.translate(outsideCodePage.Replace(s))
+}
+
+func (d *document) font(style string, size float64, color [3]int) {
+	d.pdf.SetFont("Helvetica", style, size)
+	d.pdf.SetTextColor(color[0], color[1], color[2])
+}
+
+// ensureSpace starts a new page unless height fits on the current one.
+func (d *document) ensureSpace(height float64) {
+	_, pageHeight := d.pdf.GetPageSize()
+	if d.pdf.GetY()+height > pageHeight-margin {
+		d.pdf.AddPage()
+	}
+}
+
+func (d *document) heading(s string) {
+	d.ensureSpace(8 + 2*lineHeight)
+	d.pdf.Ln(4)
+	d.font("B", 13, textColor)
+	d.pdf.CellFormat(0, 8, d.text(s), "", 1, "L", false, 0, "")
+	d.pdf.Ln(1)
+}
+
+// toJPEG re-encodes an image as a baseline JPEG on white, which fpdf
+// embeds whatever the original encoding.
+func toJPEG(data []byte) ([]byte, image.Rectangle, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, image.Rectangle{}, err
+	}
+
+	bounds := src.Bounds()
+	dst := image.NewRGBA(bounds)
+	draw.Draw(dst, bounds, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, bounds, src, bounds.Min, draw.Over)
+
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, dst, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, image.Rectangle{}, err
+	}
+
+	return b.Bytes(), bounds, nil
+}
+
+// image prints an image across the page, no higher than maxImageHeight.
+// Images that cannot be decoded are left out.
+func (d *document) image(data []byte) {
+	jpg, bounds, err := toJPEG(data)
+	if err != nil || bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return
+	}
+
+	width := d.width
+	height := width * float64(bounds.Dy()) / float64(bounds.Dx())
+	if height > maxImageHeight {
+		width, height = width*maxImageHeight/height, maxImageHeight
+	}
+
+	d.images++
+	name := "image" + strconv.Itoa(d.images)
+	d.pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: "JPG"}, bytes.NewReader(jpg))
+
+	d.ensureSpace(height)
+	x := margin + (d.width-width)/2
+	d.pdf.ImageOptions(name, x, d.pdf.GetY(), width, height, false, fpdf.ImageOptions{ImageType: "JPG"}, 0, "")
+	d.pdf.SetY(d.pdf.GetY() + height + 4)
+}
+
+func details(recipe *models.Recipe) string {
+	var parts []string
+	if recipe.Servings > 0 {
+		parts = append(parts, fmt.Sprintf("Serves %d", recipe.Servings))
+	}
+	if recipe.PrepTime > 0 {
+		parts = append(parts, fmt.Sprintf("Prep %d min", recipe.PrepTime))
+	}
+	if recipe.CookTime > 0 {
+		parts = append(parts, fmt.Sprintf("Cook %d min", recipe.CookTime))
+	}
+	if recipe.TotalTime > 0 {
+		parts = append(parts, fmt.Sprintf("Total %d min", recipe.TotalTime))
+	}
+
+	tags := make([]string, len(recipe.Tags))
+	for i, tag := range recipe.Tags {
+		tags[i] = strings.ReplaceAll(tag, "_", " ")
+	}
+	if len(tags) > 0 {
+		parts = append(parts, strings.Join(tags, ", "))
+	}
+
+	return strings.Join(parts, "  ·  ")
+}
+
+func source(recipe *models.Recipe) string {
+	if recipe.Source == nil {
+		return ""
+	}
+
+	switch {
+	case recipe.Source.SiteName != "" && recipe.Source.URL != "":
+		return "From " + recipe.Source.SiteName + ", " + recipe.Source.URL
+	case recipe.Source.URL != "":
+		return "From " + recipe.Source.URL
+	case recipe.Source.SiteName != "":
+		return "From " + recipe.Source.SiteName
+	}
+
+	return ""
+}
+
+// itemsHeight is the height of a column of bulleted items.
+func (d *document) itemsHeight(items []string, width float64) float64 {
+	lines := 0
+	for _, item := range items {
+		lines += len(d.pdf.SplitLines([]byte(d.text(item)), width-bulletWidth))
+	}
+
+	return float64(lines)*lineHeight + float64(len(items))
+}
+
+func (d *document) items(items []string, x float64, width float64) {
+	for _, item := range items {
+		d.pdf.SetX(x)
+		d.pdf.CellFormat(bulletWidth, lineHeight, d.text("•"), "", 0, "L", false, 0, "")
+		d.pdf.SetLeftMargin(x + bulletWidth)
+		d.pdf.MultiCell(width-bulletWidth, lineHeight, d.text(item), "", "L", false)
+		d.pdf.SetLeftMargin(margin)
+		d.pdf.Ln(1)
+	}
+}
+
+// ingredients lists the ingredients, in two columns if there are enough of
+// them and both fit on the page.
+func (d *document) ingredients(lines []string) {
+	var items []string
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			items = append(items, line)
+		}
+	}
+	if len(items) == 0 {
+		return
+	}
+
+	d.heading("Ingredients")
+	d.font("", 10.5, textColor)
+
+	columnWidth := (d.width - columnGap) / 2
+	left, right := items[:(len(items)+1)/2], items[(len(items)+1)/2:]
+	height := math.Max(d.itemsHeight(left, columnWidth), d.itemsHeight(right, columnWidth))
+
+	_, pageHeight := d.pdf.GetPageSize()
+	if len(items) < minColumnItems || d.pdf.GetY()+height > pageHeight-margin {
+		d.items(items, margin, d.width)
+		return
+	}
+
+	top := d.pdf.GetY()
+	d.items(left, margin, columnWidth)
+	bottom := d.pdf.GetY()
+
+	d.pdf.SetY(top)
+	d.items(right, margin+columnWidth+columnGap, columnWidth)
+	d.pdf.SetY(math.Max(bottom, d.pdf.GetY()))
+}
+
+func (d *document) steps(recipe *models.Recipe) {
+	var texts []string
+	if len(recipe.Steps) > 0 {
+		for _, step := range recipe.Steps {
+			texts = append(texts, step.Text)
+		}
+	} else {
+		for _, instruction := range recipe.Instructions {
+			if instruction = strings.Join(strings.Fields(instruction), " "); instruction != "" {
+				texts = append(texts, instruction)
+			}
+		}
+	}
+	if len(texts) == 0 {
+		return
+	}
+
+	d.heading("Method")
+
+	for i, text := range texts {
+		// Keep a number from being left alone at the bottom of a page
+		d.ensureSpace(2 * lineHeight)
+
+		d.font("B", 10.5, textColor)
+		d.pdf.CellFormat(stepNumberWidth, lineHeight, strconv.Itoa(i+1)+".", "", 0, "L", false, 0, "")
+
+		d.font("", 10.5, textColor)
+		d.pdf.SetLeftMargin(margin + stepNumberWidth)
+		d.pdf.MultiCell(d.width-stepNumberWidth, lineHeight, d.text(text), "", "L", false)
+		d.pdf.SetLeftMargin(margin)
+		d.pdf.Ln(2)
+	}
+}
+
+// nutrition prints the estimate per serving in a box.
+func (d *document) nutrition(estimate *nutrition.Estimate) {
+	d.pdf.Ln(4)
+	d.ensureSpace(nutritionHeight)
+
+	top := d.pdf.GetY()
+	d.pdf.SetFillColor(boxColor[0], boxColor[1], boxColor[2])
+	d.pdf.RoundedRect(margin, top, d.width, nutritionHeight, 2, "1234", "F")
+
+	d.pdf.SetXY(margin+4, top+3)
+	d.font("B", 10, textColor)
+	title := "Nutrition per serving"
+	if estimate.Servings > 1 {
+		title += fmt.Sprintf(" (serves %d)", estimate.Servings)
+	}
+	d.pdf.CellFormat(0, 5, d.text(title), "", 1, "L", false, 0, "")
+
+	n := estimate.PerServing
+	values := []struct{ label, value string }{
+		{"Calories", fmt.Sprintf("%.0f kcal", n.Calories)},
+		{"Protein", fmt.Sprintf("%.1f g", n.Protein)},
+		{"Carbohydrates", fmt.Sprintf("%.1f g", n.Carbohydrates)},
+		{"Fat", fmt.Sprintf("%.1f g", n.Fat)},
+		{"Saturated fat", fmt.Sprintf("%.1f g", n.SaturatedFat)},
+		{"Fiber", fmt.Sprintf("%.1f g", n.Fiber)},
+		{"Sugar", fmt.Sprintf("%.1f g", n.Sugar)},
+		{"Sodium", fmt.Sprintf("%.0f mg", n.Sodium)},
+	}
+
+	const columns = 4
+	cellWidth := (d.width - 8) / columns
+	for i, v := range values {
+		x := margin + 4 + float64(i%columns)*cellWidth
+		y := top + 10 + float64(i/columns)*9
+
+		d.pdf.SetXY(x, y)
+		d.font("B", 10, textColor)
+		d.pdf.CellFormat(cellWidth, 4.5, d.text(v.value), "", 2, "L", false, 0, "")
+		d.font("", 8, mutedColor)
+		d.pdf.CellFormat(cellWidth, 3.5, d.text(v.label), "", 0, "L", false, 0, "")
+	}
+
+	d.pdf.SetXY(margin, top+nutritionHeight)
+
+	if len(estimate.Unmatched) > 0 {
+		d.pdf.Ln(1)
+		d.font("I", 7.5, mutedColor)
+		d.pdf.MultiCell(0, 3.5, d.text("Estimated without: "+strings.Join(estimate.Unmatched, "; ")), "", "L", false)
+	}
+}
+
+// card prints a recipe from the top of a page just added.
+func (d *document) card(card Card) {
+	recipe := &card.Recipe
+
+	// The footer of the previous page has been printed on adding this one
+	d.footer = card.Recipe.Name
+	if d.book != "" {
+		d.footer = d.book + "  ·  " + card.Recipe.Name
+	}
+
+	d.font("B", 22, textColor)
+	d.pdf.MultiCell(0, 9, d.text(recipe.Name), "", "L", false)
+	d.pdf.Ln(1)
+
+	if line := details(recipe); line != "" {
+		d.font("", 10, mutedColor)
+		d.pdf.MultiCell(0, lineHeight, d.text(line), "", "L", false)
+	}
+
+	if line := source(recipe); line != "" {
+		d.font("", 8.5, mutedColor)
+		d.pdf.MultiCell(0, 4, d.text(line), "", "L", false)
+	}
+
+	if note := strings.TrimSpace(card.Note); note != "" {
+		d.pdf.Ln(2)
+		d.font("I", 10, textColor)
+		d.pdf.MultiCell(0, lineHeight, d.text(note), "", "L", false)
+	}
+
+	d.pdf.Ln(4)
+
+	if len(card.Image) > 0 {
+		d.image(card.Image)
+	}
+
+	d.ingredients(recipe.Ingredients)
+	d.steps(recipe)
+
+	if card.Nutrition != nil {
+		d.nutrition(card.Nutrition)
+	}
+}
+
+// WriteCard writes a recipe card, on as many pages as it takes.
+func WriteCard(w io.Writer, card Card, paper string) error {
+	d, err := newDocument(paper, card.Recipe.Name)
+	if err != nil {
+		return err
+	}
+
+	d.pdf.AddPage()
+	d.card(card)
+
+	return d.pdf.Output(w)
+}
+
+// pageAlias stands for the page a recipe of a cookbook starts on, until it
+// is known.
+func pageAlias(i int) string {
+	return "{page" + strconv.Itoa(i) + "}"
+}
+
+// WriteCookbook writes a cookbook: a title page and a table of contents
+// linking to the recipes, each starting on a new page.
+func WriteCookbook(w io.Writer, book Cookbook, paper string) error {
+	d, err := newDocument(paper, book.Title)
+	if err != nil {
+		return err
+	}
+
+	_, pageHeight := d.pdf.GetPageSize()
+
+	d.pdf.AddPage()
+	d.pdf.SetY(pageHeight / 3)
+	d.font("B", 30, textColor)
+	d.pdf.MultiCell(0, 13, d.text(book.Title), "", "C", false)
+
+	if description := strings.TrimSpace(book.Description); description != "" {
+		d.pdf.Ln(6)
+		d.font("", 12, mutedColor)
+		d.pdf.MultiCell(0, 6, d.text(description), "", "C", false)
+	}
+
+	d.pdf.Ln(6)
+	d.font("", 11, mutedColor)
+	count := fmt.Sprintf("%d recipes", len(book.Cards))
+	if len(book.Cards) == 1 {
+		count = "1 recipe"
+	}
+	d.pdf.CellFormat(0, 6, count, "", 1, "C", false, 0, "")
+
+	d.pdf.AddPage()
+	d.book = book.Title
+	d.footer = book.Title
+	d.font("B", 18, textColor)
+	d.pdf.CellFormat(0, 10, "Contents", "", 1, "L", false, 0, "")
+	d.pdf.Ln(2)
+
+	const pageColumnWidth = 15
+	links := make([]int, len(book.Cards))
+	for i, card := range book.Cards {
+		links[i] = d.pdf.AddLink()
+
+		d.ensureSpace(7)
+		d.font("", 11, textColor)
+		d.pdf.CellFormat(d.width-pageColumnWidth, 7, d.text(card.Recipe.Name), "", 0, "L", false, links[i], "")
+		d.font("", 11, mutedColor)
+		d.pdf.CellFormat(pageColumnWidth, 7, pageAlias(i), "", 1, "L", false, links[i], "")
+	}
+
+	for i, card := range book.Cards {
+		d.pdf.AddPage()
+		d.pdf.SetLink(links[i], 0, -1)
+		d.pdf.Bookmark(d.text(card.Recipe.Name), 0, -1)
+		d.pdf.RegisterAlias(pageAlias(i), strconv.Itoa(d.pdf.PageNo()))
+
+		d.card(card)
+	}
+
+	return d.pdf.Output(w)
+}
@@ -0,0 +1,130 @@
+package printable
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/harmlessevil/recipes-api/models"
+	"github.com/harmlessevil/recipes-api/nutrition"
+)
+
+func testImage(t *testing.T) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 48; y++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 4), G: 120, B: uint8(y * 5), A: 200})
+		}
+	}
+
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.Bytes()
+}
+
+func testRecipe(name string) models.Recipe {
+	return models.Recipe{
+		Name:     name,
+		Tags:     []string{"breads", "quick_breads"},
+		Servings: 10,
+		Ingredients: []string{
+			"3 ripe bananas, mashed", "⅓ cup butter, melted", "¾ cup sugar", "1 egg",
+			"1 tsp baking soda", "1½ cups all-purpose flour", "a pinch of salt",
+		},
+		Instructions: []string{
+			"Preheat the oven to 175°C. Mix the butter into the mashed bananas.",
+			"Mix in the baking soda, then the sugar, egg and flour.",
+			"Pour into a buttered loaf pan and bake for 1 hour.",
+		},
+		CookTime: 60,
+		Source:   &models.RecipeSource{URL: "https://example.com/banana-bread", SiteName: "Example Kitchen"},
+	}
+}
+
+// pages counts the pages of an uncompressed PDF.
+func pages(pdf string) int {
+	return strings.Count(pdf, "/Type /Page\n") + strings.Count(pdf, "/Type /Page ")
+}
+
+func TestWriteCard(t *testing.T) {
+	compress = false
+	defer func() { compress = true }()
+
+	recipe := testRecipe("Banana Bread")
+	estimate := nutrition.Calculate(recipe.Ingredients, recipe.Servings)
+
+	var b bytes.Buffer
+	card := Card{Recipe: recipe, Image: testImage(t), Nutrition: &estimate, Note: "Best the next day."}
+	if err := WriteCard(&b, card, "a4"); err != nil {
+		t.Fatal(err)
+	}
+
+	pdf := b.String()
+	if !strings.HasPrefix(pdf, "%PDF-") {
+		t.Fatal("WriteCard did not write a PDF")
+	}
+
+	for _, text := range []string{"Banana Bread", "Ingredients", "1/3 cup butter", "Nutrition per serving", "/Subtype /Image"} {
+		if !strings.Contains(pdf, text) {
+			t.Errorf("WriteCard did not write %q", text)
+		}
+	}
+
+	if n := pages(pdf); n != 1 {
+		t.Errorf("WriteCard wrote %d pages, want 1", n)
+	}
+
+	// Images that cannot be decoded are left out
+	card.Image = []byte("not an image")
+	if err := WriteCard(&b, card, "letter"); err != nil {
+		t.Errorf("WriteCard with a broken image: %v", err)
+	}
+
+	if err := WriteCard(&b, card, "a5"); !errors.Is(err, ErrUnknownPaper) {
+		t.Errorf("WriteCard(a5) error = %v, want %v", err, ErrUnknownPaper)
+	}
+}
+
+func TestWriteCookbook(t *testing.T) {
+	compress = false
+	defer func() { compress = true }()
+
+	book := Cookbook{
+		Title:       "Weekend Baking",
+		Description: "Things to bake when there is time.",
+		Cards: []Card{
+			{Recipe: testRecipe("Banana Bread")},
+			{Recipe: testRecipe("Zucchini Bread"), Note: "Squeeze the zucchini dry."},
+			{Recipe: testRecipe("Pumpkin Bread")},
+		},
+	}
+
+	var b bytes.Buffer
+	if err := WriteCookbook(&b, book, "a4"); err != nil {
+		t.Fatal(err)
+	}
+
+	pdf := b.String()
+
+	// A title page, the contents and a page per recipe
+	if n := pages(pdf); n != 5 {
+		t.Errorf("WriteCookbook wrote %d pages, want 5", n)
+	}
+
+	for _, text := range []string{"Weekend Baking", "Contents", "Zucchini Bread", "Squeeze the zucchini dry."} {
+		if !strings.Contains(pdf, text) {
+			t.Errorf("WriteCookbook did not write %q", text)
+		}
+	}
+
+	if strings.Contains(pdf, "{page") || strings.Contains(pdf, "{nb}") {
+		t.Error("WriteCookbook left page numbers unresolved")
+	}
+}
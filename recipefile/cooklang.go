@@ -0,0 +1,330 @@
+package recipefile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+var (
+	cookBlockComment = regexp.MustCompile(`(?s)\[-.*?-\]`)
+	cookLineComment  = regexp.MustCompile(`--.*$`)
+	// cookToken matches ingredients (@), cookware (#) and timers (~). Names
+	// of several words must be followed by braces, which hold the quantity
+	// and unit separated by %. Ingredients may be followed by a note in
+	// parentheses.
+	cookToken = regexp.MustCompile(`([@#~])(?:([^@#~{}.,;:!?]*)\{([^}]*)\}|([^\s@#~{}.,;:!?()]+))(?:\(([^)]*)\))?`)
+)
+
+// cookMetadata are the keys of Cooklang metadata used for recipes.
+type cookMetadata struct {
+	Title    string   `yaml:"title,omitempty"`
+	Servings int      `yaml:"servings,omitempty"`
+	Tags     []string `yaml:"tags,omitempty"`
+	Source   any      `yaml:"source,omitempty"`
+}
+
+// cookAmount splits the contents of braces, e.g. 1/2%cup. The markers of
+// fixed (=) and scaled (*) quantities are dropped.
+func cookAmount(braces string) (string, string) {
+	quantity, unit, _ := strings.Cut(braces, "%")
+	quantity = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(quantity), "="), "*")
+
+	return strings.TrimSpace(quantity), strings.TrimSpace(unit)
+}
+
+// cookStep turns a step into plain text, listing the ingredients it
+// annotates.
+func cookStep(text string, recipe *models.Recipe) string {
+	return cookToken.ReplaceAllStringFunc(text, func(token string) string {
+		match := cookToken.FindStringSubmatch(token)
+
+		name := strings.TrimSpace(match[2] + match[4])
+		quantity, unit := cookAmount(match[3])
+
+		switch match[1] {
+		case "@":
+			ingredient := joinIngredient(quantity, unit, name)
+			if note := strings.TrimSpace(match[5]); note != "" {
+				ingredient += " (" + note + ")"
+			}
+			recipe.Ingredients = append(recipe.Ingredients, ingredient)
+
+			return name
+		case "~":
+			if quantity != "" {
+				return joinIngredient(quantity, unit)
+			}
+
+			return name
+		default:
+			return name
+		}
+	})
+}
+
+// applyCookMetadata sets the recipe fields of a metadata key.
+func applyCookMetadata(recipe *models.Recipe, key string, value any) {
+	switch strings.ToLower(strings.TrimSpace(key)) {
+	case "title":
+		recipe.Name = strings.TrimSpace(fmt.Sprint(value))
+	case "servings", "serves", "yield":
+		recipe.Servings = firstNumber(fmt.Sprint(value))
+	case "tags":
+		var tags []string
+		switch value := value.(type) {
+		case []any:
+			for _, tag := range value {
+				tags = append(tags, fmt.Sprint(tag))
+			}
+		default:
+			tags = strings.Split(fmt.Sprint(value), ",")
+		}
+		recipe.Tags = normalizeTags(tags)
+	case "source":
+		switch value := value.(type) {
+		case map[string]any:
+			if url, ok := value["url"].(string); ok {
+				recipe.Source.URL = url
+			}
+			if name, ok := value["name"].(string); ok {
+				recipe.Source.SiteName = name
+			}
+		default:
+			source := strings.TrimSpace(fmt.Sprint(value))
+			if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+				recipe.Source.URL = source
+			} else {
+				recipe.Source.SiteName = source
+			}
+		}
+	}
+}
+
+// ReadCooklang reads a Cooklang recipe, whose steps are separated by blank
+// lines and annotate the ingredients they use. Metadata is read from YAML
+// front matter and from >> lines.
+func ReadCooklang(data []byte) ([]models.Recipe, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+
+	recipe := models.Recipe{
+		Tags:         make([]string, 0),
+		Ingredients:  make([]string, 0),
+		Instructions: make([]string, 0),
+		Source:       &models.RecipeSource{Method: Cooklang},
+	}
+
+	if rest, found := strings.CutPrefix(text, "---\n"); found {
+		frontMatter, body, found := strings.Cut(rest, "\n---")
+		if !found {
+			return nil, errors.New("cooklang: unterminated front matter")
+		}
+
+		var metadata map[string]any
+		if err := yaml.Unmarshal([]byte(frontMatter), &metadata); err != nil {
+			return nil, fmt.Errorf("cooklang: %w", err)
+		}
+
+		// Applied in a stable order, as some keys are synonyms
+		keys := make([]string, 0, len(metadata))
+		for key := range metadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			applyCookMetadata(&recipe, key, metadata[key])
+		}
+
+		_, text, _ = strings.Cut(body, "\n")
+	}
+
+	text = cookBlockComment.ReplaceAllString(text, "")
+
+	var paragraph []string
+	endParagraph := func() {
+		if len(paragraph) > 0 {
+			step := cookStep(strings.Join(paragraph, " "), &recipe)
+			if step = strings.Join(strings.Fields(step), " "); step != "" {
+				recipe.Instructions = append(recipe.Instructions, step)
+			}
+			paragraph = nil
+		}
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(cookLineComment.ReplaceAllString(line, ""))
+
+		switch {
+		case strings.HasPrefix(line, ">>"):
+			key, value, _ := strings.Cut(strings.TrimPrefix(line, ">>"), ":")
+			applyCookMetadata(&recipe, key, strings.TrimSpace(value))
+		case line == "":
+			endParagraph()
+		case strings.HasPrefix(line, ">"), strings.HasPrefix(line, "="):
+			// Notes and section titles have no place in the recipe
+			endParagraph()
+		default:
+			paragraph = append(paragraph, line)
+		}
+	}
+	endParagraph()
+
+	return []models.Recipe{recipe}, nil
+}
+
+func isWordChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// cookAnnotation is an ingredient to annotate in a step, at the bytes from
+// start to end.
+type cookAnnotation struct {
+	step       int
+	start, end int
+	token      string
+}
+
+// findWord finds the first whole word occurrence of name in the steps, at
+// or after from, that does not overlap an annotation. Case is ignored.
+func findWord(steps []string, name string, from cookAnnotation, annotations []cookAnnotation) (cookAnnotation, bool) {
+	for step := from.step; step < len(steps); step++ {
+		text := steps[step]
+
+		start := 0
+		if step == from.step {
+			start = from.end
+		}
+
+		for ; start+len(name) <= len(text); start++ {
+			end := start + len(name)
+			if !utf8.RuneStart(text[start]) || !strings.EqualFold(text[start:end], name) {
+				continue
+			}
+
+			before, _ := utf8.DecodeLastRuneInString(text[:start])
+			after, _ := utf8.DecodeRuneInString(text[end:])
+			if isWordChar(before) || isWordChar(after) {
+				continue
+			}
+
+			overlaps := false
+			for _, a := range annotations {
+				if a.step == step && start < a.end && end > a.start {
+					overlaps = true
+				}
+			}
+			if !overlaps {
+				return cookAnnotation{step: step, start: start, end: end}, true
+			}
+		}
+	}
+
+	return cookAnnotation{}, false
+}
+
+// cookIngredient writes an ingredient as a Cooklang token named as in the
+// text it annotates.
+func cookIngredient(ingredient string, name string) string {
+	quantity, unit, _ := splitIngredient(ingredient)
+
+	token := "@" + name + "{" + quantity
+	if unit != "" {
+		token += "%" + unit
+	}
+	token += "}"
+
+	if _, note, found := strings.Cut(ingredient, " ("); found && strings.HasSuffix(note, ")") {
+		token += "(" + note
+	}
+
+	return token
+}
+
+// cookIngredientName is the name of an ingredient without quantity, unit
+// and note.
+func cookIngredientName(ingredient string) string {
+	_, _, rest := splitIngredient(ingredient)
+	if name, _, found := strings.Cut(rest, " ("); found && strings.HasSuffix(rest, ")") {
+		return name
+	}
+
+	return rest
+}
+
+// WriteCooklang writes a recipe in Cooklang. Ingredients are annotated
+// where the instructions name them, in order; those that are never named
+// are gathered in a first step of their own.
+func WriteCooklang(w io.Writer, recipes []models.Recipe) error {
+	if len(recipes) != 1 {
+		return errors.New("cooklang: a file holds a single recipe")
+	}
+	recipe := recipes[0]
+
+	metadata := cookMetadata{Title: recipe.Name, Servings: recipe.Servings, Tags: recipe.Tags}
+	if recipe.Source != nil {
+		if recipe.Source.SiteName != "" {
+			metadata.Source = map[string]string{"name": recipe.Source.SiteName, "url": recipe.Source.URL}
+		} else if recipe.Source.URL != "" {
+			metadata.Source = recipe.Source.URL
+		}
+	}
+
+	var annotations []cookAnnotation
+	var unnamed []string
+	var cursor cookAnnotation
+	for _, ingredient := range recipe.Ingredients {
+		name := cookIngredientName(ingredient)
+		if name == "" {
+			continue
+		}
+
+		a, ok := findWord(recipe.Instructions, name, cursor, annotations)
+		if !ok {
+			a, ok = findWord(recipe.Instructions, name, cookAnnotation{}, annotations)
+		}
+		if !ok {
+			unnamed = append(unnamed, cookIngredient(ingredient, name))
+			continue
+		}
+
+		a.token = cookIngredient(ingredient, recipe.Instructions[a.step][a.start:a.end])
+		annotations = append(annotations, a)
+		cursor = a
+	}
+
+	// Annotations are applied from the end, so that offsets stay valid
+	sort.Slice(annotations, func(i, j int) bool {
+		if annotations[i].step != annotations[j].step {
+			return annotations[i].step > annotations[j].step
+		}
+
+		return annotations[i].start > annotations[j].start
+	})
+
+	steps := append([]string(nil), recipe.Instructions...)
+	for _, a := range annotations {
+		steps[a.step] = steps[a.step][:a.start] + a.token + steps[a.step][a.end:]
+	}
+
+	if len(unnamed) > 0 {
+		steps = append([]string{"Gather " + strings.Join(unnamed, ", ") + "."}, steps...)
+	}
+
+	frontMatter, err := yaml.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "---\n"+string(frontMatter)+"---\n\n"+strings.Join(steps, "\n\n")+"\n")
+
+	return err
+}
@@ -0,0 +1,316 @@
+package recipefile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+// MealMaster ingredient lines are laid out in columns: the quantity in the
+// first 7, the unit code in 9 and 10 and the ingredient from 12 to 39.
+// Exports with two columns of ingredients start the second at 42.
+const (
+	mmQuantityWidth   = 7
+	mmTextColumn      = 11
+	mmTextWidth       = 28
+	mmSecondColumn    = 41
+	mmDirectionsWidth = 72
+)
+
+var (
+	mmStartPattern   = regexp.MustCompile(`(?i)^(MMMMM|-----).*meal-master`)
+	mmEndPattern     = regexp.MustCompile(`^(MMMMM|-----)\s*$`)
+	mmSectionPattern = regexp.MustCompile(`^(MMMMM|-----)-*.*-+\s*$`)
+	mmHeaderPattern  = regexp.MustCompile(`^\s*(Title|Categories|Yield|Servings):\s*(.*)$`)
+	mmQuantityChars  = regexp.MustCompile(`^[0-9 ./-]*$`)
+	// mmYieldPattern reads servings from yields such as "1 loaf, 10 servings"
+	mmYieldPattern = regexp.MustCompile(`(?i)^(\d+)\s*$|(\d+)\s*servings?\b`)
+)
+
+// mmUnits maps the unit codes of MealMaster to the units written out in
+// ingredient lines. Counts such as x (per serving) and ea have none.
+var mmUnits = []struct {
+	code     string
+	singular string
+	plural   string
+}{
+	{"x", "", ""}, {"ea", "", ""},
+	{"sm", "small", "small"}, {"md", "medium", "medium"}, {"lg", "large", "large"},
+	{"cn", "can", "cans"}, {"pk", "package", "packages"}, {"pn", "pinch", "pinches"},
+	{"dr", "drop", "drops"}, {"ds", "dash", "dashes"}, {"ct", "carton", "cartons"},
+	{"bn", "bunch", "bunches"}, {"sl", "slice", "slices"},
+	{"ts", "tsp", "tsp"}, {"t", "tsp", "tsp"}, {"tb", "tbsp", "tbsp"}, {"T", "tbsp", "tbsp"},
+	{"fl", "fl oz", "fl oz"}, {"c", "cup", "cups"}, {"pt", "pint", "pints"},
+	{"qt", "quart", "quarts"}, {"ga", "gallon", "gallons"}, {"oz", "oz", "oz"},
+	{"lb", "lb", "lb"}, {"ml", "ml", "ml"}, {"cb", "cubic cm", "cubic cm"},
+	{"cl", "cl", "cl"}, {"dl", "dl", "dl"}, {"l", "l", "l"}, {"mg", "mg", "mg"},
+	{"cg", "cg", "cg"}, {"dg", "dg", "dg"}, {"g", "g", "g"}, {"kg", "kg", "kg"},
+}
+
+func mmUnit(code string, quantity string) (string, bool) {
+	for _, u := range mmUnits {
+		if u.code == code {
+			if amount, ok := parseAmount(quantity); ok && amount > 1 {
+				return u.plural, true
+			}
+
+			return u.singular, true
+		}
+	}
+
+	return "", false
+}
+
+func mmCode(unit string) (string, bool) {
+	for _, u := range mmUnits {
+		if unit != "" && (u.singular == unit || u.plural == unit) {
+			return u.code, true
+		}
+	}
+
+	return "", false
+}
+
+// mmIngredient reads an ingredient in the columns of a line. Continuations
+// of the previous ingredient are reported with an empty quantity and unit
+// and text starting with a dash.
+func mmIngredient(line string) (quantity string, unit string, text string, ok bool) {
+	if len(line) <= mmTextColumn || line[mmQuantityWidth] != ' ' || line[mmTextColumn-1] != ' ' {
+		return "", "", "", false
+	}
+
+	quantity = strings.TrimSpace(line[:mmQuantityWidth])
+	code := strings.TrimSpace(line[mmQuantityWidth+1 : mmTextColumn-1])
+	text = strings.Join(strings.Fields(line[mmTextColumn:]), " ")
+
+	if !mmQuantityChars.MatchString(line[:mmQuantityWidth]) || text == "" {
+		return "", "", "", false
+	}
+
+	if code != "" {
+		if unit, ok = mmUnit(code, quantity); !ok {
+			return "", "", "", false
+		}
+	}
+
+	return quantity, unit, text, true
+}
+
+type mmParser struct {
+	recipe      models.Recipe
+	inDirection bool
+	paragraph   []string
+}
+
+func (p *mmParser) addIngredients(line string) bool {
+	columns := []string{line}
+	if len(line) > mmSecondColumn+mmTextColumn && strings.TrimSpace(line[mmSecondColumn-2:mmSecondColumn]) == "" {
+		if _, _, _, ok := mmIngredient(line[mmSecondColumn:]); ok {
+			columns = []string{line[:mmSecondColumn], line[mmSecondColumn:]}
+		}
+	}
+
+	if _, _, _, ok := mmIngredient(columns[0]); !ok {
+		return false
+	}
+
+	for _, column := range columns {
+		quantity, unit, text, _ := mmIngredient(column)
+
+		last := len(p.recipe.Ingredients) - 1
+		if quantity == "" && unit == "" && strings.HasPrefix(text, "-") && last >= 0 {
+			p.recipe.Ingredients[last] = joinIngredient(p.recipe.Ingredients[last], text[1:])
+			continue
+		}
+
+		p.recipe.Ingredients = append(p.recipe.Ingredients, joinIngredient(quantity, unit, text))
+	}
+
+	return true
+}
+
+func (p *mmParser) endParagraph() {
+	if len(p.paragraph) > 0 {
+		p.recipe.Instructions = append(p.recipe.Instructions, strings.Join(p.paragraph, " "))
+		p.paragraph = nil
+	}
+}
+
+func (p *mmParser) line(line string) {
+	if match := mmHeaderPattern.FindStringSubmatch(line); match != nil && !p.inDirection && len(p.recipe.Ingredients) == 0 {
+		value := strings.TrimSpace(match[2])
+		switch match[1] {
+		case "Title":
+			p.recipe.Name = value
+		case "Categories":
+			var categories []string
+			for _, category := range strings.Split(value, ",") {
+				if !strings.EqualFold(strings.TrimSpace(category), "none") {
+					categories = append(categories, category)
+				}
+			}
+			p.recipe.Tags = normalizeTags(categories)
+		case "Yield":
+			if match := mmYieldPattern.FindStringSubmatch(value); match != nil {
+				p.recipe.Servings = firstNumber(match[0])
+			}
+		default:
+			p.recipe.Servings = firstNumber(value)
+		}
+
+		return
+	}
+
+	if strings.TrimSpace(line) == "" {
+		p.endParagraph()
+		return
+	}
+
+	if mmSectionPattern.MatchString(line) {
+		return
+	}
+
+	if !p.inDirection && p.addIngredients(line) {
+		return
+	}
+
+	p.inDirection = true
+	p.paragraph = append(p.paragraph, strings.Fields(line)...)
+}
+
+// ReadMealMaster reads the recipes of a MealMaster file, which may hold
+// any number of them between other text.
+func ReadMealMaster(data []byte) ([]models.Recipe, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	recipes := make([]models.Recipe, 0)
+
+	var p *mmParser
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r\x1a")
+
+		switch {
+		case mmStartPattern.MatchString(line):
+			p = &mmParser{recipe: models.Recipe{
+				Tags:         make([]string, 0),
+				Ingredients:  make([]string, 0),
+				Instructions: make([]string, 0),
+				Source:       &models.RecipeSource{Method: MealMaster},
+			}}
+		case p == nil:
+			// Text between recipes
+		case mmEndPattern.MatchString(line):
+			p.endParagraph()
+			recipes = append(recipes, p.recipe)
+			p = nil
+		default:
+			p.line(line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("mealmaster: %w", err)
+	}
+
+	return recipes, nil
+}
+
+// wrap breaks text into lines of at most width characters, unless a single
+// word is longer.
+func wrap(text string, width int) []string {
+	var lines []string
+
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && len(line)+1+len(word) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+
+	if line != "" {
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func writeMMIngredient(b *strings.Builder, ingredient string) {
+	quantity, unit, text := splitIngredient(ingredient)
+
+	// The quantity column only holds ASCII
+	if strings.ContainsAny(quantity, "½⅓⅔¼¾⅛") {
+		amount, _ := parseAmount(quantity)
+		quantity = formatAmount(amount)
+	}
+
+	code, ok := mmCode(unit)
+	switch {
+	case len(quantity) > mmQuantityWidth:
+		quantity, code, text = "", "", joinIngredient(quantity, unit, text)
+	case !ok:
+		text = joinIngredient(unit, text)
+	}
+
+	for i, line := range wrap(text, mmTextWidth) {
+		if i == 0 {
+			fmt.Fprintf(b, "%*s %-2s %s\n", mmQuantityWidth, quantity, code, line)
+		} else {
+			fmt.Fprintf(b, "%*s -%s\n", mmTextColumn-1, "", line)
+		}
+	}
+}
+
+// WriteMealMaster writes recipes in the MealMaster format, one column of
+// ingredients and a paragraph per instruction.
+func WriteMealMaster(w io.Writer, recipes []models.Recipe) error {
+	for _, recipe := range recipes {
+		var b strings.Builder
+
+		b.WriteString("MMMMM----- Recipe via Meal-Master (tm) v8.05\n\n")
+		fmt.Fprintf(&b, "      Title: %s\n", recipe.Name)
+
+		categories := make([]string, len(recipe.Tags))
+		for i, tag := range recipe.Tags {
+			categories[i] = strings.ReplaceAll(tag, "_", " ")
+		}
+		if len(categories) == 0 {
+			categories = []string{"None"}
+		}
+		fmt.Fprintf(&b, " Categories: %s\n", strings.Join(categories, ", "))
+
+		if recipe.Servings > 0 {
+			fmt.Fprintf(&b, "   Servings: %d\n", recipe.Servings)
+		}
+		b.WriteString("\n")
+
+		for _, ingredient := range recipe.Ingredients {
+			writeMMIngredient(&b, ingredient)
+		}
+
+		for _, instruction := range recipe.Instructions {
+			b.WriteString("\n")
+			for _, line := range wrap(instruction, mmDirectionsWidth) {
+				b.WriteString("  " + line + "\n")
+			}
+		}
+
+		b.WriteString("\nMMMMM\n\n")
+
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,233 @@
+package recipefile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+// orfRecipe is a recipe in the Open Recipe Format, a YAML document. A file
+// may hold several, separated as documents.
+type orfRecipe struct {
+	RecipeName  string          `yaml:"recipe_name"`
+	RecipeUUID  string          `yaml:"recipe_uuid,omitempty"`
+	SourceURL   string          `yaml:"source_url,omitempty"`
+	SourceBook  string          `yaml:"source_book,omitempty"`
+	Yields      []orfYield      `yaml:"yields,omitempty"`
+	Ingredients []orfIngredient `yaml:"ingredients"`
+	Steps       []orfStep       `yaml:"steps"`
+}
+
+type orfYield map[string]float64
+
+type orfAmount struct {
+	Amount float64 `yaml:"amount"`
+	Unit   string  `yaml:"unit"`
+}
+
+// orfIngredient is written as a mapping from the name of the ingredient to
+// its details, or as the bare name.
+type orfIngredient struct {
+	Name    string
+	Details orfIngredientDetails
+}
+
+type orfIngredientDetails struct {
+	Amounts    []orfAmount `yaml:"amounts,omitempty"`
+	Processing []string    `yaml:"processing,omitempty"`
+	Notes      string      `yaml:"notes,omitempty"`
+}
+
+func (i *orfIngredient) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		i.Name = node.Value
+		return nil
+	}
+
+	var item map[string]*orfIngredientDetails
+	if err := node.Decode(&item); err != nil {
+		return err
+	}
+
+	if len(item) != 1 {
+		return fmt.Errorf("line %d: an ingredient must have a single name", node.Line)
+	}
+
+	for name, details := range item {
+		i.Name = name
+		if details != nil {
+			i.Details = *details
+		}
+	}
+
+	return nil
+}
+
+func (i orfIngredient) MarshalYAML() (any, error) {
+	if len(i.Details.Amounts) == 0 && len(i.Details.Processing) == 0 && i.Details.Notes == "" {
+		return i.Name, nil
+	}
+
+	return map[string]orfIngredientDetails{i.Name: i.Details}, nil
+}
+
+type orfStep struct {
+	Step  string   `yaml:"step"`
+	Notes []string `yaml:"notes,omitempty"`
+}
+
+// line writes the ingredient the way it is listed in recipes. Only the
+// first of its amounts is kept, others being the same in other units.
+func (i orfIngredient) line() string {
+	var line string
+	if len(i.Details.Amounts) > 0 {
+		amount := i.Details.Amounts[0]
+
+		unit := amount.Unit
+		if strings.EqualFold(unit, "each") {
+			unit = ""
+		}
+
+		line = joinIngredient(formatAmount(amount.Amount), unit, i.Name)
+	} else {
+		line = strings.TrimSpace(i.Name)
+	}
+
+	if len(i.Details.Processing) > 0 {
+		line += ", " + strings.Join(i.Details.Processing, ", ")
+	}
+
+	if notes := strings.TrimSpace(i.Details.Notes); notes != "" {
+		line += " (" + notes + ")"
+	}
+
+	return line
+}
+
+func toORFIngredient(line string) orfIngredient {
+	quantity, unit, rest := splitIngredient(line)
+
+	ingredient := orfIngredient{}
+	if before, notes, found := strings.Cut(rest, " ("); found && strings.HasSuffix(notes, ")") {
+		rest, ingredient.Details.Notes = before, strings.TrimSuffix(notes, ")")
+	}
+
+	name, processing, _ := strings.Cut(rest, ", ")
+	ingredient.Name = name
+	if processing != "" {
+		ingredient.Details.Processing = []string{processing}
+	}
+
+	if amount, ok := parseAmount(quantity); ok {
+		if unit == "" {
+			unit = "each"
+		}
+		ingredient.Details.Amounts = []orfAmount{{Amount: math.Round(amount*1000) / 1000, Unit: unit}}
+	} else {
+		ingredient.Name = joinIngredient(quantity, unit, name)
+	}
+
+	return ingredient
+}
+
+func fromORF(o orfRecipe) models.Recipe {
+	recipe := models.Recipe{
+		Name:         strings.TrimSpace(o.RecipeName),
+		Tags:         make([]string, 0),
+		Ingredients:  make([]string, 0, len(o.Ingredients)),
+		Instructions: make([]string, 0, len(o.Steps)),
+		ExternalID:   strings.TrimSpace(o.RecipeUUID),
+		Source: &models.RecipeSource{
+			URL:      strings.TrimSpace(o.SourceURL),
+			SiteName: strings.TrimSpace(o.SourceBook),
+			Method:   ORF,
+		},
+	}
+
+	for _, yield := range o.Yields {
+		if servings, ok := yield["servings"]; ok && recipe.Servings == 0 {
+			recipe.Servings = int(servings)
+		}
+	}
+
+	for _, ingredient := range o.Ingredients {
+		if line := ingredient.line(); line != "" {
+			recipe.Ingredients = append(recipe.Ingredients, line)
+		}
+	}
+
+	for _, step := range o.Steps {
+		if text := strings.Join(strings.Fields(step.Step), " "); text != "" {
+			recipe.Instructions = append(recipe.Instructions, text)
+		}
+	}
+
+	return recipe
+}
+
+// ReadORF reads the recipes of an Open Recipe Format file.
+func ReadORF(data []byte) ([]models.Recipe, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+
+	recipes := make([]models.Recipe, 0)
+	for {
+		var o orfRecipe
+		err := dec.Decode(&o)
+		if errors.Is(err, io.EOF) {
+			return recipes, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("orf: %w", err)
+		}
+
+		// Empty documents, as after a trailing separator
+		if o.RecipeName == "" && len(o.Ingredients) == 0 && len(o.Steps) == 0 {
+			continue
+		}
+
+		recipes = append(recipes, fromORF(o))
+	}
+}
+
+// WriteORF writes recipes as Open Recipe Format documents.
+func WriteORF(w io.Writer, recipes []models.Recipe) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+
+	for _, recipe := range recipes {
+		o := orfRecipe{
+			RecipeName:  recipe.Name,
+			RecipeUUID:  recipe.ExternalID,
+			Ingredients: make([]orfIngredient, len(recipe.Ingredients)),
+			Steps:       make([]orfStep, len(recipe.Instructions)),
+		}
+		if recipe.Source != nil {
+			o.SourceURL = recipe.Source.URL
+			o.SourceBook = recipe.Source.SiteName
+		}
+		if recipe.Servings > 0 {
+			o.Yields = []orfYield{{"servings": float64(recipe.Servings)}}
+		}
+
+		for i, ingredient := range recipe.Ingredients {
+			o.Ingredients[i] = toORFIngredient(ingredient)
+		}
+
+		for i, instruction := range recipe.Instructions {
+			o.Steps[i] = orfStep{Step: instruction}
+		}
+
+		if err := enc.Encode(&o); err != nil {
+			return err
+		}
+	}
+
+	return enc.Close()
+}
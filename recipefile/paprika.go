@@ -0,0 +1,180 @@
+package recipefile
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+// maxPaprikaRecipe bounds a decompressed recipe, which holds its photo
+const maxPaprikaRecipe = 16 << 20
+
+// maxPaprikaArchive bounds the decompressed recipes of an archive. It is
+// lowered in tests.
+var maxPaprikaArchive = 256 << 20
+
+// paprikaRecipe is a recipe as exported by Paprika. Fields without a
+// counterpart in models.Recipe are left out.
+type paprikaRecipe struct {
+	UID         string   `json:"uid"`
+	Name        string   `json:"name"`
+	Ingredients string   `json:"ingredients"`
+	Directions  string   `json:"directions"`
+	Servings    string   `json:"servings"`
+	Categories  []string `json:"categories"`
+	Source      string   `json:"source"`
+	SourceURL   string   `json:"source_url"`
+}
+
+func fromPaprika(p paprikaRecipe) models.Recipe {
+	return models.Recipe{
+		Name:         strings.TrimSpace(p.Name),
+		Tags:         normalizeTags(p.Categories),
+		Ingredients:  nonEmptyLines(p.Ingredients),
+		Instructions: nonEmptyLines(p.Directions),
+		Servings:     firstNumber(p.Servings),
+		ExternalID:   strings.TrimSpace(p.UID),
+		Source: &models.RecipeSource{
+			URL:      strings.TrimSpace(p.SourceURL),
+			SiteName: strings.TrimSpace(p.Source),
+			Method:   Paprika,
+		},
+	}
+}
+
+// readPaprikaRecipe decompresses a recipe of at most limit bytes and
+// returns it with its decompressed size.
+func readPaprikaRecipe(r io.Reader, limit int) (paprikaRecipe, int, error) {
+	var p paprikaRecipe
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return p, 0, err
+	}
+	defer gz.Close()
+
+	data, err := io.ReadAll(io.LimitReader(gz, int64(limit)+1))
+	if err != nil {
+		return p, 0, err
+	}
+	if len(data) > limit {
+		return p, 0, errors.New("recipe too large")
+	}
+
+	err = json.Unmarshal(data, &p)
+
+	return p, len(data), err
+}
+
+// ReadPaprika reads a .paprikarecipes export, a zip archive of gzipped
+// JSON recipes, or a single gzipped .paprikarecipe.
+func ReadPaprika(data []byte) ([]models.Recipe, error) {
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		p, _, err := readPaprikaRecipe(bytes.NewReader(data), maxPaprikaRecipe)
+		if err != nil {
+			return nil, fmt.Errorf("paprika: %w", err)
+		}
+
+		return []models.Recipe{fromPaprika(p)}, nil
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("paprika: %w", err)
+	}
+
+	// Checked before anything is decompressed
+	if len(archive.File) > MaxRecipes {
+		return nil, ErrTooManyRecipes
+	}
+
+	remaining := maxPaprikaArchive
+	recipes := make([]models.Recipe, 0, len(archive.File))
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+
+		r, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("paprika: %s: %w", file.Name, err)
+		}
+
+		limit := maxPaprikaRecipe
+		if remaining < limit {
+			limit = remaining
+		}
+
+		p, size, err := readPaprikaRecipe(r, limit)
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("paprika: %s: %w", file.Name, err)
+		}
+		remaining -= size
+
+		recipes = append(recipes, fromPaprika(p))
+	}
+
+	return recipes, nil
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^\p{L}\p{N} _-]+`)
+
+// WritePaprika writes a .paprikarecipes archive.
+func WritePaprika(w io.Writer, recipes []models.Recipe) error {
+	archive := zip.NewWriter(w)
+	names := make(map[string]int)
+
+	for _, recipe := range recipes {
+		p := paprikaRecipe{
+			UID:         recipe.ExternalID,
+			Name:        recipe.Name,
+			Ingredients: strings.Join(recipe.Ingredients, "\n"),
+			Directions:  strings.Join(recipe.Instructions, "\n"),
+			Categories:  recipe.Tags,
+		}
+		if p.UID == "" && !recipe.ID.IsZero() {
+			p.UID = recipe.ID.Hex()
+		}
+		if recipe.Servings > 0 {
+			p.Servings = strconv.Itoa(recipe.Servings)
+		}
+		if recipe.Source != nil {
+			p.Source = recipe.Source.SiteName
+			p.SourceURL = recipe.Source.URL
+		}
+
+		// Entries are named after the recipes, which need not be unique
+		name := strings.TrimSpace(unsafeFileChars.ReplaceAllString(recipe.Name, ""))
+		if name == "" {
+			name = "Recipe"
+		}
+		if names[name]++; names[name] > 1 {
+			name += " " + strconv.Itoa(names[name])
+		}
+
+		entry, err := archive.Create(name + ".paprikarecipe")
+		if err != nil {
+			return err
+		}
+
+		gz := gzip.NewWriter(entry)
+		if err := json.NewEncoder(gz).Encode(p); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
@@ -0,0 +1,248 @@
+// Package recipefile reads and writes the files of other recipe managers,
+// so that collections can be moved in and out of the API.
+package recipefile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/harmlessevil/recipes-api/ingredients"
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+const (
+	Paprika    = "paprika"
+	MealMaster = "mealmaster"
+	ORF        = "orf"
+	Cooklang   = "cooklang"
+)
+
+// MaxRecipes is the most recipes read from a file. Archives holding more
+// are rejected before they are decompressed.
+const MaxRecipes = 1000
+
+var (
+	ErrUnknownFormat  = errors.New("recipefile: unknown format")
+	ErrNoRecipes      = errors.New("recipefile: no recipes found")
+	ErrTooManyRecipes = fmt.Errorf("recipefile: at most %d recipes can be read from a file", MaxRecipes)
+)
+
+type Format struct {
+	// Extensions are the file name extensions of the format, most common
+	// first
+	Extensions []string
+	Read       func(data []byte) ([]models.Recipe, error)
+	Write      func(w io.Writer, recipes []models.Recipe) error
+}
+
+var Formats = map[string]Format{
+	Paprika:    {[]string{".paprikarecipes", ".paprikarecipe"}, ReadPaprika, WritePaprika},
+	MealMaster: {[]string{".mmf", ".mm"}, ReadMealMaster, WriteMealMaster},
+	ORF:        {[]string{".orf.yaml", ".yaml", ".yml"}, ReadORF, WriteORF},
+	Cooklang:   {[]string{".cook"}, ReadCooklang, WriteCooklang},
+}
+
+// FormatNames lists the supported formats in a stable order.
+var FormatNames = []string{Paprika, MealMaster, ORF, Cooklang}
+
+// Detect tells the format of a file from its name.
+func Detect(filename string) (string, bool) {
+	filename = strings.ToLower(filename)
+
+	for _, name := range FormatNames {
+		for _, extension := range Formats[name].Extensions {
+			if strings.HasSuffix(filename, extension) {
+				return name, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// Read reads the recipes of a file in the given format, or in the one
+// detected from its name if format is empty. Recipes without a name, as
+// Cooklang files often are, are named after the file.
+func Read(format string, filename string, data []byte) ([]models.Recipe, error) {
+	if format == "" {
+		format, _ = Detect(filename)
+	}
+
+	f, ok := Formats[format]
+	if !ok {
+		return nil, ErrUnknownFormat
+	}
+
+	recipes, err := f.Read(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(recipes) == 0 {
+		return nil, ErrNoRecipes
+	}
+
+	base := path.Base(strings.ReplaceAll(filename, `\`, "/"))
+	for _, extension := range f.Extensions {
+		if strings.HasSuffix(strings.ToLower(base), extension) {
+			base = base[:len(base)-len(extension)]
+			break
+		}
+	}
+
+	for i := range recipes {
+		if recipes[i].Name == "" && base != "" && base != "." {
+			recipes[i].Name = base
+		}
+	}
+
+	return recipes, nil
+}
+
+var (
+	quantityPattern = regexp.MustCompile(`^((?:\d+\s+)?\d+/\d+|\d+(?:\.\d+)?[½⅓⅔¼¾⅛]?|[½⅓⅔¼¾⅛])(?:\s+|$)`)
+	numberPattern   = regexp.MustCompile(`\d+`)
+)
+
+// splitIngredient splits an ingredient line into its leading quantity, its
+// unit as written and the rest, any of which may be empty.
+func splitIngredient(line string) (quantity string, unit string, rest string) {
+	rest = strings.Join(strings.Fields(line), " ")
+
+	match := quantityPattern.FindStringSubmatch(rest)
+	if match == nil {
+		return "", "", rest
+	}
+	quantity = match[1]
+	rest = rest[len(match[0]):]
+
+	words := strings.SplitN(rest, " ", 3)
+	if len(words) > 2 && ingredients.IsUnit(words[0]+" "+words[1]) {
+		return quantity, words[0] + " " + words[1], words[2]
+	}
+	if len(words) > 1 && ingredients.IsUnit(words[0]) {
+		return quantity, words[0], strings.Join(words[1:], " ")
+	}
+
+	return quantity, "", rest
+}
+
+// joinIngredient is the reverse of splitIngredient.
+func joinIngredient(parts ...string) string {
+	var words []string
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			words = append(words, part)
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+var fractions = []struct {
+	value float64
+	text  string
+}{
+	{1.0 / 8, "1/8"}, {1.0 / 4, "1/4"}, {1.0 / 3, "1/3"}, {3.0 / 8, "3/8"}, {1.0 / 2, "1/2"},
+	{5.0 / 8, "5/8"}, {2.0 / 3, "2/3"}, {3.0 / 4, "3/4"}, {7.0 / 8, "7/8"},
+}
+
+// formatAmount writes amounts the way cooks do, with common fractions.
+func formatAmount(amount float64) string {
+	whole := float64(int(amount))
+	rest := amount - whole
+
+	if rest < 0.01 {
+		return strconv.Itoa(int(whole))
+	}
+
+	for _, fraction := range fractions {
+		if rest > fraction.value-0.01 && rest < fraction.value+0.01 {
+			if whole == 0 {
+				return fraction.text
+			}
+
+			return strconv.Itoa(int(whole)) + " " + fraction.text
+		}
+	}
+
+	return strconv.FormatFloat(amount, 'f', -1, 64)
+}
+
+var unicodeFractions = map[rune]float64{
+	'½': 1.0 / 2, '⅓': 1.0 / 3, '⅔': 2.0 / 3, '¼': 1.0 / 4, '¾': 3.0 / 4, '⅛': 1.0 / 8,
+}
+
+// parseAmount parses the quantities matched by splitIngredient.
+func parseAmount(s string) (float64, bool) {
+	total := 0.0
+	for _, field := range strings.Fields(s) {
+		runes := []rune(field)
+		if fraction, ok := unicodeFractions[runes[len(runes)-1]]; ok {
+			total += fraction
+			field = string(runes[:len(runes)-1])
+			if field == "" {
+				continue
+			}
+		}
+
+		if numerator, denominator, found := strings.Cut(field, "/"); found {
+			n, err1 := strconv.ParseFloat(numerator, 64)
+			d, err2 := strconv.ParseFloat(denominator, 64)
+			if err1 != nil || err2 != nil || d == 0 {
+				return 0, false
+			}
+			total += n / d
+
+			continue
+		}
+
+		n, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return 0, false
+		}
+		total += n
+	}
+
+	return total, total > 0
+}
+
+// firstNumber reads counts such as servings from text like "4 servings".
+func firstNumber(s string) int {
+	n, _ := strconv.Atoi(numberPattern.FindString(s))
+	return n
+}
+
+// normalizeTags makes categories into tags, which are lowercase with
+// underscores.
+func normalizeTags(categories []string) []string {
+	seen := make(map[string]bool)
+	tags := make([]string, 0, len(categories))
+
+	for _, category := range categories {
+		tag := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(category)), " ", "_")
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// nonEmptyLines splits text into lines, dropping blank ones.
+func nonEmptyLines(text string) []string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
@@ -0,0 +1,288 @@
+package recipefile
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+func TestReadAndRoundTrip(t *testing.T) {
+	tests := []struct {
+		file   string
+		format string
+		want   []models.Recipe
+	}{
+		{
+			file:   "recipes.paprikarecipes",
+			format: Paprika,
+			want: []models.Recipe{
+				{
+					Name:         "Lemonade",
+					Tags:         []string{"drinks", "summer_favorites"},
+					Ingredients:  []string{"4 lemons", "1/2 cup sugar", "4 cups water"},
+					Instructions: []string{"Squeeze the lemons.", "Stir in the sugar and water."},
+					Servings:     4,
+					ExternalID:   "9F1A2B3C-0000-4E5F-8A9B-1C2D3E4F5A6B",
+					Source:       &models.RecipeSource{URL: "https://example.com/lemonade", SiteName: "Example Kitchen", Method: Paprika},
+				},
+				{
+					Name:         "Toast",
+					Tags:         []string{},
+					Ingredients:  []string{"2 slices bread", "butter"},
+					Instructions: []string{"Toast the bread.", "Spread with butter."},
+					ExternalID:   "0C2D3E4F-1111-4A5B-9C8D-7E6F5A4B3C2D",
+					Source:       &models.RecipeSource{Method: Paprika},
+				},
+			},
+		},
+		{
+			file:   "recipes.mmf",
+			format: MealMaster,
+			want: []models.Recipe{
+				{
+					Name: "Banana Bread",
+					Tags: []string{"breads", "quick_breads"},
+					Ingredients: []string{
+						"3 Ripe bananas, mashed", "1/3 cup Butter, melted", "3/4 cup Sugar", "1 Egg",
+						"1 tsp Baking soda", "1 1/2 cups All-purpose flour, sifted", "Walnuts, coarsely chopped, or pecans",
+					},
+					Instructions: []string{
+						"Preheat the oven to 350 degrees F. Mix the butter into the mashed bananas.",
+						"Mix in the baking soda, then the sugar, egg and flour. Pour into a buttered loaf pan and bake for 1 hour.",
+					},
+					Servings: 10,
+					Source:   &models.RecipeSource{Method: MealMaster},
+				},
+				{
+					Name:         "Garlic Butter",
+					Tags:         []string{},
+					Ingredients:  []string{"4 oz Butter, softened", "2 large Garlic cloves, minced", "1 tbsp Parsley, chopped", "Salt"},
+					Instructions: []string{"Mash everything together and chill."},
+					Servings:     4,
+					Source:       &models.RecipeSource{Method: MealMaster},
+				},
+			},
+		},
+		{
+			file:   "pancakes.orf.yaml",
+			format: ORF,
+			want: []models.Recipe{
+				{
+					Name:         "Pancakes",
+					Tags:         []string{},
+					Ingredients:  []string{"1 1/2 cups flour, sifted", "2 eggs", "1 1/4 cup milk (or buttermilk)", "salt"},
+					Instructions: []string{"Whisk the flour and salt together.", "Beat in the eggs and milk until smooth.", "Fry ladlefuls in a hot pan."},
+					Servings:     4,
+					ExternalID:   "6b1e2f0a-8c3d-4e5f-9a0b-1c2d3e4f5a6b",
+					Source:       &models.RecipeSource{URL: "https://example.com/pancakes", Method: ORF},
+				},
+				{
+					Name:         "Syrup",
+					Tags:         []string{},
+					Ingredients:  []string{"1/2 cup sugar", "1/3 cup water"},
+					Instructions: []string{"Boil until thick."},
+					Source:       &models.RecipeSource{Method: ORF},
+				},
+			},
+		},
+		{
+			file:   "guacamole.cook",
+			format: Cooklang,
+			want: []models.Recipe{
+				{
+					Name:        "Guacamole",
+					Tags:        []string{"dip", "mexican"},
+					Ingredients: []string{"2 avocados", "1 lime (juiced)", "1/4 cup red onion", "1 tsp salt", "ground cumin"},
+					Instructions: []string{
+						"Halve the avocados and scoop them into a bowl. Mash with a fork.",
+						"Squeeze in the lime and add red onion, salt and a pinch of ground cumin.",
+						"Chill for 30 minutes.",
+					},
+					Servings: 2,
+					Source:   &models.RecipeSource{URL: "https://example.com/guacamole", SiteName: "Example Kitchen", Method: Cooklang},
+				},
+			},
+		},
+		{
+			file:   "lemonade.cook",
+			format: Cooklang,
+			want: []models.Recipe{
+				{
+					Name:         "lemonade",
+					Tags:         []string{"drinks"},
+					Ingredients:  []string{"4 lemons", "1/2 cup sugar", "4 cups cold water"},
+					Instructions: []string{"Squeeze the lemons into a jug.", "Stir in sugar and cold water."},
+					Servings:     4,
+					Source:       &models.RecipeSource{Method: Cooklang},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		data, err := os.ReadFile(filepath.Join("testdata", test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recipes, err := Read("", test.file, data)
+		if err != nil {
+			t.Errorf("Read(%s): %v", test.file, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(recipes, test.want) {
+			t.Errorf("Read(%s) = %+v, want %+v", test.file, recipes, test.want)
+		}
+
+		format := Formats[test.format]
+
+		var b bytes.Buffer
+		if err := format.Write(&b, recipes); err != nil {
+			t.Errorf("Write(%s): %v", test.file, err)
+			continue
+		}
+
+		again, err := Read(test.format, test.file, b.Bytes())
+		if err != nil {
+			t.Errorf("Read(Write(%s)): %v", test.file, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(again, recipes) {
+			t.Errorf("Read(Write(%s)) = %+v, want %+v\n%s", test.file, again, recipes, b.String())
+		}
+	}
+}
+
+func TestWriteCooklangUnnamedIngredients(t *testing.T) {
+	recipe := models.Recipe{
+		Name:         "Omelette",
+		Tags:         []string{},
+		Ingredients:  []string{"2 eggs", "1 tbsp butter", "1 pinch salt"},
+		Instructions: []string{"Beat the Eggs.", "Melt the butter and cook the eggs."},
+		Source:       &models.RecipeSource{Method: Cooklang},
+	}
+
+	var b bytes.Buffer
+	if err := WriteCooklang(&b, []models.Recipe{recipe}); err != nil {
+		t.Fatal(err)
+	}
+
+	recipes, err := ReadCooklang(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := recipe
+	want.Ingredients = []string{"1 pinch salt", "2 Eggs", "1 tbsp butter"}
+	want.Instructions = append([]string{"Gather salt."}, recipe.Instructions...)
+
+	if !reflect.DeepEqual(recipes, []models.Recipe{want}) {
+		t.Errorf("ReadCooklang(WriteCooklang) = %+v, want %+v\n%s", recipes, want, b.String())
+	}
+}
+
+// paprikaArchive zips n gzipped recipes padded to size bytes.
+func paprikaArchive(t *testing.T, n int, size int) []byte {
+	var b bytes.Buffer
+	archive := zip.NewWriter(&b)
+	for i := 0; i < n; i++ {
+		w, err := archive.Create(fmt.Sprintf("%d.paprikarecipe", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gz := gzip.NewWriter(w)
+		recipe := fmt.Sprintf(`{"name": "Recipe %d"}`, i)
+		if _, err := gz.Write(append([]byte(recipe), bytes.Repeat([]byte(" "), size-len(recipe))...)); err != nil {
+			t.Fatal(err)
+		}
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.Bytes()
+}
+
+func TestReadPaprikaLimits(t *testing.T) {
+	defer func(limit int) { maxPaprikaArchive = limit }(maxPaprikaArchive)
+	maxPaprikaArchive = 4 << 10
+
+	if recipes, err := ReadPaprika(paprikaArchive(t, 3, 1<<10)); err != nil || len(recipes) != 3 {
+		t.Errorf("ReadPaprika = %d recipes, %v, want 3", len(recipes), err)
+	}
+
+	if _, err := ReadPaprika(paprikaArchive(t, 5, 1<<10)); err == nil {
+		t.Error("ReadPaprika of an archive over the decompressed limit succeeded")
+	}
+
+	if _, err := ReadPaprika(paprikaArchive(t, MaxRecipes+1, 32)); !errors.Is(err, ErrTooManyRecipes) {
+		t.Errorf("ReadPaprika of %d recipes error = %v, want %v", MaxRecipes+1, err, ErrTooManyRecipes)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		filename string
+		format   string
+	}{
+		{"Export 2023-04-01.paprikarecipes", Paprika},
+		{"BREADS.MMF", MealMaster},
+		{"pancakes.yml", ORF},
+		{"soup.cook", Cooklang},
+	}
+
+	for _, test := range tests {
+		if format, ok := Detect(test.filename); !ok || format != test.format {
+			t.Errorf("Detect(%s) = %s, %t, want %s", test.filename, format, ok, test.format)
+		}
+	}
+
+	if _, err := Read("", "recipes.txt", []byte("Lemonade")); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Read(txt) error = %v, want %v", err, ErrUnknownFormat)
+	}
+
+	if _, err := Read(MealMaster, "recipes.txt", []byte("No recipes here")); !errors.Is(err, ErrNoRecipes) {
+		t.Errorf("Read(empty) error = %v, want %v", err, ErrNoRecipes)
+	}
+}
+
+func TestAmounts(t *testing.T) {
+	tests := []struct {
+		text   string
+		amount float64
+		format string
+	}{
+		{"2", 2, "2"},
+		{"1/2", 0.5, "1/2"},
+		{"1 1/2", 1.5, "1 1/2"},
+		{"0.25", 0.25, "1/4"},
+		{"½", 0.5, "1/2"},
+		{"1½", 1.5, "1 1/2"},
+		{"2.2", 2.2, "2.2"},
+	}
+
+	for _, test := range tests {
+		amount, ok := parseAmount(test.text)
+		if !ok || amount != test.amount {
+			t.Errorf("parseAmount(%q) = %v, %t, want %v", test.text, amount, ok, test.amount)
+		}
+
+		if format := formatAmount(amount); format != test.format {
+			t.Errorf("formatAmount(%v) = %q, want %q", amount, format, test.format)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package schemaorg
+
+import (
+	"encoding/json"
+	"errors"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+var ErrNoRecipe = errors.New("schemaorg: no Recipe found in JSON-LD")
+
+var (
+	tagPattern        = regexp.MustCompile(`<[^>]*>`)
+	whitespacePattern = regexp.MustCompile(`\s+`)
+	numberPattern     = regexp.MustCompile(`\d+`)
+)
+
+// cleanText unescapes HTML entities, strips tags and collapses whitespace,
+// which sites commonly leave in their JSON-LD.
+func cleanText(s string) string {
+	s = tagPattern.ReplaceAllString(s, " ")
+	s = html.UnescapeString(s)
+
+	return strings.TrimSpace(whitespacePattern.ReplaceAllString(s, " "))
+}
+
+// Decode reads the first schema.org Recipe in a JSON-LD document. The
+// recipe may be the document itself, an element of a top-level array or
+// of an @graph, or the mainEntity of a page.
+func Decode(data []byte) (models.Recipe, error) {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return models.Recipe{}, err
+	}
+
+	node := findRecipe(doc)
+	if node == nil {
+		return models.Recipe{}, ErrNoRecipe
+	}
+
+	return FromNode(node)
+}
+
+func isType(node map[string]any, name string) bool {
+	for _, t := range values(node["@type"]) {
+		s, _ := t.(string)
+		if strings.TrimPrefix(strings.TrimPrefix(s, "http://schema.org/"), "https://schema.org/") == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func findRecipe(doc any) map[string]any {
+	switch v := doc.(type) {
+	case []any:
+		for _, item := range v {
+			if node := findRecipe(item); node != nil {
+				return node
+			}
+		}
+	case map[string]any:
+		if isType(v, "Recipe") {
+			return v
+		}
+
+		for _, key := range []string{"@graph", "mainEntity", "mainEntityOfPage", "itemListElement", "item"} {
+			if node := findRecipe(v[key]); node != nil {
+				return node
+			}
+		}
+	}
+
+	return nil
+}
+
+// values returns the elements of an array, or a single value as a one
+// element list, as JSON-LD allows either.
+func values(v any) []any {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []any:
+		return v
+	default:
+		return []any{v}
+	}
+}
+
+// text returns a value as text, picking the first of a list and the text
+// or name of an object.
+func text(v any) string {
+	switch v := v.(type) {
+	case string:
+		return cleanText(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []any:
+		for _, item := range v {
+			if s := text(item); s != "" {
+				return s
+			}
+		}
+	case map[string]any:
+		for _, key := range []string{"@value", "text", "name"} {
+			if s := text(v[key]); s != "" {
+				return s
+			}
+		}
+	}
+
+	return ""
+}
+
+// lines returns the values of a property as a list of texts. A single
+// string holding several lines is split into them.
+func lines(v any) []string {
+	result := make([]string, 0)
+	for _, item := range values(v) {
+		if s, ok := item.(string); ok && strings.Contains(s, "\n") {
+			for _, line := range strings.Split(s, "\n") {
+				if line = cleanText(line); line != "" {
+					result = append(result, line)
+				}
+			}
+
+			continue
+		}
+
+		if s := text(item); s != "" {
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
+
+// instructions flattens recipeInstructions, which can be text, a list of
+// texts or HowToSteps, or HowToSections grouping steps.
+func instructions(v any) []string {
+	result := make([]string, 0)
+	for _, item := range values(v) {
+		node, ok := item.(map[string]any)
+		if !ok {
+			result = append(result, lines(item)...)
+			continue
+		}
+
+		if isType(node, "HowToSection") || isType(node, "ItemList") {
+			result = append(result, instructions(node["itemListElement"])...)
+			continue
+		}
+
+		s := text(node["text"])
+		if s == "" {
+			s = text(node["name"])
+		}
+		if s != "" {
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
+
+// tags turns keywords, categories and cuisines into tags, which are
+// lowercase with underscores.
+func tags(node map[string]any) []string {
+	seen := make(map[string]bool)
+	result := make([]string, 0)
+
+	for _, key := range []string{"keywords", "recipeCategory", "recipeCuisine"} {
+		for _, item := range values(node[key]) {
+			for _, tag := range strings.Split(text(item), ",") {
+				tag = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(tag)), " ", "_")
+				if tag != "" && !seen[tag] {
+					seen[tag] = true
+					result = append(result, tag)
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// servings reads the number of servings from recipeYield, e.g. 4,
+// "4 servings" or ["4", "4 servings"].
+func servings(v any) int {
+	for _, item := range values(v) {
+		if n, err := strconv.Atoi(numberPattern.FindString(text(item))); err == nil && n > 0 {
+			return n
+		}
+	}
+
+	return 0
+}
+
+// FromNode converts a decoded schema.org Recipe object.
+func FromNode(node map[string]any) (models.Recipe, error) {
+	recipe := models.Recipe{
+		Name:         text(node["name"]),
+		Tags:         tags(node),
+		Ingredients:  lines(node["recipeIngredient"]),
+		Instructions: instructions(node["recipeInstructions"]),
+		Servings:     servings(node["recipeYield"]),
+	}
+
+	// Older documents use the superseded ingredients property
+	if len(recipe.Ingredients) == 0 {
+		recipe.Ingredients = lines(node["ingredients"])
+	}
+
+	if recipe.Name == "" {
+		return recipe, errors.New("schemaorg: the Recipe has no name")
+	}
+
+	return recipe, nil
+}
@@ -0,0 +1,185 @@
+// Package schemaorg converts recipes to and from schema.org Recipe JSON-LD,
+// the format search engines read rich results from and most recipe sites
+// embed in their pages.
+package schemaorg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/harmlessevil/recipes-api/models"
+	"github.com/harmlessevil/recipes-api/nutrition"
+)
+
+// MIMEType is the media type of JSON-LD documents.
+const MIMEType = "application/ld+json"
+
+type HowToStep struct {
+	Type     string `json:"@type"`
+	Position int    `json:"position"`
+	Text     string `json:"text"`
+}
+
+// NutritionInformation holds the nutrients of one serving as text with
+// units, as schema.org expects.
+type NutritionInformation struct {
+	Type                string `json:"@type"`
+	ServingSize         string `json:"servingSize,omitempty"`
+	Calories            string `json:"calories"`
+	ProteinContent      string `json:"proteinContent"`
+	FatContent          string `json:"fatContent"`
+	SaturatedFatContent string `json:"saturatedFatContent"`
+	CarbohydrateContent string `json:"carbohydrateContent"`
+	FiberContent        string `json:"fiberContent"`
+	SugarContent        string `json:"sugarContent"`
+	SodiumContent       string `json:"sodiumContent"`
+}
+
+type AggregateRating struct {
+	Type        string  `json:"@type"`
+	RatingValue float64 `json:"ratingValue"`
+	RatingCount int     `json:"ratingCount"`
+}
+
+type Recipe struct {
+	Context            string                `json:"@context"`
+	Type               string                `json:"@type"`
+	Name               string                `json:"name"`
+	Image              []string              `json:"image,omitempty"`
+	DatePublished      string                `json:"datePublished,omitempty"`
+	Keywords           string                `json:"keywords,omitempty"`
+	RecipeYield        string                `json:"recipeYield,omitempty"`
+	PrepTime           string                `json:"prepTime,omitempty"`
+	CookTime           string                `json:"cookTime,omitempty"`
+	TotalTime          string                `json:"totalTime,omitempty"`
+	RecipeIngredient   []string              `json:"recipeIngredient"`
+	RecipeInstructions []HowToStep           `json:"recipeInstructions"`
+	SuitableForDiet    []string              `json:"suitableForDiet,omitempty"`
+	Nutrition          *NutritionInformation `json:"nutrition,omitempty"`
+	AggregateRating    *AggregateRating      `json:"aggregateRating,omitempty"`
+	CommentCount       int                   `json:"commentCount,omitempty"`
+}
+
+// restrictedDiets maps our diets to the schema.org RestrictedDiet values.
+// The others have no counterpart.
+var restrictedDiets = map[string]string{
+	"vegan":       "https://schema.org/VeganDiet",
+	"vegetarian":  "https://schema.org/VegetarianDiet",
+	"gluten-free": "https://schema.org/GlutenFreeDiet",
+}
+
+// Duration formats minutes as an ISO 8601 duration such as PT1H30M.
+func Duration(minutes int) string {
+	if minutes <= 0 {
+		return ""
+	}
+
+	duration := "PT"
+	if minutes >= 60 {
+		duration += strconv.Itoa(minutes/60) + "H"
+	}
+	if minutes%60 != 0 {
+		duration += strconv.Itoa(minutes%60) + "M"
+	}
+
+	return duration
+}
+
+func formatAmount(value float64, unit string) string {
+	return strconv.FormatFloat(value, 'f', -1, 64) + " " + unit
+}
+
+// Encode renders a recipe as a schema.org Recipe. The nutrition estimate
+// is optional.
+func Encode(recipe models.Recipe, estimate *nutrition.Estimate) Recipe {
+	doc := Recipe{
+		Context:            "https://schema.org",
+		Type:               "Recipe",
+		Name:               recipe.Name,
+		Keywords:           strings.Join(recipe.Tags, ", "),
+		PrepTime:           Duration(recipe.PrepTime),
+		CookTime:           Duration(recipe.CookTime),
+		TotalTime:          Duration(recipe.TotalTime),
+		RecipeIngredient:   make([]string, 0, len(recipe.Ingredients)),
+		RecipeInstructions: make([]HowToStep, 0, len(recipe.Steps)),
+		CommentCount:       recipe.CommentCount,
+	}
+
+	if !recipe.PublishedAt.IsZero() {
+		doc.DatePublished = recipe.PublishedAt.Format("2006-01-02")
+	}
+
+	if recipe.Servings > 0 {
+		doc.RecipeYield = fmt.Sprintf("%d servings", recipe.Servings)
+	}
+
+	// The cover comes first as it is the image search engines show
+	for _, cover := range []bool{true, false} {
+		for _, image := range recipe.Images {
+			if image.Cover != cover {
+				continue
+			}
+
+			for _, variant := range image.Variants {
+				if variant.Name == "original" {
+					doc.Image = append(doc.Image, variant.URL)
+				}
+			}
+		}
+	}
+
+	for _, line := range recipe.Ingredients {
+		if line = strings.TrimSpace(line); line != "" {
+			doc.RecipeIngredient = append(doc.RecipeIngredient, line)
+		}
+	}
+
+	if len(recipe.Steps) > 0 {
+		for _, step := range recipe.Steps {
+			doc.RecipeInstructions = append(doc.RecipeInstructions, HowToStep{Type: "HowToStep", Position: step.Number, Text: step.Text})
+		}
+	} else {
+		for _, instruction := range recipe.Instructions {
+			if instruction = cleanText(instruction); instruction != "" {
+				doc.RecipeInstructions = append(doc.RecipeInstructions, HowToStep{
+					Type:     "HowToStep",
+					Position: len(doc.RecipeInstructions) + 1,
+					Text:     instruction,
+				})
+			}
+		}
+	}
+
+	for _, diet := range recipe.Diets {
+		if restricted, ok := restrictedDiets[diet]; ok {
+			doc.SuitableForDiet = append(doc.SuitableForDiet, restricted)
+		}
+	}
+
+	if estimate != nil {
+		perServing := estimate.PerServing
+		doc.Nutrition = &NutritionInformation{
+			Type:                "NutritionInformation",
+			ServingSize:         fmt.Sprintf("1 of %d servings", estimate.Servings),
+			Calories:            formatAmount(perServing.Calories, "kcal"),
+			ProteinContent:      formatAmount(perServing.Protein, "g"),
+			FatContent:          formatAmount(perServing.Fat, "g"),
+			SaturatedFatContent: formatAmount(perServing.SaturatedFat, "g"),
+			CarbohydrateContent: formatAmount(perServing.Carbohydrates, "g"),
+			FiberContent:        formatAmount(perServing.Fiber, "g"),
+			SugarContent:        formatAmount(perServing.Sugar, "g"),
+			SodiumContent:       formatAmount(perServing.Sodium, "mg"),
+		}
+	}
+
+	if recipe.RatingCount > 0 {
+		doc.AggregateRating = &AggregateRating{
+			Type:        "AggregateRating",
+			RatingValue: recipe.RatingAverage,
+			RatingCount: recipe.RatingCount,
+		}
+	}
+
+	return doc
+}
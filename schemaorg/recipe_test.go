@@ -0,0 +1,168 @@
+package schemaorg
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/harmlessevil/recipes-api/models"
+	"github.com/harmlessevil/recipes-api/nutrition"
+)
+
+func TestDuration(t *testing.T) {
+	tests := map[int]string{0: "", 5: "PT5M", 60: "PT1H", 95: "PT1H35M"}
+
+	for minutes, want := range tests {
+		if got := Duration(minutes); got != want {
+			t.Errorf("Duration(%d) = %q, want %q", minutes, got, want)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	recipe := models.Recipe{
+		Name:         "Pancakes",
+		Tags:         []string{"breakfast", "vegetarian"},
+		Ingredients:  []string{"2 cups flour", " 2 eggs", ""},
+		Instructions: []string{"Mix everything", "Fry for 2 minutes"},
+		Servings:     4,
+		PublishedAt:  time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC),
+		Steps: []models.Step{
+			{Number: 1, Text: "Mix everything."},
+			{Number: 2, Text: "Fry for 2 minutes."},
+		},
+		PrepTime:      10,
+		CookTime:      2,
+		TotalTime:     12,
+		Diets:         []string{"nut-free", "vegetarian"},
+		RatingAverage: 4.5,
+		RatingCount:   2,
+		Images: []models.RecipeImage{
+			{Variants: []models.ImageVariant{{Name: "original", URL: "/media/a.jpg"}}},
+			{Cover: true, Variants: []models.ImageVariant{{Name: "thumbnail", URL: "/media/b-small.jpg"}, {Name: "original", URL: "/media/b.jpg"}}},
+		},
+	}
+	estimate := nutrition.Estimate{Servings: 4, PerServing: nutrition.Nutrients{Calories: 250.5, Sodium: 120}}
+
+	doc := Encode(recipe, &estimate)
+
+	if doc.Type != "Recipe" || doc.Name != "Pancakes" || doc.DatePublished != "2023-04-01" || doc.RecipeYield != "4 servings" {
+		t.Errorf("Encode() = %+v", doc)
+	}
+
+	if want := []string{"2 cups flour", "2 eggs"}; !reflect.DeepEqual(doc.RecipeIngredient, want) {
+		t.Errorf("RecipeIngredient = %q, want %q", doc.RecipeIngredient, want)
+	}
+
+	if want := []string{"/media/b.jpg", "/media/a.jpg"}; !reflect.DeepEqual(doc.Image, want) {
+		t.Errorf("Image = %q, want %q", doc.Image, want)
+	}
+
+	if doc.PrepTime != "PT10M" || doc.TotalTime != "PT12M" || doc.Keywords != "breakfast, vegetarian" {
+		t.Errorf("PrepTime, TotalTime, Keywords = %q, %q, %q", doc.PrepTime, doc.TotalTime, doc.Keywords)
+	}
+
+	if want := []string{"https://schema.org/VegetarianDiet"}; !reflect.DeepEqual(doc.SuitableForDiet, want) {
+		t.Errorf("SuitableForDiet = %q, want %q", doc.SuitableForDiet, want)
+	}
+
+	if doc.Nutrition == nil || doc.Nutrition.Calories != "250.5 kcal" || doc.Nutrition.SodiumContent != "120 mg" {
+		t.Errorf("Nutrition = %+v", doc.Nutrition)
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Encoding and decoding again keeps the recipe
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.Name != recipe.Name || decoded.Servings != recipe.Servings ||
+		!reflect.DeepEqual(decoded.Tags, recipe.Tags) ||
+		!reflect.DeepEqual(decoded.Ingredients, doc.RecipeIngredient) ||
+		!reflect.DeepEqual(decoded.Instructions, []string{"Mix everything.", "Fry for 2 minutes."}) {
+		t.Errorf("Decode(Encode()) = %+v", decoded)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want models.Recipe
+	}{
+		{
+			name: "graph with sections",
+			doc: `{
+				"@context": "https://schema.org",
+				"@graph": [
+					{"@type": "WebPage", "name": "Page"},
+					{
+						"@type": ["Recipe", "NewsArticle"],
+						"name": "Mac &amp; Cheese",
+						"recipeYield": ["6", "6 servings"],
+						"recipeCategory": "Main Course",
+						"recipeCuisine": ["American"],
+						"keywords": "comfort food, cheese",
+						"recipeIngredient": ["1 lb <b>macaroni</b>", "2 cups cheddar"],
+						"recipeInstructions": [
+							{"@type": "HowToSection", "name": "Pasta", "itemListElement": [
+								{"@type": "HowToStep", "text": "Boil the   macaroni."}
+							]},
+							{"@type": "HowToStep", "name": "Stir in the cheese."}
+						]
+					}
+				]
+			}`,
+			want: models.Recipe{
+				Name:         "Mac & Cheese",
+				Tags:         []string{"comfort_food", "cheese", "main_course", "american"},
+				Ingredients:  []string{"1 lb macaroni", "2 cups cheddar"},
+				Instructions: []string{"Boil the macaroni.", "Stir in the cheese."},
+				Servings:     6,
+			},
+		},
+		{
+			name: "array with text instructions",
+			doc: `[{"@type": "Person"}, {
+				"@type": "http://schema.org/Recipe",
+				"name": "Toast",
+				"recipeYield": 2,
+				"ingredients": "2 slices bread\nbutter",
+				"recipeInstructions": "Toast the bread.\nSpread the butter."
+			}]`,
+			want: models.Recipe{
+				Name:         "Toast",
+				Tags:         []string{},
+				Ingredients:  []string{"2 slices bread", "butter"},
+				Instructions: []string{"Toast the bread.", "Spread the butter."},
+				Servings:     2,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		got, err := Decode([]byte(test.doc))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Decode() = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, doc := range []string{`{"@type": "WebPage"}`, `{"@type": "Recipe"}`, `not json`} {
+		if _, err := Decode([]byte(doc)); err == nil {
+			t.Errorf("Decode(%s) succeeded", doc)
+		}
+	}
+}
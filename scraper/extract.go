@@ -0,0 +1,202 @@
+// Package scraper imports recipes from web pages. It reads the schema.org
+// Recipe that most recipe sites embed as JSON-LD or microdata, and falls
+// back to guessing the ingredient and instruction lists from the markup.
+package scraper
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/harmlessevil/recipes-api/models"
+	"github.com/harmlessevil/recipes-api/schemaorg"
+)
+
+const (
+	MethodJSONLD    = "json-ld"
+	MethodMicrodata = "microdata"
+	MethodHeuristic = "heuristic"
+)
+
+var ErrNoRecipe = errors.New("scraper: no recipe found in the page")
+
+var extractors = []struct {
+	method  string
+	extract func(doc *html.Node) (models.Recipe, bool)
+}{
+	{MethodJSONLD, fromJSONLD},
+	{MethodMicrodata, fromMicrodata},
+	{MethodHeuristic, fromHeuristics},
+}
+
+// Extract finds the recipe in an HTML page. pageURL, which may be empty,
+// is recorded as the source of the recipe.
+func Extract(page []byte, pageURL string) (models.Recipe, error) {
+	doc, err := html.Parse(bytes.NewReader(page))
+	if err != nil {
+		return models.Recipe{}, err
+	}
+
+	for _, extractor := range extractors {
+		recipe, ok := extractor.extract(doc)
+		if !ok {
+			continue
+		}
+
+		if recipe.Tags == nil {
+			recipe.Tags = []string{}
+		}
+
+		recipe.Source = &models.RecipeSource{
+			URL:      pageURL,
+			SiteName: siteName(doc, pageURL),
+			Method:   extractor.method,
+		}
+
+		return recipe, nil
+	}
+
+	return models.Recipe{}, ErrNoRecipe
+}
+
+func attr(n *html.Node, name string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val, true
+		}
+	}
+
+	return "", false
+}
+
+func attrValue(n *html.Node, name string) string {
+	value, _ := attr(n, name)
+	return value
+}
+
+// find returns the elements for which match is true in document order,
+// not descending into matched elements.
+func find(n *html.Node, match func(*html.Node) bool) []*html.Node {
+	var found []*html.Node
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && match(n) {
+			found = append(found, n)
+			return
+		}
+
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+
+	return found
+}
+
+var blockElements = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Blockquote: true, atom.Br: true,
+	atom.Dd: true, atom.Div: true, atom.Dt: true, atom.H1: true, atom.H2: true,
+	atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true, atom.Li: true,
+	atom.Ol: true, atom.P: true, atom.Section: true, atom.Tr: true, atom.Ul: true,
+}
+
+// textContent returns the text of a node with whitespace collapsed. With
+// lines set, block elements start new lines instead of being joined.
+func textContent(n *html.Node, lines bool) string {
+	var b strings.Builder
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			b.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			if n.DataAtom == atom.Script || n.DataAtom == atom.Style || n.DataAtom == atom.Noscript {
+				return
+			}
+		}
+
+		block := n.Type == html.ElementNode && blockElements[n.DataAtom]
+		if block {
+			b.WriteString("\n")
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+		if block {
+			b.WriteString("\n")
+		}
+	}
+	walk(n)
+
+	if !lines {
+		return strings.Join(strings.Fields(b.String()), " ")
+	}
+
+	var result []string
+	for _, line := range strings.Split(b.String(), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			result = append(result, line)
+		}
+	}
+
+	return strings.Join(result, "\n")
+}
+
+// meta returns the content of a meta element by its property or name.
+func meta(doc *html.Node, name string) string {
+	elements := find(doc, func(n *html.Node) bool {
+		return n.DataAtom == atom.Meta && (attrValue(n, "property") == name || attrValue(n, "name") == name)
+	})
+	if len(elements) == 0 {
+		return ""
+	}
+
+	return strings.TrimSpace(attrValue(elements[0], "content"))
+}
+
+func siteName(doc *html.Node, pageURL string) string {
+	if name := meta(doc, "og:site_name"); name != "" {
+		return name
+	}
+
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimPrefix(u.Hostname(), "www.")
+}
+
+func fromJSONLD(doc *html.Node) (models.Recipe, bool) {
+	scripts := find(doc, func(n *html.Node) bool {
+		scriptType := strings.ToLower(strings.TrimSpace(attrValue(n, "type")))
+		return n.DataAtom == atom.Script && strings.HasPrefix(scriptType, schemaorg.MIMEType)
+	})
+
+	for _, script := range scripts {
+		var content strings.Builder
+		for child := script.FirstChild; child != nil; child = child.NextSibling {
+			content.WriteString(child.Data)
+		}
+
+		// Some sites wrap the JSON in comments or CDATA sections
+		data := strings.TrimSpace(content.String())
+		for _, wrapper := range [][2]string{{"<!--", "-->"}, {"//<![CDATA[", "//]]>"}, {"<![CDATA[", "]]>"}} {
+			data = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(data, wrapper[0]), wrapper[1]))
+		}
+
+		if recipe, err := schemaorg.Decode([]byte(data)); err == nil {
+			return recipe, true
+		}
+	}
+
+	return models.Recipe{}, false
+}
@@ -0,0 +1,212 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html/charset"
+
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+const (
+	// DefaultMaxSize bounds the size of fetched pages
+	DefaultMaxSize   = 5 << 20
+	DefaultUserAgent = "recipes-api/1.0 (+recipe import)"
+	maxRedirects     = 5
+)
+
+var (
+	ErrInvalidURL    = errors.New("scraper: only absolute http and https URLs can be imported")
+	ErrNotHTML       = errors.New("scraper: the URL does not point to an HTML page")
+	ErrBlockedTarget = errors.New("scraper: the URL points to a private network address")
+)
+
+// FetchError reports that a page could not be fetched, as opposed to a
+// page without a recipe.
+type FetchError struct {
+	URL string
+	Err error
+}
+
+func (e *FetchError) Error() string {
+	return "scraper: fetching " + e.URL + ": " + e.Err.Error()
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Client fetches web pages and extracts the recipes in them.
+type Client struct {
+	HTTPClient *http.Client
+	MaxSize    int64
+	UserAgent  string
+}
+
+// reservedNetworks are not covered by the net.IP predicates but can still
+// reach internal hosts: "this network", carrier-grade NAT, IETF protocol
+// assignments, benchmarking, the reserved class E, and NAT64 and 6to4,
+// which embed IPv4 addresses.
+var reservedNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "198.18.0.0/15", "240.0.0.0/4",
+		"64:ff9b::/96", "2002::/16",
+	} {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks
+}()
+
+func isPublic(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NewHTTPClient returns a client for fetching pages on behalf of users. It
+// refuses to connect to loopback, private, link-local and reserved
+// addresses, so that imports cannot reach internal services.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		// Control runs after name resolution, so it sees the address
+		// actually connected to
+		Control: func(_ string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || !isPublic(ip) {
+				return ErrBlockedTarget
+			}
+
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:       timeout,
+		Transport:     transport,
+		CheckRedirect: checkRedirect,
+	}
+}
+
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return errors.New("too many redirects")
+	}
+
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return ErrInvalidURL
+	}
+
+	return nil
+}
+
+// ParseURL checks that a URL can be imported.
+func ParseURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrInvalidURL
+	}
+
+	return u, nil
+}
+
+// Fetch downloads an HTML page, converted to UTF-8, and returns it with
+// its URL after redirects.
+func (c *Client) Fetch(ctx context.Context, rawURL string) ([]byte, string, error) {
+	u, err := ParseURL(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	userAgent := c.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, "", &FetchError{URL: u.String(), Err: err}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return nil, "", &FetchError{URL: u.String(), Err: fmt.Errorf("unexpected status %s", res.Status)}
+	}
+
+	contentType := res.Header.Get("Content-Type")
+	if contentType != "" && !strings.Contains(contentType, "html") {
+		return nil, "", ErrNotHTML
+	}
+
+	maxSize := c.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+
+	body, err := charset.NewReader(io.LimitReader(res.Body, maxSize), contentType)
+	if err != nil {
+		return nil, "", &FetchError{URL: u.String(), Err: err}
+	}
+
+	page, err := io.ReadAll(body)
+	if err != nil {
+		return nil, "", &FetchError{URL: u.String(), Err: err}
+	}
+
+	return page, res.Request.URL.String(), nil
+}
+
+// Import fetches a page and extracts its recipe.
+func (c *Client) Import(ctx context.Context, rawURL string) (models.Recipe, error) {
+	page, finalURL, err := c.Fetch(ctx, rawURL)
+	if err != nil {
+		return models.Recipe{}, err
+	}
+
+	return Extract(page, finalURL)
+}
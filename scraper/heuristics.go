@@ -0,0 +1,180 @@
+package scraper
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+// section describes how to recognise a part of a recipe in markup without
+// structured data: by the class or id of its list items, or by the heading
+// above it.
+type section struct {
+	classWords []string
+	heading    *regexp.Regexp
+	// paragraphs accepts paragraphs below the heading instead of a list
+	paragraphs bool
+}
+
+var (
+	ingredientsSection = section{
+		classWords: []string{"ingredient"},
+		heading:    regexp.MustCompile(`(?i)^ingredients?\b`),
+	}
+	instructionsSection = section{
+		classWords: []string{"instruction", "direction", "method", "preparation", "step"},
+		heading:    regexp.MustCompile(`(?i)^(instructions?|directions?|method|preparation|steps)\b`),
+		paragraphs: true,
+	}
+)
+
+var headingElements = map[atom.Atom]bool{
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+}
+
+// maxHeadingLength keeps paragraphs that merely start with a word like
+// "Method" from being taken for headings.
+const maxHeadingLength = 40
+
+func hasClassWord(n *html.Node, words []string) bool {
+	names := strings.ToLower(attrValue(n, "class") + " " + attrValue(n, "id"))
+	for _, word := range words {
+		if strings.Contains(names, word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isHeading reports whether an element looks like a heading, which also
+// covers paragraphs holding nothing but bold text.
+func isHeading(n *html.Node) bool {
+	if headingElements[n.DataAtom] {
+		return true
+	}
+
+	if n.DataAtom != atom.P && n.DataAtom != atom.Strong && n.DataAtom != atom.B {
+		return false
+	}
+
+	text := textContent(n, false)
+
+	return text != "" && len(text) <= maxHeadingLength && !strings.HasSuffix(text, ".")
+}
+
+func texts(elements []*html.Node) []string {
+	result := make([]string, 0, len(elements))
+	for _, element := range elements {
+		if text := textContent(element, false); text != "" {
+			result = append(result, text)
+		}
+	}
+
+	return result
+}
+
+// elements lists the elements of a document in document order.
+func elements(doc *html.Node) []*html.Node {
+	var result []*html.Node
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			result = append(result, n)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	return result
+}
+
+func isDescendant(n *html.Node, ancestor *html.Node) bool {
+	for ; n != nil; n = n.Parent {
+		if n == ancestor {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lines returns the items of a section of the page.
+func (s section) lines(doc *html.Node) []string {
+	items := find(doc, func(n *html.Node) bool {
+		return n.DataAtom == atom.Li && hasClassWord(n, s.classWords)
+	})
+	if len(items) > 0 {
+		return texts(items)
+	}
+
+	all := elements(doc)
+	for i, heading := range all {
+		if !isHeading(heading) || !s.heading.MatchString(textContent(heading, false)) {
+			continue
+		}
+
+		var paragraphs []*html.Node
+		for _, n := range all[i+1:] {
+			if isDescendant(n, heading) {
+				continue
+			}
+
+			if n.DataAtom == atom.Ul || n.DataAtom == atom.Ol {
+				return texts(find(n, func(n *html.Node) bool { return n.DataAtom == atom.Li }))
+			}
+
+			if isHeading(n) {
+				break
+			}
+
+			if s.paragraphs && n.DataAtom == atom.P {
+				paragraphs = append(paragraphs, n)
+			}
+		}
+
+		if len(paragraphs) > 0 {
+			return texts(paragraphs)
+		}
+	}
+
+	return nil
+}
+
+func title(doc *html.Node) string {
+	if title := meta(doc, "og:title"); title != "" {
+		return title
+	}
+
+	for _, element := range []atom.Atom{atom.H1, atom.Title} {
+		found := find(doc, func(n *html.Node) bool { return n.DataAtom == element })
+		if len(found) > 0 {
+			if text := textContent(found[0], false); text != "" {
+				return text
+			}
+		}
+	}
+
+	return ""
+}
+
+// fromHeuristics guesses the recipe of a page without structured data. It
+// only succeeds if both ingredients and instructions are found.
+func fromHeuristics(doc *html.Node) (models.Recipe, bool) {
+	recipe := models.Recipe{
+		Name:         title(doc),
+		Ingredients:  ingredientsSection.lines(doc),
+		Instructions: instructionsSection.lines(doc),
+	}
+
+	ok := recipe.Name != "" && len(recipe.Ingredients) > 0 && len(recipe.Instructions) > 0
+
+	return recipe, ok
+}
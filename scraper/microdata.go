@@ -0,0 +1,104 @@
+package scraper
+
+import (
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/harmlessevil/recipes-api/models"
+	"github.com/harmlessevil/recipes-api/schemaorg"
+)
+
+func isItem(n *html.Node) bool {
+	_, ok := attr(n, "itemscope")
+	return ok
+}
+
+// microdataValue returns the value of a property element as defined by the
+// HTML microdata specification.
+func microdataValue(n *html.Node) string {
+	switch n.DataAtom {
+	case atom.Meta:
+		return attrValue(n, "content")
+	case atom.A, atom.Area, atom.Link:
+		return attrValue(n, "href")
+	case atom.Audio, atom.Embed, atom.Iframe, atom.Img, atom.Source, atom.Track, atom.Video:
+		return attrValue(n, "src")
+	case atom.Object:
+		return attrValue(n, "data")
+	case atom.Data, atom.Meter:
+		return attrValue(n, "value")
+	case atom.Time:
+		if datetime, ok := attr(n, "datetime"); ok {
+			return datetime
+		}
+	}
+
+	return textContent(n, true)
+}
+
+// microdataItem collects the properties of an item into the structure
+// JSON-LD decodes to, so that schemaorg can convert either.
+func microdataItem(item *html.Node) map[string]any {
+	node := map[string]any{}
+	if types := strings.Fields(attrValue(item, "itemtype")); len(types) > 0 {
+		node["@type"] = path.Base(types[0])
+	}
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+
+			if props := strings.Fields(attrValue(child, "itemprop")); len(props) > 0 {
+				var value any
+				if isItem(child) {
+					value = microdataItem(child)
+				} else {
+					value = microdataValue(child)
+				}
+
+				for _, prop := range props {
+					values, _ := node[prop].([]any)
+					node[prop] = append(values, value)
+				}
+			}
+
+			// Properties of nested items belong to them
+			if !isItem(child) {
+				walk(child)
+			}
+		}
+	}
+	walk(item)
+
+	return node
+}
+
+func fromMicrodata(doc *html.Node) (models.Recipe, bool) {
+	items := find(doc, func(n *html.Node) bool {
+		if !isItem(n) {
+			return false
+		}
+
+		for _, itemType := range strings.Fields(attrValue(n, "itemtype")) {
+			if strings.EqualFold(path.Base(itemType), "Recipe") {
+				return true
+			}
+		}
+
+		return false
+	})
+
+	for _, item := range items {
+		if recipe, err := schemaorg.FromNode(microdataItem(item)); err == nil {
+			return recipe, true
+		}
+	}
+
+	return models.Recipe{}, false
+}
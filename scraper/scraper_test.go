@@ -0,0 +1,224 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const jsonLDPage = `<!DOCTYPE html>
+<html><head>
+<meta property="og:site_name" content="Example Kitchen">
+<script type="application/ld+json">{"@context": "https://schema.org", "@type": "WebSite", "name": "Example Kitchen"}</script>
+<script type="application/ld+json">
+<!--
+{"@context": "https://schema.org", "@graph": [{
+	"@type": "Recipe",
+	"name": "Lemonade",
+	"recipeYield": "4",
+	"keywords": "drinks",
+	"recipeIngredient": ["4 lemons", "1/2 cup sugar", "4 cups water"],
+	"recipeInstructions": [{"@type": "HowToStep", "text": "Squeeze the lemons."}, {"@type": "HowToStep", "text": "Stir in the sugar and water."}]
+}]}
+-->
+</script>
+</head><body><h1>Lemonade</h1></body></html>`
+
+const microdataPage = `<html><body>
+<div itemscope itemtype="https://schema.org/WebPage">
+<article itemscope itemtype="http://schema.org/Recipe">
+	<h1 itemprop="name">Guacamole</h1>
+	<meta itemprop="recipeYield" content="2 servings">
+	<span itemprop="recipeCategory">Dip</span>
+	<ul>
+		<li itemprop="recipeIngredient">2 <b>ripe</b> avocados</li>
+		<li itemprop="recipeIngredient">1 lime</li>
+	</ul>
+	<div itemprop="author" itemscope itemtype="http://schema.org/Person"><span itemprop="name">Ana</span></div>
+	<div itemprop="recipeInstructions">
+		<p>Mash the avocados.</p>
+		<p>Squeeze in the lime.</p>
+	</div>
+</article>
+</div>
+</body></html>`
+
+const plainPage = `<html><head><title>Grandma's Pancakes | Blog</title></head><body>
+<nav><ul><li>Home</li><li>About</li></ul></nav>
+<h1>Grandma's Pancakes</h1>
+<p>These are the best pancakes.</p>
+<h2>Ingredients</h2>
+<ul><li>1 cup flour</li><li>1 egg</li><li>1 cup milk</li></ul>
+<p><strong>Method</strong></p>
+<p>Whisk everything together.</p>
+<p>Fry in a hot pan for 2 minutes on each side.</p>
+<h2>Comments</h2>
+<p>Great recipe!</p>
+</body></html>`
+
+const classedPage = `<html><body>
+<h1 class="title">Tomato Soup</h1>
+<ul class="ingredients"><li class="ingredient"><span class="ingredient-amount">1 kg</span> tomatoes</li><li class="ingredient">1 onion</li></ul>
+<ol><li class="instruction">Chop everything.</li><li class="instruction">Simmer for 30 minutes.</li></ol>
+</body></html>`
+
+func TestImport(t *testing.T) {
+	mux := http.NewServeMux()
+	pages := map[string]string{
+		"/lemonade":  jsonLDPage,
+		"/guacamole": microdataPage,
+		"/pancakes":  plainPage,
+		"/soup":      classedPage,
+	}
+	for path, page := range pages {
+		page := page
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(page))
+		})
+	}
+	mux.Handle("/moved", http.RedirectHandler("/lemonade", http.StatusMovedPermanently))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{HTTPClient: server.Client()}
+
+	tests := []struct {
+		path         string
+		method       string
+		name         string
+		ingredients  []string
+		instructions []string
+		servings     int
+		tags         []string
+		siteName     string
+		sourcePath   string
+	}{
+		{
+			path: "/moved", method: MethodJSONLD, name: "Lemonade",
+			ingredients:  []string{"4 lemons", "1/2 cup sugar", "4 cups water"},
+			instructions: []string{"Squeeze the lemons.", "Stir in the sugar and water."},
+			servings:     4, tags: []string{"drinks"}, siteName: "Example Kitchen", sourcePath: "/lemonade",
+		},
+		{
+			path: "/guacamole", method: MethodMicrodata, name: "Guacamole",
+			ingredients:  []string{"2 ripe avocados", "1 lime"},
+			instructions: []string{"Mash the avocados.", "Squeeze in the lime."},
+			servings:     2, tags: []string{"dip"}, siteName: "127.0.0.1", sourcePath: "/guacamole",
+		},
+		{
+			path: "/pancakes", method: MethodHeuristic, name: "Grandma's Pancakes",
+			ingredients:  []string{"1 cup flour", "1 egg", "1 cup milk"},
+			instructions: []string{"Whisk everything together.", "Fry in a hot pan for 2 minutes on each side."},
+			tags:         []string{}, siteName: "127.0.0.1", sourcePath: "/pancakes",
+		},
+		{
+			path: "/soup", method: MethodHeuristic, name: "Tomato Soup",
+			ingredients:  []string{"1 kg tomatoes", "1 onion"},
+			instructions: []string{"Chop everything.", "Simmer for 30 minutes."},
+			tags:         []string{}, siteName: "127.0.0.1", sourcePath: "/soup",
+		},
+	}
+
+	for _, test := range tests {
+		recipe, err := client.Import(context.Background(), server.URL+test.path)
+		if err != nil {
+			t.Errorf("Import(%s): %v", test.path, err)
+			continue
+		}
+
+		if recipe.Name != test.name || recipe.Servings != test.servings {
+			t.Errorf("Import(%s) name, servings = %q, %d, want %q, %d", test.path, recipe.Name, recipe.Servings, test.name, test.servings)
+		}
+
+		if !reflect.DeepEqual(recipe.Ingredients, test.ingredients) {
+			t.Errorf("Import(%s) ingredients = %q, want %q", test.path, recipe.Ingredients, test.ingredients)
+		}
+
+		if !reflect.DeepEqual(recipe.Instructions, test.instructions) {
+			t.Errorf("Import(%s) instructions = %q, want %q", test.path, recipe.Instructions, test.instructions)
+		}
+
+		if !reflect.DeepEqual(recipe.Tags, test.tags) {
+			t.Errorf("Import(%s) tags = %q, want %q", test.path, recipe.Tags, test.tags)
+		}
+
+		source := recipe.Source
+		if source == nil || source.Method != test.method || source.URL != server.URL+test.sourcePath || source.SiteName != test.siteName {
+			t.Errorf("Import(%s) source = %+v, want %s from %s", test.path, source, test.method, test.sourcePath)
+		}
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("/about", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<html><body><h1>About us</h1><p>We cook.</p></body></html>`))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{HTTPClient: server.Client()}
+	ctx := context.Background()
+
+	if _, err := client.Import(ctx, "ftp://example.com/recipe"); !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("Import(ftp) error = %v, want %v", err, ErrInvalidURL)
+	}
+
+	var fetchErr *FetchError
+	if _, err := client.Import(ctx, server.URL+"/missing"); !errors.As(err, &fetchErr) {
+		t.Errorf("Import(missing) error = %v, want a FetchError", err)
+	}
+
+	if _, err := client.Import(ctx, server.URL+"/json"); !errors.Is(err, ErrNotHTML) {
+		t.Errorf("Import(json) error = %v, want %v", err, ErrNotHTML)
+	}
+
+	if _, err := client.Import(ctx, server.URL+"/about"); !errors.Is(err, ErrNoRecipe) {
+		t.Errorf("Import(about) error = %v, want %v", err, ErrNoRecipe)
+	}
+
+	// The client used for users' imports must not reach local services
+	safe := &Client{HTTPClient: NewHTTPClient(5 * time.Second)}
+	if _, err := safe.Import(ctx, server.URL+"/about"); !errors.Is(err, ErrBlockedTarget) {
+		t.Errorf("Import(loopback) error = %v, want %v", err, ErrBlockedTarget)
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"169.254.169.254", false},
+		{"0.1.2.3", false},
+		{"100.64.0.1", false},
+		{"192.0.0.8", false},
+		{"198.19.0.1", false},
+		{"240.1.2.3", false},
+		{"64:ff9b::a01:203", false},
+		{"2002:a01:203::1", false},
+		{"::ffff:10.1.2.3", false},
+	}
+
+	for _, test := range tests {
+		if public := isPublic(net.ParseIP(test.ip)); public != test.public {
+			t.Errorf("isPublic(%s) = %t, want %t", test.ip, public, test.public)
+		}
+	}
+}
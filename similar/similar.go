@@ -0,0 +1,172 @@
+// Package similar ranks recipes by what they have in common: their
+// ingredients and their tags, weighted by TF-IDF so that sharing saffron
+// counts for more than sharing salt.
+package similar
+
+import (
+	"math"
+	"sort"
+
+	"github.com/harmlessevil/recipes-api/ingredients"
+)
+
+// The weights of ingredients and tags in the score.
+const (
+	ingredientWeight = 0.75
+	tagWeight        = 0.25
+)
+
+// Terms in more than maxDocumentFrequency of the documents, such as salt,
+// say little about how alike two recipes are but would match each
+// document to most of the others. They are left out of the postings once
+// there are at least minCommonDocuments documents, so that ranking does
+// not grow with the square of the documents.
+const (
+	maxDocumentFrequency = 0.5
+	minCommonDocuments   = 100
+)
+
+// Document is a recipe as it is compared.
+type Document struct {
+	ID string
+	// Ingredients are normalized ingredient names, see ingredients.Normalize
+	Ingredients []string
+	Tags        []string
+}
+
+// NewDocument reads the ingredient names of a recipe from its lines.
+func NewDocument(id string, tags []string, lines []string) Document {
+	document := Document{ID: id, Tags: tags}
+	for _, ingredient := range ingredients.ParseAll(lines) {
+		if ingredient.Name != "" {
+			document.Ingredients = append(document.Ingredients, ingredient.Name)
+		}
+	}
+
+	return document
+}
+
+// Match is a recipe similar to another, with a score from 0 to 1.
+type Match struct {
+	ID    string  `json:"id"`
+	Score float64 `json:"score"`
+}
+
+type posting struct {
+	document int
+	weight   float64
+}
+
+// index holds unit TF-IDF vectors of one field of the documents. Terms
+// count once per document however often they appear. Common terms are
+// kept in the vectors, so that they still weigh on the norms, but have no
+// postings.
+type index struct {
+	vectors  []map[string]float64
+	postings map[string][]posting
+}
+
+func newIndex(fields [][]string) index {
+	idx := index{vectors: make([]map[string]float64, len(fields)), postings: make(map[string][]posting)}
+
+	frequency := make(map[string]int)
+	for i, field := range fields {
+		idx.vectors[i] = make(map[string]float64)
+		for _, term := range field {
+			if _, ok := idx.vectors[i][term]; term != "" && !ok {
+				idx.vectors[i][term] = 0
+				frequency[term]++
+			}
+		}
+	}
+
+	n := float64(len(fields))
+	common := func(term string) bool {
+		return len(fields) >= minCommonDocuments && float64(frequency[term]) > maxDocumentFrequency*n
+	}
+
+	for i, vector := range idx.vectors {
+		norm := 0.0
+		for term := range vector {
+			// Smoothed, so that terms shared by every document still count
+			idf := math.Log((1+n)/(1+float64(frequency[term]))) + 1
+			vector[term] = idf
+			norm += idf * idf
+		}
+
+		norm = math.Sqrt(norm)
+		for term := range vector {
+			vector[term] /= norm
+			if common(term) {
+				continue
+			}
+
+			idx.postings[term] = append(idx.postings[term], posting{document: i, weight: vector[term]})
+		}
+	}
+
+	return idx
+}
+
+// add adds the cosine similarities of document i to the others to scores,
+// weighted by weight, and records the documents it touches.
+func (idx index) add(i int, weight float64, scores []float64, touched []int) []int {
+	for term, w := range idx.vectors[i] {
+		for _, p := range idx.postings[term] {
+			if p.document == i {
+				continue
+			}
+
+			if scores[p.document] == 0 {
+				touched = append(touched, p.document)
+			}
+			scores[p.document] += weight * w * p.weight
+		}
+	}
+
+	return touched
+}
+
+// Rank finds the limit most similar documents to each document, best
+// first. Documents with nothing in common are never matched.
+func Rank(documents []Document, limit int) [][]Match {
+	ingredientFields := make([][]string, len(documents))
+	tagFields := make([][]string, len(documents))
+	for i, document := range documents {
+		ingredientFields[i] = document.Ingredients
+		tagFields[i] = document.Tags
+	}
+
+	ingredientIndex := newIndex(ingredientFields)
+	tagIndex := newIndex(tagFields)
+
+	ranked := make([][]Match, len(documents))
+	scores := make([]float64, len(documents))
+	for i := range documents {
+		touched := ingredientIndex.add(i, ingredientWeight, scores, nil)
+		touched = tagIndex.add(i, tagWeight, scores, touched)
+
+		matches := make([]Match, 0, len(touched))
+		for _, j := range touched {
+			// Rounded, as the sums depend on the order of the terms
+			score := math.Round(math.Min(scores[j], 1)*1e4) / 1e4
+			matches = append(matches, Match{ID: documents[j].ID, Score: score})
+			scores[j] = 0
+		}
+
+		sort.Slice(matches, func(a, b int) bool {
+			if matches[a].Score != matches[b].Score {
+				return matches[a].Score > matches[b].Score
+			}
+
+			return matches[a].ID < matches[b].ID
+		})
+
+		if len(matches) > limit {
+			matches = matches[:limit]
+		}
+		ranked[i] = matches
+	}
+
+	return ranked
+}
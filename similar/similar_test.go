@@ -0,0 +1,94 @@
+package similar
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func testDocuments() []Document {
+	return []Document{
+		NewDocument("pancakes", []string{"breakfast"}, []string{"1 1/2 cups flour", "2 eggs", "1 1/4 cups milk", "1 tbsp sugar", "1 pinch salt"}),
+		NewDocument("crepes", []string{"breakfast", "french"}, []string{"1 cup flour", "2 eggs", "1 1/2 cups milk", "2 tbsp butter", "1 pinch salt"}),
+		NewDocument("saffron-risotto", []string{"italian"}, []string{"1 1/2 cups arborio rice", "1 pinch saffron", "4 cups stock", "1 onion", "1 pinch salt"}),
+		NewDocument("paella", []string{"spanish"}, []string{"2 cups rice", "1 pinch saffron", "1 lb shrimp", "1 onion", "1 pinch salt"}),
+		NewDocument("omelette", []string{"breakfast", "french"}, []string{"3 eggs", "1 tbsp butter", "1 pinch salt"}),
+		NewDocument("water", nil, []string{"1 glass water"}),
+	}
+}
+
+func ids(matches []Match) []string {
+	ids := make([]string, len(matches))
+	for i, match := range matches {
+		ids[i] = match.ID
+	}
+
+	return ids
+}
+
+func TestRank(t *testing.T) {
+	ranked := Rank(testDocuments(), 2)
+
+	tests := []struct {
+		document int
+		want     []string
+	}{
+		{0, []string{"crepes", "omelette"}},
+		// Butter and the french tag outweigh flour and milk
+		{1, []string{"omelette", "pancakes"}},
+		// Saffron and onion count for more than the salt shared by all
+		{3, []string{"saffron-risotto", "omelette"}},
+		{4, []string{"crepes", "pancakes"}},
+		{5, []string{}},
+	}
+
+	for _, test := range tests {
+		if got := ids(ranked[test.document]); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Rank(%d) = %v, want %v", test.document, got, test.want)
+		}
+	}
+
+	for i, matches := range ranked {
+		for j, match := range matches {
+			if match.Score <= 0 || match.Score > 1 {
+				t.Errorf("Rank(%d)[%d].Score = %v, want between 0 and 1", i, j, match.Score)
+			}
+			if j > 0 && match.Score > matches[j-1].Score {
+				t.Errorf("Rank(%d) is not ordered by score: %v", i, matches)
+			}
+		}
+	}
+}
+
+func TestRankIdentical(t *testing.T) {
+	document := NewDocument("a", []string{"dessert"}, []string{"1 cup sugar", "2 eggs"})
+	other := document
+	other.ID = "b"
+
+	ranked := Rank([]Document{document, other}, 10)
+
+	want := []Match{{ID: "b", Score: 1}}
+	if !reflect.DeepEqual(ranked[0], want) {
+		t.Errorf("Rank(identical) = %v, want %v", ranked[0], want)
+	}
+}
+
+func TestRankCommonTerms(t *testing.T) {
+	// Every recipe has salt, and pairs of recipes share another ingredient
+	documents := make([]Document, minCommonDocuments)
+	for i := range documents {
+		documents[i] = Document{
+			ID:          strconv.Itoa(i),
+			Ingredients: []string{"salt", "ingredient " + strconv.Itoa(i/2)},
+		}
+	}
+
+	ranked := Rank(documents, 10)
+
+	for i, matches := range ranked {
+		want := []string{strconv.Itoa(i ^ 1)}
+		if got := ids(matches); !reflect.DeepEqual(got, want) {
+			t.Errorf("Rank(%d) = %v, want %v", i, got, want)
+		}
+	}
+}
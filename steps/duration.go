@@ -0,0 +1,117 @@
+package steps
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+const number = `(\d+(?:\.\d+)?(?:\s+\d+/\d+|/\d+)?|[½¼¾]|an?|one|two|three|four|five|six|seven|eight|nine|ten|twelve|fifteen|twenty|thirty|forty-five|a few|several)`
+
+var (
+	durationPattern = regexp.MustCompile(`(?i)\b(?:(?:about|approximately|around|roughly|another|at least)\s+)?` +
+		number + `(?:\s*(?:to|-|–|or)\s*` + number + `)?\s*(seconds?|secs?|minutes?|mins?|hours?|hrs?)\b` +
+		`(?:,?\s+(?:and\s+)?` + number + `\s*(minutes?|mins?))?`)
+	temperaturePattern = regexp.MustCompile(`\b(\d{2,3})\s*(?:°\s*|º\s*|(?i:degrees?)\s*)?(F|C|(?i:fahrenheit|celsius))\b`)
+	// Temperatures without a unit, as in "preheat the oven to 450 degrees"
+	bareTemperaturePattern = regexp.MustCompile(`\b(\d{2,3})\s*(?:°|º|(?i:degrees?)\b)`)
+)
+
+var numberWords = map[string]float64{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+	"seven": 7, "eight": 8, "nine": 9, "ten": 10, "twelve": 12, "fifteen": 15,
+	"twenty": 20, "thirty": 30, "forty-five": 45, "a few": 3, "several": 3,
+	"½": 0.5, "¼": 0.25, "¾": 0.75,
+}
+
+func parseNumber(s string) float64 {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if value, ok := numberWords[s]; ok {
+		return value
+	}
+
+	var total float64
+	for _, field := range strings.Fields(s) {
+		if numerator, denominator, found := strings.Cut(field, "/"); found {
+			n, _ := strconv.ParseFloat(numerator, 64)
+			d, _ := strconv.ParseFloat(denominator, 64)
+			if d != 0 {
+				total += n / d
+			}
+
+			continue
+		}
+
+		value, _ := strconv.ParseFloat(field, 64)
+		total += value
+	}
+
+	return total
+}
+
+func unitSeconds(unit string) float64 {
+	switch unit = strings.ToLower(unit); {
+	case strings.HasPrefix(unit, "h"):
+		return 3600
+	case strings.HasPrefix(unit, "m"):
+		return 60
+	default:
+		return 1
+	}
+}
+
+// ParseDuration finds the first duration in text, such as "about 4 to 5
+// minutes" or "1 hour 30 minutes".
+func ParseDuration(text string) (*models.Timer, bool) {
+	match := durationPattern.FindStringSubmatch(text)
+	if match == nil {
+		return nil, false
+	}
+
+	unit := unitSeconds(match[3])
+
+	low := parseNumber(match[1]) * unit
+	high := low
+	if match[2] != "" {
+		high = parseNumber(match[2]) * unit
+	}
+
+	if match[4] != "" {
+		extra := parseNumber(match[4]) * unitSeconds(match[5])
+		low += extra
+		high += extra
+	}
+
+	if high < low {
+		low, high = high, low
+	}
+
+	if high == 0 {
+		return nil, false
+	}
+
+	return &models.Timer{Min: int(low), Max: int(high), Text: strings.TrimSpace(match[0])}, true
+}
+
+// ParseTemperature finds the first temperature in text, such as "350°F"
+// or "180 degrees C". Without a unit, the unit is guessed from the value.
+func ParseTemperature(text string) (*models.Temperature, bool) {
+	if match := temperaturePattern.FindStringSubmatch(text); match != nil {
+		value, _ := strconv.Atoi(match[1])
+		return &models.Temperature{Value: value, Unit: strings.ToUpper(match[2][:1])}, true
+	}
+
+	// Ovens rarely go beyond 260°C, and recipes rarely go below 260°F
+	if match := bareTemperaturePattern.FindStringSubmatch(text); match != nil {
+		value, _ := strconv.Atoi(match[1])
+		if value >= 260 {
+			return &models.Temperature{Value: value, Unit: "F"}, true
+		}
+
+		return &models.Temperature{Value: value, Unit: "C"}, true
+	}
+
+	return nil, false
+}
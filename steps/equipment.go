@@ -0,0 +1,108 @@
+package steps
+
+import (
+	"sort"
+	"strings"
+)
+
+// equipment is matched longest first, so that a "grill pan" is not also
+// reported as a grill and a pan.
+var equipment = []string{
+	"air fryer", "aluminum foil", "baking dish", "baking pan", "baking sheet", "blender",
+	"bowl", "cake pan", "casserole dish", "colander", "cutting board", "dutch oven",
+	"food processor", "grill", "grill pan", "griddle", "immersion blender", "instant pot",
+	"knife", "ladle", "loaf pan", "microwave", "mixer", "muffin tin", "oven",
+	"pan", "parchment paper", "plastic wrap", "pot", "pressure cooker", "ramekin",
+	"rolling pin", "saucepan", "sheet pan", "sieve", "skillet", "slow cooker",
+	"spatula", "springform pan", "stand mixer", "stockpot", "strainer", "thermometer",
+	"toaster oven", "tongs", "waffle iron", "whisk", "wire rack", "wok",
+}
+
+func init() {
+	sort.SliceStable(equipment, func(i, j int) bool {
+		return len(equipment[i]) > len(equipment[j])
+	})
+}
+
+// isWordBoundary reports whether the byte at i of s does not continue a word.
+func isWordBoundary(s string, i int) bool {
+	if i < 0 || i >= len(s) {
+		return true
+	}
+
+	c := s[i]
+
+	return !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-')
+}
+
+// findWord returns the positions of word in text, also matching its plural.
+func findWord(text string, word string) [][2]int {
+	var found [][2]int
+	for start := 0; start < len(text); {
+		i := strings.Index(text[start:], word)
+		if i < 0 {
+			break
+		}
+		i += start
+
+		end := i + len(word)
+		if strings.HasPrefix(text[end:], "es") && isWordBoundary(text, end+2) {
+			end += 2
+		} else if strings.HasPrefix(text[end:], "s") && isWordBoundary(text, end+1) {
+			end++
+		}
+
+		if isWordBoundary(text, i-1) && isWordBoundary(text, end) {
+			found = append(found, [2]int{i, end})
+		}
+
+		start = i + len(word)
+	}
+
+	return found
+}
+
+// Equipment lists the equipment mentioned in text, in order of appearance.
+func Equipment(text string) []string {
+	text = strings.ToLower(text)
+
+	used := make([]bool, len(text))
+
+	type mention struct {
+		name     string
+		position int
+	}
+
+	var mentions []mention
+	for _, name := range equipment {
+		for _, span := range findWord(text, name) {
+			overlaps := false
+			for i := span[0]; i < span[1]; i++ {
+				overlaps = overlaps || used[i]
+			}
+			if overlaps {
+				continue
+			}
+
+			for i := span[0]; i < span[1]; i++ {
+				used[i] = true
+			}
+			mentions = append(mentions, mention{name, span[0]})
+		}
+	}
+
+	sort.Slice(mentions, func(i, j int) bool {
+		return mentions[i].position < mentions[j].position
+	})
+
+	names := []string{}
+	seen := map[string]bool{}
+	for _, m := range mentions {
+		if !seen[m.name] {
+			seen[m.name] = true
+			names = append(names, m.name)
+		}
+	}
+
+	return names
+}
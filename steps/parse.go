@@ -0,0 +1,220 @@
+// Package steps turns free-text recipe instructions into structured steps
+// with timers, temperatures, equipment and ingredient references.
+package steps
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/harmlessevil/recipes-api/ingredients"
+	"github.com/harmlessevil/recipes-api/models"
+)
+
+// cookingWords mark steps whose timer counts towards the cooking time rather
+// than the preparation time.
+var cookingWords = []string{
+	"bake", "boil", "braise", "broil", "brown", "cook", "fry", "grill", "heat",
+	"microwave", "poach", "roast", "saute", "sauté", "sear", "simmer", "steam",
+	"stir-fry", "toast",
+}
+
+// heatedEquipment mark steps as cooking like cookingWords do.
+var heatedEquipment = map[string]bool{
+	"air fryer": true, "dutch oven": true, "griddle": true, "grill": true,
+	"grill pan": true, "instant pot": true, "microwave": true, "oven": true,
+	"pressure cooker": true, "saucepan": true, "skillet": true, "slow cooker": true,
+	"stockpot": true, "toaster oven": true, "waffle iron": true, "wok": true,
+}
+
+// joinFragments undoes the splitting of instructions on periods found in
+// imported data. Fragments that continue a sentence start with whitespace or
+// a closing parenthesis, and fragments of URLs or abbreviations start in
+// lowercase; anything else is a separate instruction.
+func joinFragments(instructions []string) string {
+	var b strings.Builder
+	for i, fragment := range instructions {
+		if i > 0 {
+			first, _ := firstRune(fragment)
+			prev := strings.TrimRightFunc(instructions[i-1], unicode.IsSpace)
+
+			switch {
+			case strings.HasSuffix(prev, ".") || strings.HasSuffix(prev, "!") || strings.HasSuffix(prev, "?"):
+				b.WriteString("\n")
+			case unicode.IsSpace(first) || first == ')' || unicode.IsLower(first):
+				b.WriteString(".")
+			default:
+				b.WriteString(".\n")
+			}
+		}
+
+		b.WriteString(fragment)
+	}
+
+	return b.String()
+}
+
+func firstRune(s string) (rune, bool) {
+	for _, r := range s {
+		return r, true
+	}
+
+	return 0, false
+}
+
+// splitSentences splits a line after sentence punctuation followed by a
+// space and the start of a new sentence.
+func splitSentences(line string) []string {
+	var sentences []string
+
+	runes := []rune(line)
+	start := 0
+	for i := 0; i < len(runes)-2; i++ {
+		if !strings.ContainsRune(".!?", runes[i]) || runes[i+1] != ' ' {
+			continue
+		}
+
+		next := runes[i+2]
+		if unicode.IsUpper(next) || unicode.IsDigit(next) || next == '(' {
+			sentences = append(sentences, string(runes[start:i+1]))
+			start = i + 2
+		}
+	}
+
+	return append(sentences, string(runes[start:]))
+}
+
+func isNoise(sentence string) bool {
+	lower := strings.ToLower(sentence)
+
+	return strings.HasPrefix(lower, "read more at") ||
+		strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") ||
+		strings.IndexFunc(sentence, unicode.IsLetter) < 0
+}
+
+// Sentences splits instructions into clean sentences, dropping blank
+// fragments and links to the source of the recipe. Headings such as "For
+// the sauce:" are kept with the sentence that follows them.
+func Sentences(instructions []string) []string {
+	text := strings.ReplaceAll(joinFragments(instructions), "\r", "")
+
+	var sentences []string
+	heading := ""
+	for _, line := range strings.Split(text, "\n") {
+		for _, sentence := range splitSentences(line) {
+			sentence = strings.Join(strings.Fields(sentence), " ")
+			if sentence == "" || isNoise(sentence) {
+				continue
+			}
+
+			if strings.HasSuffix(sentence, ":") {
+				heading += sentence + " "
+				continue
+			}
+
+			sentences = append(sentences, heading+sentence)
+			heading = ""
+		}
+	}
+
+	if heading != "" {
+		sentences = append(sentences, strings.TrimSpace(heading))
+	}
+
+	return sentences
+}
+
+// ingredientReferences returns the indexes of the ingredients mentioned in
+// text, either by full name or by the last word of their name, so that
+// "the chicken" refers to "chicken breasts".
+func ingredientReferences(text string, names []string) []int {
+	text = strings.ToLower(text)
+
+	refs := []int{}
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+
+		head := name
+		if j := strings.LastIndexByte(name, ' '); j >= 0 {
+			head = name[j+1:]
+		}
+
+		if len(findWord(text, name)) > 0 || len(findWord(text, head)) > 0 {
+			refs = append(refs, i)
+		}
+	}
+
+	return refs
+}
+
+// Parse turns instructions into steps. Ingredient references are indexes
+// into ingredientLines.
+func Parse(instructions []string, ingredientLines []string) []models.Step {
+	names := make([]string, len(ingredientLines))
+	for i, line := range ingredientLines {
+		if ingredient, ok := ingredients.Parse(line); ok {
+			names[i] = ingredient.Name
+		}
+	}
+
+	sentences := Sentences(instructions)
+
+	steps := make([]models.Step, 0, len(sentences))
+	for i, sentence := range sentences {
+		step := models.Step{
+			Number:      i + 1,
+			Text:        sentence,
+			Equipment:   Equipment(sentence),
+			Ingredients: ingredientReferences(sentence, names),
+		}
+
+		step.Timer, _ = ParseDuration(sentence)
+		step.Temperature, _ = ParseTemperature(sentence)
+
+		steps = append(steps, step)
+	}
+
+	return steps
+}
+
+// isCooking reports whether a step applies heat.
+func isCooking(step *models.Step) bool {
+	if step.Temperature != nil {
+		return true
+	}
+
+	for _, name := range step.Equipment {
+		if heatedEquipment[name] {
+			return true
+		}
+	}
+
+	text := strings.ToLower(step.Text)
+	for _, word := range cookingWords {
+		if len(findWord(text, word)) > 0 || len(findWord(text, word+"ed")) > 0 || len(findWord(text, word+"ing")) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Times sums the timers of steps into preparation and cooking time in
+// minutes. Ranges count with their upper bound.
+func Times(steps []models.Step) (prep int, cook int) {
+	var prepSeconds, cookSeconds int
+	for i := range steps {
+		if steps[i].Timer == nil {
+			continue
+		}
+
+		if isCooking(&steps[i]) {
+			cookSeconds += steps[i].Timer.Max
+		} else {
+			prepSeconds += steps[i].Timer.Max
+		}
+	}
+
+	return (prepSeconds + 59) / 60, (cookSeconds + 59) / 60
+}
@@ -0,0 +1,138 @@
+package steps
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSentences(t *testing.T) {
+	got := Sentences([]string{
+		"To marinate the chicken: In a dish, combine the lemon juice and olive oil",
+		" Cover and refrigerate for at least 30 minutes",
+		"\r\n\r\nTo cook the chicken:\r\nHeat a skillet over high heat",
+		" (Or use a grill",
+		")\r\n\r\nRead more at: http://www",
+		"foodnetwork",
+		"com/recipes/chicken",
+		"",
+	})
+
+	want := []string{
+		"To marinate the chicken: In a dish, combine the lemon juice and olive oil.",
+		"Cover and refrigerate for at least 30 minutes.",
+		"To cook the chicken: Heat a skillet over high heat.",
+		"(Or use a grill.)",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Sentences() = %q, want %q", got, want)
+	}
+}
+
+func TestSentencesOfWellFormedInstructions(t *testing.T) {
+	got := Sentences([]string{"Preheat the oven to 180°C.", "Mix the flour and sugar", "Bake for 1.5 hours. Let cool."})
+	want := []string{"Preheat the oven to 180°C.", "Mix the flour and sugar.", "Bake for 1.5 hours.", "Let cool."}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Sentences() = %q, want %q", got, want)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		text     string
+		min, max int
+	}{
+		{"cook until browned, about 4 to 5 minutes on each side", 240, 300},
+		{"simmer for 20 minutes", 1200, 1200},
+		{"bake 10-12 mins", 600, 720},
+		{"roast for 1 1/2 hours", 5400, 5400},
+		{"braise for 1 hour 30 minutes", 5400, 5400},
+		{"let rise until doubled, about 1 hour, 30 minutes", 5400, 5400},
+		{"let rise for an hour", 3600, 3600},
+		{"whisk for 30 seconds", 30, 30},
+	}
+
+	for _, tt := range tests {
+		timer, ok := ParseDuration(tt.text)
+		if !ok {
+			t.Errorf("ParseDuration(%q) found no duration", tt.text)
+			continue
+		}
+
+		if timer.Min != tt.min || timer.Max != tt.max {
+			t.Errorf("ParseDuration(%q) = %d..%d, want %d..%d", tt.text, timer.Min, timer.Max, tt.min, tt.max)
+		}
+	}
+
+	if timer, ok := ParseDuration("season with salt and pepper"); ok {
+		t.Errorf("ParseDuration() = %+v, want no duration", timer)
+	}
+}
+
+func TestParseTemperature(t *testing.T) {
+	tests := map[string]string{
+		"Preheat the oven to 375F":           "375F",
+		"Preheat the oven to 180°C":          "180C",
+		"heat the oil to 350 degrees F":      "350F",
+		"bake at 200 degrees Celsius":        "200C",
+		"Preheat the oven to 425 Fahrenheit": "425F",
+		"Preheat oven to 450 degrees":        "450F",
+		"Preheat oven to 180°":               "180C",
+	}
+
+	for text, want := range tests {
+		temperature, ok := ParseTemperature(text)
+		if !ok {
+			t.Errorf("ParseTemperature(%q) found no temperature", text)
+			continue
+		}
+
+		if got := fmt.Sprintf("%d%s", temperature.Value, temperature.Unit); got != want {
+			t.Errorf("ParseTemperature(%q) = %s, want %s", text, got, want)
+		}
+	}
+
+	if temperature, ok := ParseTemperature("add 2 cups of flour"); ok {
+		t.Errorf("ParseTemperature() = %+v, want no temperature", temperature)
+	}
+}
+
+func TestEquipment(t *testing.T) {
+	got := Equipment("Heat a grill pan, then transfer to a baking sheet lined with parchment paper and put in the oven")
+	want := []string{"grill pan", "baking sheet", "parchment paper", "oven"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Equipment() = %q, want %q", got, want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	steps := Parse([]string{
+		"Combine the lemon juice and olive oil in a bowl",
+		" Add the chicken breasts and marinate for 30 minutes",
+		" Cook the chicken in a skillet over high heat, about 4 to 5 minutes",
+	}, []string{
+		"4 boneless skinless chicken breasts",
+		"2 tablespoons extra-virgin olive oil",
+		"1 lemon, juiced",
+	})
+
+	if len(steps) != 3 {
+		t.Fatalf("Parse() returned %d steps, want 3", len(steps))
+	}
+
+	if want := []int{1, 2}; !reflect.DeepEqual(steps[0].Ingredients, want) {
+		t.Errorf("step 1 ingredients = %v, want %v", steps[0].Ingredients, want)
+	}
+
+	if want := []string{"skillet"}; !reflect.DeepEqual(steps[2].Equipment, want) {
+		t.Errorf("step 3 equipment = %q, want %q", steps[2].Equipment, want)
+	}
+
+	prep, cook := Times(steps)
+	if prep != 30 || cook != 5 {
+		t.Errorf("Times() = %d, %d, want 30, 5", prep, cook)
+	}
+}